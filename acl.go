@@ -0,0 +1,200 @@
+package nutsak
+
+import (
+	"bufio"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/mjwhitta/errors"
+)
+
+// aclRules are the allow and deny lists that a listener checks each
+// peer against, before any data is exchanged.
+type aclRules struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+func newACLRules() *aclRules {
+	return &aclRules{}
+}
+
+// add will add the provided comma or space separated list of IPs and
+// CIDRs to the rules of the provided kind (allow or deny).
+//
+//nolint:mnd // IPv4-mapped prefix length
+func (r *aclRules) add(kind string, list string) error {
+	var a netip.Addr
+	var e error
+	var p netip.Prefix
+
+	for _, entry := range strings.FieldsFunc(
+		list,
+		func(c rune) bool {
+			return (c == ',') || (c == ' ') || (c == '\t')
+		},
+	) {
+		if p, e = netip.ParsePrefix(entry); e != nil {
+			if a, e = netip.ParseAddr(entry); e != nil {
+				return errors.Newf("invalid %s %s", kind, entry)
+			}
+
+			a = a.Unmap().WithZone("")
+			p = netip.PrefixFrom(a, a.BitLen())
+		} else if a = p.Addr(); a.Is4In6() {
+			// Match v4-mapped rules against unmapped peers
+			p = netip.PrefixFrom(a.Unmap(), max(p.Bits()-96, 0))
+		}
+
+		if kind == "allow" {
+			r.allow = append(r.allow, p.Masked())
+		} else {
+			r.deny = append(r.deny, p.Masked())
+		}
+	}
+
+	return nil
+}
+
+// check will return why the provided peer is rejected, or an empty
+// string if it is allowed. Deny rules win over allow rules, and an
+// empty allow list allows everyone that isn't denied.
+func (r *aclRules) check(peer net.Addr) string {
+	var a netip.Addr
+	var ap netip.AddrPort
+	var e error
+
+	if (len(r.allow) == 0) && (len(r.deny) == 0) {
+		return ""
+	}
+
+	if ap, e = netip.ParseAddrPort(peer.String()); e != nil {
+		return "unknown address"
+	}
+
+	// Dual-stack listeners see IPv4 peers as v4-mapped
+	a = ap.Addr().Unmap().WithZone("")
+
+	for _, p := range r.deny {
+		if p.Contains(a) {
+			return "denied by " + p.String()
+		}
+	}
+
+	if len(r.allow) == 0 {
+		return ""
+	}
+
+	for _, p := range r.allow {
+		if p.Contains(a) {
+			return ""
+		}
+	}
+
+	return "not allowed"
+}
+
+// isACLEntry will return whether or not the provided string is an IP
+// or CIDR, so that seeds can list several of them separated by
+// commas.
+func isACLEntry(s string) bool {
+	var e error
+
+	if _, e = netip.ParsePrefix(s); e == nil {
+		return true
+	}
+
+	_, e = netip.ParseAddr(s)
+
+	return e == nil
+}
+
+// load will read rules from the provided file. Each line starts with
+// allow or deny, followed by a list of IPs and CIDRs. Blank lines and
+// anything after a # are ignored.
+func (r *aclRules) load(fn string) error {
+	var e error
+	var f *os.File
+	var kind string
+	var line string
+	var lineno int
+	var list string
+	var s *bufio.Scanner
+
+	if f, e = os.Open(fn); e != nil {
+		return errors.Newf("failed to open %s: %w", fn, e)
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	s = bufio.NewScanner(f)
+
+	for s.Scan() {
+		lineno++
+
+		line, _, _ = strings.Cut(s.Text(), "#")
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+
+		kind, list, _ = strings.Cut(line, " ")
+
+		switch strings.ToLower(kind) {
+		case "allow", "deny":
+			if e = r.add(strings.ToLower(kind), list); e != nil {
+				return errors.Newf("%s:%d: %w", fn, lineno, e)
+			}
+		default:
+			return errors.Newf(
+				"%s:%d: unknown rule %s",
+				fn,
+				lineno,
+				kind,
+			)
+		}
+	}
+
+	if e = s.Err(); e != nil {
+		return errors.Newf("failed to read %s: %w", fn, e)
+	}
+
+	return nil
+}
+
+// parse will parse the provided option, if it is an ACL option. It
+// returns whether or not the option was consumed. ACL options are not
+// consumed for clients.
+func (r *aclRules) parse(
+	k string,
+	v string,
+	server bool,
+) (bool, error) {
+	var e error
+
+	if !server {
+		return false, nil
+	}
+
+	switch k {
+	case "acl":
+		if v == "" {
+			return true, errors.Newf("invalid %s %s", k, v)
+		}
+
+		e = r.load(v)
+	case "allow", "deny":
+		if v == "" {
+			return true, errors.Newf("invalid %s %s", k, v)
+		}
+
+		e = r.add(k, v)
+	default:
+		return false, nil
+	}
+
+	return true, e
+}
@@ -2,29 +2,40 @@ package nutsak
 
 import (
 	"io"
+	"maps"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mjwhitta/errors"
 )
 
 // baseNUt is a network utility that stores relevant data for all
 // network utility types.
 type baseNUt struct {
-	config map[string]string
-	lock   *sync.RWMutex
+	config      map[string]string
+	idleTimeout time.Duration
+	lock        *sync.RWMutex
+	maxDuration time.Duration
 	//      /  pwIn:prIn  ->  Read() \
 	// src {                          } NUt
 	//      \ prOut:pwOut <- Write() /
-	prIn    *io.PipeReader
-	prOut   *io.PipeReader
-	pwIn    *io.PipeWriter
-	pwOut   *io.PipeWriter
-	theType string
-	up      bool
+	prIn      *io.PipeReader
+	prOut     *io.PipeReader
+	pwIn      *io.PipeWriter
+	pwOut     *io.PipeWriter
+	seed      string
+	stats     map[string]uint64
+	statsLock *sync.Mutex
+	theType   string
+	up        *atomic.Bool
 }
 
 func super(seed string) *baseNUt {
 	var addr string
 	var hasOpts bool
+	var last string
 	var nut *baseNUt
 	var opts string
 	var theType string
@@ -32,9 +43,13 @@ func super(seed string) *baseNUt {
 	theType, opts, hasOpts = strings.Cut(seed, ":")
 
 	nut = &baseNUt{
-		config:  map[string]string{"addr": ""},
-		lock:    &sync.RWMutex{},
-		theType: strings.ToLower(theType),
+		config:    map[string]string{"addr": ""},
+		lock:      &sync.RWMutex{},
+		seed:      seed,
+		stats:     map[string]uint64{},
+		statsLock: &sync.Mutex{},
+		theType:   strings.ToLower(theType),
+		up:        &atomic.Bool{},
 	}
 
 	if hasOpts {
@@ -45,11 +60,18 @@ func super(seed string) *baseNUt {
 		// Parse any remaining config options
 		if hasOpts {
 			for _, cfg := range strings.Split(opts, ",") {
-				if k, v, ok := strings.Cut(cfg, "="); ok {
-					nut.config[strings.ToLower(k)] = v
-				} else {
-					nut.config[strings.ToLower(k)] = ""
+				k, v, ok := strings.Cut(cfg, "=")
+
+				// Address lists continue across commas
+				if !ok && isACLEntry(k) {
+					if (last == "allow") || (last == "deny") {
+						nut.config[last] += "," + k
+						continue
+					}
 				}
+
+				last = strings.ToLower(k)
+				nut.config[last] = v
 			}
 		}
 	}
@@ -62,6 +84,13 @@ func (nut *baseNUt) Close() error {
 	return nut.Down()
 }
 
+func (nut *baseNUt) count(stat string, delta uint64) {
+	nut.statsLock.Lock()
+	defer nut.statsLock.Unlock()
+
+	nut.stats[stat] += delta
+}
+
 // Down is a default that is not implemented. Each NUt will implement.
 func (nut *baseNUt) Down() error {
 	// Close pipes
@@ -87,7 +116,13 @@ func (nut *baseNUt) Down() error {
 // IsUp will return whether or not the network utility is up and
 // running.
 func (nut *baseNUt) IsUp() bool {
-	return nut.up
+	return nut.up.Load()
+}
+
+// limits will return the idle timeout and max duration of the
+// network utility, if any.
+func (nut *baseNUt) limits() (time.Duration, time.Duration) {
+	return nut.idleTimeout, nut.maxDuration
 }
 
 // Open is an alias for Up().
@@ -95,6 +130,50 @@ func (nut *baseNUt) Open() error {
 	return nut.Up()
 }
 
+// origin will return the seed the network utility was created from.
+func (nut *baseNUt) origin() string {
+	return nut.seed
+}
+
+// parseLimit will parse the provided option, if it is a limit that
+// every NUt supports. It returns whether or not the option was
+// consumed.
+func (nut *baseNUt) parseLimit(k string, v string) (bool, error) {
+	var d time.Duration
+	var e error
+
+	switch k {
+	case "idle-timeout", "max-duration":
+		if d, e = time.ParseDuration(v); e != nil {
+			return true, errors.Newf("invalid %s %s: %w", k, v, e)
+		} else if d <= 0 {
+			return true, errors.Newf("invalid %s %s", k, v)
+		}
+	default:
+		return false, nil
+	}
+
+	if k == "idle-timeout" {
+		nut.idleTimeout = d
+	} else {
+		nut.maxDuration = d
+	}
+
+	return true, nil
+}
+
+// Stats will return a copy of the network utility's counters.
+func (nut *baseNUt) Stats() map[string]uint64 {
+	var stats map[string]uint64 = map[string]uint64{}
+
+	nut.statsLock.Lock()
+	defer nut.statsLock.Unlock()
+
+	maps.Copy(stats, nut.stats)
+
+	return stats
+}
+
 // String will return a string representation of the baseNUt.
 func (nut *baseNUt) String() string {
 	var sb strings.Builder
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/mjwhitta/cli"
 	hl "github.com/mjwhitta/hilighter"
@@ -25,12 +26,19 @@ const (
 var (
 	// Flags
 	flags struct {
-		debug   cli.Counter
-		nocolor bool
-		nsfw    bool
-		quiet   bool
-		verbose bool
-		version bool
+		debug       cli.Counter
+		hexdump     bool
+		idleTimeout string
+		maxDuration string
+		nocolor     bool
+		nsfw        bool
+		pcap        string
+		quiet       bool
+		record      string
+		recordSeed  uint
+		trace       string
+		verbose     bool
+		version     bool
 	}
 
 	// SEEDTYPES should be initialized at compile time.
@@ -94,6 +102,27 @@ func init() {
 		"debug",
 		"Show additional levels of debug messages.",
 	)
+	cli.Flag(
+		&flags.hexdump,
+		"x",
+		"hexdump",
+		false,
+		"Log traffic as a hexdump (to stderr, unless --trace).",
+	)
+	cli.Flag(
+		&flags.idleTimeout,
+		"T",
+		"idle-timeout",
+		"",
+		"Tear down the tunnel after DURATION without traffic.",
+	)
+	cli.Flag(
+		&flags.maxDuration,
+		"t",
+		"max-duration",
+		"",
+		"Tear down the tunnel after DURATION, regardless of traffic.",
+	)
 	cli.Flag(
 		&flags.nocolor,
 		"no-color",
@@ -101,7 +130,31 @@ func init() {
 		"Disable colorized output.",
 	)
 	cli.Flag(&flags.nsfw, "nsfw", false, "Show NSFW banner.", true)
+	cli.Flag(
+		&flags.pcap,
+		"pcap",
+		"",
+		"Capture traffic to PATH as pcap, for Wireshark.",
+	)
 	cli.Flag(&flags.quiet, "q", "quiet", false, "Do not show banner.")
+	cli.Flag(
+		&flags.record,
+		"record",
+		"",
+		"Record the session to PATH, for the replay seed.",
+	)
+	cli.Flag(
+		&flags.recordSeed,
+		"record-seed",
+		0,
+		"Record seed N (1 or 2), instead of the last one provided.",
+	)
+	cli.Flag(
+		&flags.trace,
+		"trace",
+		"",
+		"Log traffic to PATH (- for stderr), as text unless -x.",
+	)
 	cli.Flag(
 		&flags.verbose,
 		"v",
@@ -114,6 +167,23 @@ func init() {
 	cli.Parse()
 }
 
+// parseDuration will parse the provided duration flag, exiting if it
+// is invalid.
+func parseDuration(v string) time.Duration {
+	var d time.Duration
+	var e error
+
+	if v == "" {
+		return 0
+	}
+
+	if d, e = time.ParseDuration(v); (e != nil) || (d <= 0) {
+		cli.Usage(InvalidOption)
+	}
+
+	return d
+}
+
 // Process cli flags and ensure no issues
 func validate() {
 	hl.Disable(flags.nocolor)
@@ -127,6 +197,14 @@ func validate() {
 	}
 
 	// Validate cli flags
+	sak.IdleTimeout = parseDuration(flags.idleTimeout)
+	sak.MaxDuration = parseDuration(flags.maxDuration)
+
+	//nolint:mnd // 2 seeds
+	if flags.recordSeed > 2 {
+		cli.Usage(InvalidOption)
+	}
+
 	if cli.NArg() < 1 {
 		cli.Usage(MissingArgument)
 	} else if cli.NArg() > 2 { //nolint:mnd // 2 cli args
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"maps"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 
 	"github.com/mjwhitta/cli"
@@ -27,10 +29,14 @@ func main() {
 	}()
 
 	var e error
+	var hooks []func(from sak.NUt, to sak.NUt, p []byte)
+	var hup chan os.Signal = make(chan os.Signal, 1)
 	var lefty sak.NUt
+	var pw *sak.PcapWriter
+	var rec int
 	var righty sak.NUt
+	var seeds []string
 	var sig chan os.Signal = make(chan os.Signal, 1)
-	var tmp string = "-"
 
 	validate()
 
@@ -48,17 +54,56 @@ func main() {
 		sak.LogLvl = int(flags.debug)
 	}
 
-	// Create first NUt
-	if lefty, e = sak.NewNUt(cli.Arg(0)); e != nil {
-		panic(e)
+	// Trace and capture setup
+	if (flags.trace != "") || flags.hexdump {
+		hooks = append(
+			hooks,
+			sak.NewTracer(traceFile(), flags.hexdump).Trace,
+		)
 	}
 
-	// Create second NUt
+	if flags.pcap != "" {
+		if pw, e = sak.NewPcapWriter(openFile(flags.pcap)); e != nil {
+			panic(e)
+		}
+
+		hooks = append(hooks, pw.Trace)
+	}
+
+	if len(hooks) > 0 {
+		sak.Trace = func(from sak.NUt, to sak.NUt, p []byte) {
+			for _, hook := range hooks {
+				hook(from, to, p)
+			}
+		}
+	}
+
+	seeds = []string{cli.Arg(0), "-"}
+
 	if cli.NArg() == 2 { //nolint:mnd // 2 cli args
-		tmp = cli.Arg(1)
+		seeds[1] = cli.Arg(1)
+	}
+
+	// Record the last seed provided, unless told otherwise. Data read
+	// from the recorded seed is the server side, so this should be
+	// the seed that faces the server.
+	if flags.record != "" {
+		rec = cli.NArg() - 1
+
+		if flags.recordSeed > 0 {
+			rec = int(flags.recordSeed) - 1
+		}
+
+		seeds[rec] = "record=" + flags.record + "|" + seeds[rec]
 	}
 
-	if righty, e = sak.NewNUt(tmp); e != nil {
+	// Create first NUt
+	if lefty, e = sak.NewNUt(seeds[0]); e != nil {
+		panic(e)
+	}
+
+	// Create second NUt
+	if righty, e = sak.NewNUt(seeds[1]); e != nil {
 		panic(e)
 	}
 
@@ -69,6 +114,8 @@ func main() {
 		// Wait for ^C
 		<-sig
 
+		stats(lefty, righty)
+
 		// Don't care about errors on ^C
 		_ = lefty.Down()
 		_ = righty.Down()
@@ -76,8 +123,75 @@ func main() {
 		os.Exit(130) //nolint:mnd // 130 is typical ^C exit status
 	}()
 
+	// Setup SIGHUP trap to reload configs (such as TLS certs)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			reload(lefty, righty)
+		}
+	}()
+
 	// Pair NUts to create two-way tunnel
 	if e = sak.Pair(lefty, righty); e != nil {
 		panic(e)
 	}
+
+	stats(lefty, righty)
+}
+
+func reload(nuts ...sak.NUt) {
+	for _, nut := range nuts {
+		if r, ok := nut.(sak.Reloader); ok {
+			if e := r.Reload(); e != nil {
+				log.Err(e.Error())
+			}
+		}
+	}
+}
+
+// openFile will open the provided file for writing, exiting if it
+// can't be opened. The file is truncated, so that every run starts a
+// new log or capture.
+func openFile(fn string) *os.File {
+	var e error
+	var f *os.File
+
+	//nolint:mnd // u=rw,go=-
+	f, e = os.OpenFile(
+		fn,
+		os.O_CREATE|os.O_TRUNC|os.O_WRONLY,
+		0o600,
+	)
+	if e != nil {
+		panic(e)
+	}
+
+	return f
+}
+
+// traceFile will return the file that traffic is traced to, which
+// is stderr unless a path was provided.
+func traceFile() *os.File {
+	if (flags.trace == "") || (flags.trace == "-") {
+		return os.Stderr
+	}
+
+	return openFile(flags.trace)
+}
+
+func stats(nuts ...sak.NUt) {
+	if flags.debug == 0 {
+		return
+	}
+
+	for _, nut := range nuts {
+		if s, ok := nut.(sak.StatsReporter); ok {
+			var counters map[string]uint64 = s.Stats()
+
+			for _, k := range slices.Sorted(maps.Keys(counters)) {
+				log.SubInfof("%s %s: %d", nut.Type(), k, counters[k])
+			}
+		}
+	}
 }
@@ -0,0 +1,418 @@
+package nutsak
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mjwhitta/errors"
+)
+
+// transform will convert as much of src as it can, and return the
+// output along with how many bytes of src were used. The rest of src
+// is passed in again with more data, unless final is true, in which
+// case all of src must be used.
+type transform func(src []byte, final bool) ([]byte, int, error)
+
+// codec is a text encoding that can be applied to a stream in either
+// direction. Whitespace is ignored when decoding.
+type codec struct {
+	decode transform
+	encode transform
+	name   string
+}
+
+// upperHex is used for percent-encoding, which prefers uppercase.
+const upperHex string = "0123456789ABCDEF"
+
+var codecs map[string]codec = map[string]codec{
+	"base64": {
+		decode: base64Decode(base64.StdEncoding),
+		encode: base64Encode(base64.StdEncoding),
+		name:   "base64",
+	},
+	"base64url": {
+		decode: base64Decode(base64.URLEncoding),
+		encode: base64Encode(base64.URLEncoding),
+		name:   "base64url",
+	},
+	"hex": {decode: hexDecode, encode: hexEncode, name: "hex"},
+	"urlencode": {
+		decode: urlDecode,
+		encode: urlEncode,
+		name:   "urlencode",
+	},
+}
+
+// codecFilter encodes data written to the NUt and decodes data read
+// from it. If inverse is true, it decodes data written to the NUt and
+// encodes data read from it instead. Encoded output is wrapped into
+// lines of the provided width, if it is not zero.
+type codecFilter struct {
+	c       codec
+	inverse bool
+	wrap    int
+}
+
+// newCodecFilter will return a new Filter from the provided spec, of
+// the form NAME[=WRAP].
+func newCodecFilter(spec string, inverse bool) (Filter, error) {
+	var c codec
+	var e error
+	var f codecFilter = codecFilter{inverse: inverse}
+	var name string
+	var ok bool
+	var wrap string
+
+	name, wrap, _ = strings.Cut(spec, "=")
+
+	if c, ok = codecs[strings.ToLower(name)]; !ok {
+		return nil, errors.Newf("unknown encoding %s", name)
+	}
+
+	f.c = c
+
+	if wrap != "" {
+		if f.wrap, e = strconv.Atoi(wrap); e != nil {
+			return nil, errors.Newf("invalid wrap %s: %w", wrap, e)
+		} else if f.wrap <= 0 {
+			return nil, errors.Newf("invalid wrap %s", wrap)
+		}
+	}
+
+	return f, nil
+}
+
+// codecFilterFunc will return a FilterFunc for the named codec, so
+// that each codec can be used as a filter on its own.
+func codecFilterFunc(name string) FilterFunc {
+	return func(arg string) (Filter, error) {
+		if arg != "" {
+			return newCodecFilter(name+"="+arg, false)
+		}
+
+		return newCodecFilter(name, false)
+	}
+}
+
+func newDecodeFilter(arg string) (Filter, error) {
+	return newCodecFilter(arg, true)
+}
+
+func newEncodeFilter(arg string) (Filter, error) {
+	return newCodecFilter(arg, false)
+}
+
+// encoder will return the encode transform, with line wrapping.
+func (f codecFilter) encoder() transform {
+	var col int
+
+	if f.wrap == 0 {
+		return f.c.encode
+	}
+
+	return func(src []byte, final bool) ([]byte, int, error) {
+		var e error
+		var n int
+		var out []byte
+		var wrapped []byte
+
+		if out, n, e = f.c.encode(src, final); e != nil {
+			return nil, 0, e
+		}
+
+		for len(out) > 0 {
+			take := min(f.wrap-col, len(out))
+
+			wrapped = append(wrapped, out[:take]...)
+			out = out[take:]
+
+			if col += take; col == f.wrap {
+				wrapped = append(wrapped, '\n')
+				col = 0
+			}
+		}
+
+		// End the last line
+		if final && (col > 0) {
+			wrapped = append(wrapped, '\n')
+			col = 0
+		}
+
+		return wrapped, n, nil
+	}
+}
+
+// Reader will decode data read from the provided reader, or encode it
+// if the filter is inverse.
+func (f codecFilter) Reader(r io.Reader) io.Reader {
+	if f.inverse {
+		return &transformReader{fn: f.encoder(), r: r}
+	}
+
+	return &transformReader{fn: f.c.decode, r: r, skipSpace: true}
+}
+
+// String will return the name of the filter, with any wrap width.
+func (f codecFilter) String() string {
+	var s string = f.c.name
+
+	if f.wrap > 0 {
+		s += "=" + strconv.Itoa(f.wrap)
+	}
+
+	if f.inverse {
+		return "decode=" + s
+	}
+
+	return s
+}
+
+// Writer will encode data written to the provided writer, or decode
+// it if the filter is inverse.
+func (f codecFilter) Writer(w io.Writer) io.WriteCloser {
+	if f.inverse {
+		return &transformWriter{fn: f.c.decode, skipSpace: true, w: w}
+	}
+
+	return &transformWriter{fn: f.encoder(), w: w}
+}
+
+// transformReader is an io.Reader that applies a transform to the
+// data read from the underlying reader, keeping any partial input
+// for the next Read().
+type transformReader struct {
+	eof       bool
+	fn        transform
+	in        []byte
+	out       []byte
+	r         io.Reader
+	skipSpace bool
+}
+
+// Read will read and transform data from the underlying reader.
+func (t *transformReader) Read(p []byte) (int, error) {
+	var buf []byte
+	var e error
+	var n int
+	var used int
+
+	for len(t.out) == 0 {
+		if t.eof {
+			return 0, io.EOF
+		}
+
+		buf = make([]byte, len(p))
+
+		n, e = t.r.Read(buf)
+		if e == io.EOF { //nolint:errorlint // Never wrapped
+			t.eof = true
+		} else if e != nil {
+			return 0, e //nolint:wrapcheck // Not external to repo
+		}
+
+		t.in = appendInput(t.in, buf[:n], t.skipSpace)
+
+		if t.out, used, e = t.fn(t.in, t.eof); e != nil {
+			return 0, e
+		}
+
+		t.in = t.in[used:]
+	}
+
+	n = copy(p, t.out)
+	t.out = t.out[n:]
+
+	return n, nil
+}
+
+// transformWriter is an io.WriteCloser that applies a transform to
+// the data written to it, keeping any partial input for the next
+// Write(). Close must be called to flush any partial input.
+type transformWriter struct {
+	fn        transform
+	in        []byte
+	skipSpace bool
+	w         io.Writer
+}
+
+// Close will transform and write any partial input. It does not
+// close the underlying writer.
+func (t *transformWriter) Close() error {
+	var e error
+	var out []byte
+
+	if out, _, e = t.fn(t.in, true); e != nil {
+		return e
+	}
+
+	t.in = nil
+
+	if len(out) > 0 {
+		_, e = t.w.Write(out)
+	}
+
+	return e //nolint:wrapcheck // Not external to repo
+}
+
+// Write will transform and write the provided data.
+func (t *transformWriter) Write(p []byte) (int, error) {
+	var e error
+	var out []byte
+	var used int
+
+	t.in = appendInput(t.in, p, t.skipSpace)
+
+	if out, used, e = t.fn(t.in, false); e != nil {
+		return 0, e
+	}
+
+	t.in = t.in[used:]
+
+	if len(out) > 0 {
+		if _, e = t.w.Write(out); e != nil {
+			return 0, e //nolint:wrapcheck // Not external to repo
+		}
+	}
+
+	return len(p), nil
+}
+
+// appendInput will append the provided data to the input buffer,
+// without ASCII whitespace if requested, so that text-based
+// encodings can be typed or wrapped across lines.
+func appendInput(in []byte, p []byte, skipSpace bool) []byte {
+	if !skipSpace {
+		return append(in, p...)
+	}
+
+	for _, c := range p {
+		switch c {
+		case ' ', '\n', '\r', '\t':
+		default:
+			in = append(in, c)
+		}
+	}
+
+	return in
+}
+
+func base64Decode(enc *base64.Encoding) transform {
+	return func(src []byte, final bool) ([]byte, int, error) {
+		var e error
+		var n int = len(src) - len(src)%4
+		var out []byte
+
+		if out, e = enc.AppendDecode(nil, src[:n]); e != nil {
+			return nil, 0, errors.Newf("failed to decode: %w", e)
+		}
+
+		// Allow unpadded input at the end of the stream
+		if final && (n < len(src)) {
+			out, e = enc.WithPadding(base64.NoPadding).AppendDecode(
+				out,
+				src[n:],
+			)
+			if e != nil {
+				return nil, 0, errors.Newf("failed to decode: %w", e)
+			}
+
+			n = len(src)
+		}
+
+		return out, n, nil
+	}
+}
+
+func base64Encode(enc *base64.Encoding) transform {
+	return func(src []byte, final bool) ([]byte, int, error) {
+		var n int = len(src)
+
+		// Only pad at the end of the stream
+		if !final {
+			n -= n % 3
+		}
+
+		return enc.AppendEncode(nil, src[:n]), n, nil
+	}
+}
+
+func hexDecode(src []byte, final bool) ([]byte, int, error) {
+	var e error
+	var n int = len(src) &^ 1
+	var out []byte
+
+	if final && (n < len(src)) {
+		return nil, 0, errors.New("failed to decode: odd length hex")
+	}
+
+	if out, e = hex.AppendDecode(nil, src[:n]); e != nil {
+		return nil, 0, errors.Newf("failed to decode: %w", e)
+	}
+
+	return out, n, nil
+}
+
+func hexEncode(src []byte, _ bool) ([]byte, int, error) {
+	return hex.AppendEncode(nil, src), len(src), nil
+}
+
+// urlDecode will decode percent-encoded data, with + as a space.
+func urlDecode(src []byte, final bool) ([]byte, int, error) {
+	var b []byte
+	var e error
+	var i int
+	var out []byte = make([]byte, 0, len(src))
+
+	for i < len(src) {
+		switch src[i] {
+		case '%':
+			if i+3 > len(src) {
+				if !final {
+					return out, i, nil
+				}
+
+				e = errors.New("failed to decode: truncated escape")
+
+				return nil, 0, e
+			}
+
+			b, e = hex.AppendDecode(b[:0], src[i+1:i+3])
+			if e != nil {
+				return nil, 0, errors.Newf("failed to decode: %w", e)
+			}
+
+			out = append(out, b...)
+			i += 3
+		case '+':
+			out = append(out, ' ')
+			i++
+		default:
+			out = append(out, src[i])
+			i++
+		}
+	}
+
+	return out, i, nil
+}
+
+// urlEncode will percent-encode everything except unreserved
+// characters (RFC 3986).
+func urlEncode(src []byte, _ bool) ([]byte, int, error) {
+	var out []byte = make([]byte, 0, len(src))
+
+	for _, c := range src {
+		switch {
+		case (c >= 'A') && (c <= 'Z'), (c >= 'a') && (c <= 'z'),
+			(c >= '0') && (c <= '9'),
+			c == '-', c == '.', c == '_', c == '~':
+			out = append(out, c)
+		default:
+			out = append(out, '%', upperHex[c>>4], upperHex[c&0xf])
+		}
+	}
+
+	return out, len(src), nil
+}
@@ -0,0 +1,212 @@
+package nutsak
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mjwhitta/errors"
+)
+
+// connLimits control how many connections a listener will hold open,
+// and how quickly it will accept new ones.
+type connLimits struct {
+	interval time.Duration
+	lock     *sync.Mutex
+	maxConns int
+	maxPerIP int
+	next     time.Time
+	perIP    map[string]int
+	slots    chan struct{}
+}
+
+func newConnLimits() *connLimits {
+	return &connLimits{lock: &sync.Mutex{}}
+}
+
+// admit will check the provided connection against the per-IP limit.
+// The slots are those that wait() took a slot from for it. If it is
+// admitted, the returned function must be called once the connection
+// closes. Otherwise, its slot is freed immediately. Both belong to
+// the listener that accepted it, so a connection that outlives a
+// reset() can't free the slots of the next listener.
+func (l *connLimits) admit(
+	c net.Conn,
+	slots chan struct{},
+) (func(), bool) {
+	var host string
+	var once sync.Once
+	var perIP map[string]int
+
+	host, _, _ = net.SplitHostPort(c.RemoteAddr().String())
+
+	l.lock.Lock()
+
+	perIP = l.perIP
+
+	if (l.maxPerIP > 0) && (perIP[host] >= l.maxPerIP) {
+		l.lock.Unlock()
+		l.free(slots)
+
+		return nil, false
+	}
+
+	perIP[host]++
+
+	l.lock.Unlock()
+
+	return func() {
+		once.Do(
+			func() {
+				l.lock.Lock()
+
+				if perIP[host]--; perIP[host] <= 0 {
+					delete(perIP, host)
+				}
+
+				l.lock.Unlock()
+				l.free(slots)
+			},
+		)
+	}, true
+}
+
+// free will give back a slot taken by wait(). It must not be called
+// with the lock held, as it could block until a slot is taken.
+func (l *connLimits) free(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
+
+// pace will block until the accept rate allows the connection that
+// was just accepted to be handled. The provided function is called
+// if the connection had to wait.
+func (l *connLimits) pace(throttled func()) {
+	var d time.Duration
+	var now time.Time
+
+	if l.interval <= 0 {
+		return
+	}
+
+	l.lock.Lock()
+
+	now = time.Now()
+
+	if l.next.Before(now) {
+		l.next = now
+	}
+
+	d = l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+
+	l.lock.Unlock()
+
+	if d > 0 {
+		throttled()
+		time.Sleep(d)
+	}
+}
+
+// parse will parse the provided option, if it is a connection limit.
+// It returns whether or not the option was consumed. Connection
+// limits are not consumed for clients.
+func (l *connLimits) parse(
+	k string,
+	v string,
+	server bool,
+) (bool, error) {
+	var count string
+	var d time.Duration
+	var e error
+	var n int
+	var per string
+
+	if !server {
+		return false, nil
+	}
+
+	switch k {
+	case "accept-rate":
+		count, per, _ = strings.Cut(v, "/")
+
+		if n, e = strconv.Atoi(count); e != nil {
+			return true, errors.Newf("invalid %s %s: %w", k, v, e)
+		} else if (n <= 0) || (per == "") {
+			return true, errors.Newf("invalid %s %s", k, v)
+		}
+
+		// Allow bare units, such as 10/s
+		if (per[0] < '0') || (per[0] > '9') {
+			per = "1" + per
+		}
+
+		if d, e = time.ParseDuration(per); e != nil {
+			return true, errors.Newf("invalid %s %s: %w", k, v, e)
+		} else if d <= 0 {
+			return true, errors.Newf("invalid %s %s", k, v)
+		}
+
+		l.interval = d / time.Duration(n)
+	case "max-conns", "max-conns-per-ip":
+		if n, e = strconv.Atoi(v); e != nil {
+			return true, errors.Newf("invalid %s %s: %w", k, v, e)
+		} else if n <= 0 {
+			return true, errors.Newf("invalid %s %s", k, v)
+		}
+
+		if k == "max-conns" {
+			l.maxConns = n
+		} else {
+			l.maxPerIP = n
+		}
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// reset will clear any connection state, so that a new listener
+// starts with no connections.
+func (l *connLimits) reset() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.next = time.Time{}
+	l.perIP = map[string]int{}
+	l.slots = nil
+
+	if l.maxConns > 0 {
+		l.slots = make(chan struct{}, l.maxConns)
+	}
+}
+
+// wait will block until the listener has a free slot for another
+// connection, and return the slots it was taken from (nil if there is
+// no limit). The provided function is called before any pause, so
+// that throttling can be counted while it happens.
+func (l *connLimits) wait(throttled func()) chan struct{} {
+	var slots chan struct{}
+
+	l.lock.Lock()
+	slots = l.slots
+	l.lock.Unlock()
+
+	if slots == nil {
+		return nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+	default:
+		// Leave new connections in the backlog until one closes
+		throttled()
+		slots <- struct{}{}
+	}
+
+	return slots
+}
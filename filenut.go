@@ -21,6 +21,7 @@ type FileNUt struct {
 func NewFileNUt(seed string) (NUt, error) {
 	var e error
 	var nut *FileNUt = &FileNUt{}
+	var ok bool
 
 	// Inherit
 	nut.baseNUt = super(seed)
@@ -46,8 +47,12 @@ func NewFileNUt(seed string) (NUt, error) {
 				return nil, e
 			}
 		default:
-			e = errors.Newf("unknown %s option %s", nut.Type(), k)
-			return nil, e
+			if ok, e = nut.parseLimit(k, v); e != nil {
+				return nil, e
+			} else if !ok {
+				e = errors.Newf("unknown %s option %s", nut.Type(), k)
+				return nil, e
+			}
 		}
 	}
 
@@ -65,11 +70,11 @@ func (nut *FileNUt) Down() error {
 	defer nut.lock.Unlock()
 
 	// Check if already down
-	if !nut.up {
+	if !nut.up.Load() {
 		return nil
 	}
 
-	nut.up = false
+	nut.up.Store(false)
 
 	// Close file
 	if nut.file != nil {
@@ -87,7 +92,7 @@ func (nut *FileNUt) Down() error {
 func (nut *FileNUt) KeepAlive() bool {
 	switch nut.mode {
 	case "append", "write":
-		return nut.up
+		return nut.up.Load()
 	}
 
 	return false
@@ -100,7 +105,7 @@ func (nut *FileNUt) Read(p []byte) (int, error) {
 	var e error
 	var n int
 
-	if !nut.up {
+	if !nut.up.Load() {
 		logSubInfo(2, "%s read: not up", nut.String())
 	}
 
@@ -108,7 +113,7 @@ func (nut *FileNUt) Read(p []byte) (int, error) {
 		logSubInfo(2, "%s read: file not open", nut.String())
 	}
 
-	if !nut.up || (nut.file == nil) {
+	if !nut.up.Load() || (nut.file == nil) {
 		return 0, io.EOF
 	}
 
@@ -121,13 +126,20 @@ func (nut *FileNUt) Read(p []byte) (int, error) {
 	n, e = nut.file.Read(p)
 	logSubInfo(2, "%s read: %d bytes", nut.String(), n)
 
-	if !nut.up {
+	if !nut.up.Load() {
 		e = nil
 	}
 
 	return n, e
 }
 
+// shared will return whether or not fork sessions must share the
+// network utility. In the case of file, opening it once per session
+// would truncate it (or read it again) for every client.
+func (nut *FileNUt) shared() bool {
+	return true
+}
+
 // Up will start the network utility. In the case of file, it will
 // open the file with the specified mode.
 func (nut *FileNUt) Up() error {
@@ -137,7 +149,7 @@ func (nut *FileNUt) Up() error {
 	defer nut.lock.Unlock()
 
 	// Check if already up
-	if nut.up {
+	if nut.up.Load() {
 		return nil
 	}
 
@@ -161,7 +173,7 @@ func (nut *FileNUt) Up() error {
 		return errors.Newf("failed to open file: %w", e)
 	}
 
-	nut.up = true
+	nut.up.Store(true)
 	logGood(1, "opened %s to %s", nut.addr, nut.mode)
 
 	return nil
@@ -174,7 +186,7 @@ func (nut *FileNUt) Write(p []byte) (int, error) {
 	var e error
 	var n int
 
-	if !nut.up {
+	if !nut.up.Load() {
 		logSubInfo(2, "%s write: not up", nut.String())
 	}
 
@@ -182,7 +194,7 @@ func (nut *FileNUt) Write(p []byte) (int, error) {
 		logSubInfo(2, "%s write: file not open", nut.String())
 	}
 
-	if !nut.up || (nut.file == nil) {
+	if !nut.up.Load() || (nut.file == nil) {
 		return 0, io.EOF
 	}
 
@@ -194,7 +206,7 @@ func (nut *FileNUt) Write(p []byte) (int, error) {
 	n, e = nut.file.Write(p)
 	logSubInfo(2, "%s write: %d bytes", nut.String(), n)
 
-	if !nut.up {
+	if !nut.up.Load() {
 		e = nil
 	}
 
@@ -0,0 +1,193 @@
+package nutsak
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/mjwhitta/errors"
+)
+
+// Filter is a transform that can be stacked on any NUt. Each time the
+// NUt comes up, Reader wraps the data read from it and Writer wraps
+// the data written to it, so a Filter must not share state between
+// the readers and writers it returns.
+type Filter interface {
+	// Reader will undo the transform on data read from the NUt
+	Reader(r io.Reader) io.Reader
+
+	// String will return the name of the filter, with any argument,
+	// as it would appear in a seed
+	String() string
+
+	// Writer will apply the transform to data written to the NUt.
+	// Close is called before the NUt goes down, so that any trailer
+	// can be written.
+	Writer(w io.Writer) io.WriteCloser
+}
+
+// FilterFunc will return a new Filter from the provided
+// argument, which is empty if the filter was given without one.
+type FilterFunc func(arg string) (Filter, error)
+
+var (
+	filterLock   *sync.RWMutex         = &sync.RWMutex{}
+	filterLookup map[string]FilterFunc = map[string]FilterFunc{
+		"base64":    codecFilterFunc("base64"),
+		"base64url": codecFilterFunc("base64url"),
+		"decode":    newDecodeFilter,
+		"encode":    newEncodeFilter,
+		"gzip":      newGzipFilter,
+		"hex":       codecFilterFunc("hex"),
+		"record":    newRecordFilter,
+		"trace":     newTraceFilter,
+		"urlencode": codecFilterFunc("urlencode"),
+	}
+)
+
+// RegisterFilter will make a custom Filter available to seeds under
+// the provided name.
+func RegisterFilter(name string, construct FilterFunc) error {
+	filterLock.Lock()
+	defer filterLock.Unlock()
+
+	name = strings.ToLower(name)
+
+	if (name == "") || strings.ContainsAny(name, ",:=|") {
+		return errors.Newf("invalid filter name %s", name)
+	}
+
+	if _, ok := filterLookup[name]; ok {
+		return errors.Newf("filter %s already registered", name)
+	}
+
+	filterLookup[name] = construct
+
+	return nil
+}
+
+// isFilter will return whether or not the provided spec names a
+// registered filter.
+func isFilter(spec string) bool {
+	var name string
+
+	name, _, _ = strings.Cut(spec, "=")
+
+	filterLock.RLock()
+	defer filterLock.RUnlock()
+
+	_, ok := filterLookup[strings.ToLower(name)]
+
+	return ok
+}
+
+// newFilter will return a new Filter from the provided spec, of the
+// form NAME[=ARG].
+func newFilter(spec string) (Filter, error) {
+	var arg string
+	var construct FilterFunc
+	var name string
+	var ok bool
+
+	name, arg, _ = strings.Cut(spec, "=")
+	name = strings.ToLower(name)
+
+	filterLock.RLock()
+	construct, ok = filterLookup[name]
+	filterLock.RUnlock()
+
+	if !ok {
+		return nil, errors.Newf("unknown filter %s", name)
+	}
+
+	return construct(arg)
+}
+
+// nopWriteCloser is an io.Writer with a Close() that does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing.
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// gzipFilter compresses data written to the NUt, and decompresses
+// data read from it. Each write is flushed, so that interactive
+// streams are not held up waiting for a full block.
+type gzipFilter struct{}
+
+func newGzipFilter(arg string) (Filter, error) {
+	if arg != "" {
+		return nil, errors.Newf("unknown gzip argument %s", arg)
+	}
+
+	return gzipFilter{}, nil
+}
+
+// Reader will decompress data read from the provided reader. The
+// gzip header is not read until the first Read(), so that creating
+// the reader never blocks.
+func (gzipFilter) Reader(r io.Reader) io.Reader {
+	return &gzipReader{r: r}
+}
+
+// String will return the name of the filter.
+func (gzipFilter) String() string {
+	return "gzip"
+}
+
+// Writer will compress data written to the provided writer.
+func (gzipFilter) Writer(w io.Writer) io.WriteCloser {
+	return &gzipWriter{Writer: gzip.NewWriter(w)}
+}
+
+type gzipReader struct {
+	gz *gzip.Reader
+	r  io.Reader
+}
+
+// Read will decompress data from the underlying reader.
+func (r *gzipReader) Read(p []byte) (int, error) {
+	var e error
+
+	if r.gz == nil {
+		if r.gz, e = gzip.NewReader(r.r); e != nil {
+			return 0, e //nolint:wrapcheck // Could be io.EOF
+		}
+	}
+
+	return r.gz.Read(p) //nolint:wrapcheck // Could be io.EOF
+}
+
+type gzipWriter struct {
+	*gzip.Writer
+
+	wrote bool
+}
+
+// Close will write the gzip trailer, unless nothing was written, in
+// which case there is no stream to end.
+func (w *gzipWriter) Close() error {
+	if !w.wrote {
+		return nil
+	}
+
+	return w.Writer.Close() //nolint:wrapcheck // Not external to repo
+}
+
+// Write will compress and flush the provided data.
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	var e error
+	var n int
+
+	w.wrote = true
+
+	if n, e = w.Writer.Write(p); e != nil {
+		return n, e //nolint:wrapcheck // Not external to repo
+	}
+
+	return n, w.Flush() //nolint:wrapcheck // Not external to repo
+}
@@ -0,0 +1,481 @@
+package nutsak
+
+import (
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mjwhitta/errors"
+)
+
+// FilteredNUt is a wrapper around any network utility that passes
+// everything read or written through a stack of Filters. Filters are
+// listed from the far side of a Pair inward, so the last filter is
+// closest to the wrapped NUt.
+type FilteredNUt struct {
+	NUt
+
+	client   uint64
+	filters  []Filter
+	in       <-chan NUt
+	lock     *sync.Mutex
+	r        io.Reader
+	seed     string
+	sessions <-chan NUt
+	stash    []byte
+	stashed  uint64
+	w        io.Writer
+	wlock    *sync.Mutex
+	writers  []io.WriteCloser
+}
+
+// clientReader is the innermost reader of the filters, when the
+// underlying NUt is a listener without fork. It ends the filters once
+// the listener moves on to its next client, so that nothing left over
+// from one client is applied to the next.
+type clientReader struct {
+	client uint64
+	nut    *FilteredNUt
+}
+
+// NewFilteredNUt will return a pointer to a filtered network utility
+// instance with the provided seed. Filters can prefix the seed (for
+// example hex|gzip|tcp:host:80), or be given as a colon-separated
+// filter option (for example tcp:host:80,filter=hex:gzip). The encode
+// and decode options add a codec filter, which can be line-wrapped
+// with the wrap option (for example tcp:host:80,encode=base64).
+func NewFilteredNUt(seed string) (NUt, error) {
+	var coded []int
+	var e error
+	var f Filter
+	var kept []string
+	var nut *FilteredNUt = &FilteredNUt{
+		lock:  &sync.Mutex{},
+		seed:  seed,
+		wlock: &sync.Mutex{},
+	}
+	var opts []string
+	var seen map[string]bool = map[string]bool{}
+	var specs []string
+	var wrap string
+
+	// Prefix filters are separated by |
+	for {
+		spec, rest, ok := strings.Cut(seed, "|")
+		if !ok || !isFilter(spec) {
+			break
+		}
+
+		specs = append(specs, spec)
+		seed = rest
+	}
+
+	// Filter options come after any prefix filters, in seed order
+	opts = strings.Split(seed, ",")
+	kept = []string{opts[0]}
+
+	for _, opt := range opts[1:] {
+		k, v, _ := strings.Cut(opt, "=")
+
+		if k = strings.ToLower(k); !isFilterOption(k) {
+			kept = append(kept, opt)
+			continue
+		}
+
+		if seen[k] {
+			return nil, errors.Newf("%s option provided twice", k)
+		} else if v == "" {
+			return nil, errors.Newf("invalid %s %s", k, v)
+		}
+
+		seen[k] = true
+
+		switch k {
+		case "decode", "encode":
+			coded = append(coded, len(specs))
+			specs = append(specs, k+"="+v)
+		case "filter":
+			specs = append(specs, strings.Split(v, ":")...)
+		case "wrap":
+			wrap = v
+		}
+	}
+
+	if wrap != "" {
+		if len(coded) == 0 {
+			return nil, errors.New("wrap needs encode or decode")
+		}
+
+		for _, i := range coded {
+			specs[i] += "=" + wrap
+		}
+	}
+
+	if len(specs) == 0 {
+		return nil, errors.Newf("no filters in %s", seed)
+	}
+
+	for _, spec := range specs {
+		if f, e = newFilter(spec); e != nil {
+			return nil, e
+		}
+
+		nut.filters = append(nut.filters, f)
+	}
+
+	if nut.NUt, e = NewNUt(strings.Join(kept, ",")); e != nil {
+		return nil, e
+	}
+
+	return nut, nil
+}
+
+// hasFilter will return whether or not the provided seed has prefix
+// filters or filter options.
+func hasFilter(seed string) bool {
+	var opts []string = strings.Split(seed, ",")
+
+	if spec, _, ok := strings.Cut(seed, "|"); ok && isFilter(spec) {
+		return true
+	}
+
+	for _, opt := range opts[1:] {
+		k, _, _ := strings.Cut(opt, "=")
+		if isFilterOption(strings.ToLower(k)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isFilterOption will return whether or not the provided option key
+// is handled by FilteredNUt, rather than the wrapped NUt.
+func isFilterOption(k string) bool {
+	switch k {
+	case "decode", "encode", "filter", "wrap":
+		return true
+	}
+
+	return false
+}
+
+// Read will read from the underlying NUt, until the listener has a
+// new client. Anything already read from the new client is kept for
+// its own filters.
+func (r *clientReader) Read(p []byte) (int, error) {
+	var c uint64
+	var e error
+	var n int
+
+	r.nut.lock.Lock()
+
+	if (r.nut.stashed == r.client) && (len(r.nut.stash) > 0) {
+		n = copy(p, r.nut.stash)
+		r.nut.stash = r.nut.stash[n:]
+	}
+
+	r.nut.lock.Unlock()
+
+	if n > 0 {
+		return n, nil
+	} else if clientsOf(r.nut.NUt) != r.client {
+		return 0, io.EOF
+	}
+
+	n, e = r.nut.NUt.Read(p)
+
+	if c = clientsOf(r.nut.NUt); (n > 0) && (c != r.client) {
+		r.nut.lock.Lock()
+
+		if r.nut.stashed != c {
+			r.nut.stash = nil
+			r.nut.stashed = c
+		}
+
+		r.nut.stash = append(r.nut.stash, p[:n]...)
+		r.nut.lock.Unlock()
+
+		return 0, io.EOF
+	}
+
+	return n, e //nolint:wrapcheck // Could be io.EOF
+}
+
+// Close is an alias for Down().
+func (nut *FilteredNUt) Close() error {
+	return nut.Down()
+}
+
+// Down will close the filter writers, so that any trailers are sent,
+// and then bring down the underlying NUt.
+func (nut *FilteredNUt) Down() error {
+	var done chan struct{} = make(chan struct{})
+	var writers []io.WriteCloser
+
+	nut.lock.Lock()
+	writers = nut.writers
+	nut.r = nil
+	nut.w = nil
+	nut.writers = nil
+	nut.lock.Unlock()
+
+	go func() {
+		// Wait for any write still passing through the filters
+		nut.wlock.Lock()
+		defer nut.wlock.Unlock()
+
+		// Outermost first, so trailers pass through inner filters
+		for _, w := range writers {
+			_ = w.Close()
+		}
+
+		close(done)
+	}()
+
+	// Don't hang if the underlying NUt can no longer be written to
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+
+	return nut.NUt.Down() //nolint:wrapcheck // Not external to repo
+}
+
+// endpoints will return the addresses of the underlying NUt, if
+// known.
+func (nut *FilteredNUt) endpoints() (net.Addr, net.Addr) {
+	if ep, ok := nut.NUt.(endpointer); ok {
+		return ep.endpoints()
+	}
+
+	return nil, nil
+}
+
+// limits will return the limits of the underlying NUt, if any.
+func (nut *FilteredNUt) limits() (time.Duration, time.Duration) {
+	if l, ok := nut.NUt.(limiter); ok {
+		return l.limits()
+	}
+
+	return 0, 0
+}
+
+// Open is an alias for Up().
+func (nut *FilteredNUt) Open() error {
+	return nut.Up()
+}
+
+// origin will return the seed the filtered NUt was created from,
+// filters included.
+func (nut *FilteredNUt) origin() string {
+	return nut.seed
+}
+
+// Read will read from the underlying NUt, through the filters.
+func (nut *FilteredNUt) Read(p []byte) (int, error) {
+	var client uint64
+	var e error
+	var n int
+	var r io.Reader
+
+	for {
+		nut.lock.Lock()
+		nut.restack()
+		client = nut.client
+		r = nut.r
+		nut.lock.Unlock()
+
+		if r == nil {
+			return 0, io.EOF
+		}
+
+		n, e = r.Read(p)
+
+		// The filters of the previous client are done, so start over
+		if (n == 0) && (e != nil) && (clientsOf(nut.NUt) != client) {
+			continue
+		}
+
+		return n, e //nolint:wrapcheck // Could be io.EOF
+	}
+}
+
+// Reload will reload the underlying NUt, if supported.
+func (nut *FilteredNUt) Reload() error {
+	if r, ok := nut.NUt.(Reloader); ok {
+		return r.Reload() //nolint:wrapcheck // Not external to repo
+	}
+
+	return nil
+}
+
+// restack will stack fresh filters, if the underlying listener has
+// moved on to a new client since they were stacked. The old writers
+// are dropped without being closed, so their trailers don't reach the
+// new client. The caller must hold the lock.
+func (nut *FilteredNUt) restack() {
+	if (nut.r != nil) && (clientsOf(nut.NUt) != nut.client) {
+		nut.stack()
+	}
+}
+
+// Sessions will return the sessions of the underlying NUt, if it is
+// forking, with each session wrapped in the same filters.
+func (nut *FilteredNUt) Sessions() <-chan NUt {
+	var f Forker
+	var in <-chan NUt
+	var ok bool
+	var out chan NUt
+
+	if f, ok = nut.NUt.(Forker); !ok {
+		return nil
+	}
+
+	nut.lock.Lock()
+	defer nut.lock.Unlock()
+
+	if in = f.Sessions(); in == nil {
+		return nil
+	} else if !nut.NUt.IsUp() {
+		// Nothing to forward until the underlying NUt is up
+		if nut.sessions == nil {
+			nut.sessions = make(chan NUt)
+		}
+
+		return nut.sessions
+	} else if in == nut.in {
+		return nut.sessions
+	}
+
+	// The underlying NUt creates a new channel each time it comes up
+
+	out = make(chan NUt)
+	nut.in = in
+	nut.sessions = out
+
+	go func() {
+		defer close(out)
+
+		for session := range in {
+			out <- &FilteredNUt{
+				NUt:     session,
+				filters: nut.filters,
+				lock:    &sync.Mutex{},
+				wlock:   &sync.Mutex{},
+			}
+		}
+	}()
+
+	return out
+}
+
+// shared will return whether or not fork sessions must share the
+// underlying NUt.
+func (nut *FilteredNUt) shared() bool {
+	return isShared(nut.NUt)
+}
+
+// split will split the underlying NUt into sessions, if supported.
+func (nut *FilteredNUt) split() bool {
+	if s, ok := nut.NUt.(splitter); ok {
+		return s.split()
+	}
+
+	return false
+}
+
+// Stats will return the counters of the underlying NUt, if any.
+func (nut *FilteredNUt) Stats() map[string]uint64 {
+	if s, ok := nut.NUt.(StatsReporter); ok {
+		return s.Stats()
+	}
+
+	return map[string]uint64{}
+}
+
+// String will return a string representation of the FilteredNUt.
+func (nut *FilteredNUt) String() string {
+	var sb strings.Builder
+
+	for _, f := range nut.filters {
+		sb.WriteString(f.String() + "|")
+	}
+
+	return sb.String() + nut.NUt.String()
+}
+
+// stack will stack fresh filters on top of the underlying NUt. The
+// caller must hold the lock.
+func (nut *FilteredNUt) stack() {
+	var r io.Reader = nut.NUt
+	var w io.Writer = nut.NUt
+	var wc io.WriteCloser
+	var writers []io.WriteCloser
+
+	nut.client = clientsOf(nut.NUt)
+
+	if _, ok := nut.NUt.(clienter); ok {
+		r = &clientReader{client: nut.client, nut: nut}
+	}
+
+	// Innermost (last) filter wraps the NUt directly
+	for i := len(nut.filters) - 1; i >= 0; i-- {
+		r = nut.filters[i].Reader(r)
+		wc = nut.filters[i].Writer(w)
+		w = wc
+		writers = append([]io.WriteCloser{wc}, writers...)
+	}
+
+	nut.r = r
+	nut.w = w
+	nut.writers = writers
+}
+
+// Up will bring up the underlying NUt, and then stack fresh filters
+// on top of it. A listener without fork gets fresh filters for each
+// of its clients as well.
+func (nut *FilteredNUt) Up() error {
+	var built bool
+
+	nut.lock.Lock()
+	built = nut.r != nil
+	nut.lock.Unlock()
+
+	// Keep the current filters, so streams aren't cut off mid-way
+	if built && nut.NUt.IsUp() {
+		return nil
+	}
+
+	if e := nut.NUt.Up(); e != nil {
+		return e //nolint:wrapcheck // Not external to repo
+	}
+
+	nut.lock.Lock()
+	nut.stack()
+	nut.lock.Unlock()
+
+	return nil
+}
+
+// Write will write to the underlying NUt, through the filters.
+func (nut *FilteredNUt) Write(p []byte) (int, error) {
+	var w io.Writer
+
+	// Down waits for the write, before closing the writers
+	nut.wlock.Lock()
+	defer nut.wlock.Unlock()
+
+	nut.lock.Lock()
+	nut.restack()
+	w = nut.w
+	nut.lock.Unlock()
+
+	if w == nil {
+		return 0, errors.New("not up")
+	}
+
+	return w.Write(p) //nolint:wrapcheck // Not external to repo
+}
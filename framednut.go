@@ -0,0 +1,297 @@
+package nutsak
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mjwhitta/errors"
+)
+
+// FramedNUt is a wrapper around a stream network utility (such as TCP
+// or TLS) that length-prefixes each datagram, so that message
+// boundaries survive the stream.
+type FramedNUt struct {
+	NUt
+
+	buf      []byte
+	frame    string
+	in       <-chan NUt
+	lock     *sync.Mutex
+	rest     []byte
+	seed     string
+	sessions chan NUt
+	size     int
+}
+
+// NewFramedNUt will return a pointer to a framed network utility
+// instance with the provided seed. The seed must include a frame
+// option, which is removed before creating the wrapped NUt.
+func NewFramedNUt(seed string) (NUt, error) {
+	var e error
+	var nut *FramedNUt = &FramedNUt{
+		lock: &sync.Mutex{},
+		seed: seed,
+	}
+	var opts []string = strings.Split(seed, ",")
+
+	for i := len(opts) - 1; i > 0; i-- {
+		k, v, _ := strings.Cut(opts[i], "=")
+		if strings.ToLower(k) != "frame" {
+			continue
+		}
+
+		if nut.frame != "" {
+			return nil, errors.New("frame option provided twice")
+		}
+
+		nut.frame = strings.ToLower(v)
+		opts = append(opts[:i], opts[i+1:]...)
+	}
+
+	switch nut.frame {
+	case "len16":
+		nut.size = 2 //nolint:mnd // 16 bits
+	case "len32":
+		nut.size = 4 //nolint:mnd // 32 bits
+	default:
+		return nil, errors.Newf("unknown frame %s", nut.frame)
+	}
+
+	if nut.NUt, e = NewNUt(strings.Join(opts, ",")); e != nil {
+		return nil, e
+	}
+
+	if _, ok := nut.NUt.(PacketNUt); ok {
+		e = errors.Newf("%s does not support framing", nut.Type())
+		return nil, e
+	}
+
+	return nut, nil
+}
+
+// hasFrame will return whether or not the provided seed has a frame
+// option.
+func hasFrame(seed string) bool {
+	var opts []string = strings.Split(seed, ",")
+
+	for _, opt := range opts[1:] {
+		k, _, _ := strings.Cut(opt, "=")
+		if strings.ToLower(k) == "frame" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Read will read datagrams from the underlying stream. A datagram
+// larger than the provided buffer (such as the buffer of io.Copy) is
+// returned over several reads, rather than being lost.
+func (nut *FramedNUt) Read(p []byte) (int, error) {
+	var e error
+	var n int
+
+	if len(nut.rest) == 0 {
+		if nut.buf == nil {
+			nut.buf = make([]byte, maxDatagram)
+		}
+
+		if n, _, e = nut.ReadPacket(nut.buf); e != nil {
+			return 0, e
+		}
+
+		nut.rest = nut.buf[:n]
+	}
+
+	n = copy(p, nut.rest)
+	nut.rest = nut.rest[n:]
+
+	return n, nil
+}
+
+// ReadPacket will read a single length-prefixed datagram from the
+// underlying stream. Streams have no addresses, so the source is
+// always nil.
+func (nut *FramedNUt) ReadPacket(p []byte) (int, net.Addr, error) {
+	var b []byte = make([]byte, nut.size)
+	var e error
+	var n int
+
+	if _, e = io.ReadFull(nut.NUt, b); e != nil {
+		return 0, nil, e //nolint:wrapcheck // Could be io.EOF
+	}
+
+	switch nut.size {
+	case 2: //nolint:mnd // 16 bits
+		n = int(binary.BigEndian.Uint16(b))
+	case 4: //nolint:mnd // 32 bits
+		n = int(binary.BigEndian.Uint32(b))
+	}
+
+	// No datagram is this large, so the stream can't be trusted
+	if n > maxDatagram {
+		return 0, nil, errors.Newf("invalid frame of %d bytes", n)
+	}
+
+	if n > len(p) {
+		// Skip frame to stay in sync with the stream
+		_, _ = io.CopyN(io.Discard, nut.NUt, int64(n))
+
+		e = errors.Newf("frame of %d bytes is too large", n)
+
+		return 0, nil, e
+	}
+
+	if _, e = io.ReadFull(nut.NUt, p[:n]); e != nil {
+		return 0, nil, errors.Newf("failed to read frame: %w", e)
+	}
+
+	return n, nil, nil
+}
+
+// clients will return how many clients the underlying NUt has served
+// without fork, if it counts them.
+func (nut *FramedNUt) clients() uint64 {
+	return clientsOf(nut.NUt)
+}
+
+// endpoints will return the addresses of the underlying NUt, if
+// known.
+func (nut *FramedNUt) endpoints() (net.Addr, net.Addr) {
+	if ep, ok := nut.NUt.(endpointer); ok {
+		return ep.endpoints()
+	}
+
+	return nil, nil
+}
+
+// limits will return the limits of the underlying NUt, if any.
+func (nut *FramedNUt) limits() (time.Duration, time.Duration) {
+	if l, ok := nut.NUt.(limiter); ok {
+		return l.limits()
+	}
+
+	return 0, 0
+}
+
+// origin will return the seed the framed NUt was created from, frame
+// option included.
+func (nut *FramedNUt) origin() string {
+	return nut.seed
+}
+
+// Reload will reload the underlying NUt, if supported.
+func (nut *FramedNUt) Reload() error {
+	if r, ok := nut.NUt.(Reloader); ok {
+		return r.Reload() //nolint:wrapcheck // Not external to repo
+	}
+
+	return nil
+}
+
+// Sessions will return the sessions of the underlying NUt, each
+// framed the same way, or nil if it does not fork.
+func (nut *FramedNUt) Sessions() <-chan NUt {
+	var f Forker
+	var in <-chan NUt
+	var ok bool
+	var out chan NUt
+
+	if f, ok = nut.NUt.(Forker); !ok {
+		return nil
+	}
+
+	nut.lock.Lock()
+	defer nut.lock.Unlock()
+
+	if in = f.Sessions(); in == nil {
+		return nil
+	} else if !nut.NUt.IsUp() {
+		// Nothing to forward until the underlying NUt is up
+		if nut.sessions == nil {
+			nut.sessions = make(chan NUt)
+		}
+
+		return nut.sessions
+	} else if in == nut.in {
+		return nut.sessions
+	}
+
+	// The underlying NUt creates a new channel each time it comes up
+
+	out = make(chan NUt)
+	nut.in = in
+	nut.sessions = out
+
+	go func() {
+		defer close(out)
+
+		for session := range in {
+			out <- &FramedNUt{
+				NUt:   session,
+				frame: nut.frame,
+				lock:  &sync.Mutex{},
+				size:  nut.size,
+			}
+		}
+	}()
+
+	return out
+}
+
+// shared will return whether or not fork sessions must share the
+// underlying NUt.
+func (nut *FramedNUt) shared() bool {
+	return isShared(nut.NUt)
+}
+
+// Stats will return the counters of the underlying NUt, if any.
+func (nut *FramedNUt) Stats() map[string]uint64 {
+	if s, ok := nut.NUt.(StatsReporter); ok {
+		return s.Stats()
+	}
+
+	return map[string]uint64{}
+}
+
+// String will return a string representation of the FramedNUt.
+func (nut *FramedNUt) String() string {
+	return nut.NUt.String() + ",frame=" + nut.frame
+}
+
+// Write will write the provided data as a single datagram.
+func (nut *FramedNUt) Write(p []byte) (int, error) {
+	return nut.WritePacket(p, nil)
+}
+
+// WritePacket will write a single length-prefixed datagram to the
+// underlying stream. Streams have no addresses, so the destination
+// is ignored.
+func (nut *FramedNUt) WritePacket(p []byte, _ net.Addr) (int, error) {
+	var b []byte = make([]byte, nut.size, nut.size+len(p))
+	var e error
+
+	switch nut.size {
+	case 2: //nolint:mnd // 16 bits
+		if len(p) > 0xffff {
+			e = errors.Newf("datagram of %d bytes too large", len(p))
+			return 0, e
+		}
+
+		binary.BigEndian.PutUint16(b, uint16(len(p)))
+	case 4: //nolint:mnd // 32 bits
+		//nolint:gosec // Datagrams are never 4GB
+		binary.BigEndian.PutUint32(b, uint32(len(p)))
+	}
+
+	// Single write so frames from different goroutines never mix
+	if _, e = nut.NUt.Write(append(b, p...)); e != nil {
+		return 0, e //nolint:wrapcheck // Not external to repo
+	}
+
+	return len(p), nil
+}
@@ -1,6 +1,10 @@
 package nutsak
 
-import "github.com/mjwhitta/log"
+import (
+	"time"
+
+	"github.com/mjwhitta/log"
+)
 
 // Version is the package version.
 const Version string = "1.1.12"
@@ -9,9 +13,16 @@ const Version string = "1.1.12"
 const (
 	modeClient = iota
 	modeServer
+	modeBroadcast
+	modeMulticast
 )
 
 var (
+	// IdleTimeout will be used as the default idle timeout for every
+	// Pair. A tunnel with no traffic in either direction for this
+	// long is torn down. Zero means no timeout.
+	IdleTimeout time.Duration
+
 	// Logger will be used to log information deemed relevant to the
 	// user.
 	Logger *log.Messenger
@@ -19,4 +30,14 @@ var (
 	// LogLvl will be used to determine the amount of log messages
 	// displayed.
 	LogLvl int
+
+	// MaxDuration will be used as the default max duration for every
+	// Pair. A tunnel open for longer than this is torn down. Zero
+	// means no limit.
+	MaxDuration time.Duration
+
+	// Trace will be called with every chunk of data streamed from one
+	// NUt to another, if not nil. See Tracer for a hook that logs
+	// each chunk as text or as a hexdump.
+	Trace func(from NUt, to NUt, p []byte)
 )
@@ -0,0 +1,65 @@
+package nutsak
+
+import (
+	"os"
+
+	"github.com/mjwhitta/errors"
+)
+
+// keyLogWriter is an io.Writer that appends TLS secrets, in NSS key
+// log format, to the named file. The file is opened for each write
+// so that rotating or deleting it never breaks a running NUt.
+type keyLogWriter string
+
+// secureKeyLog will create the named key log file, if needed, and
+// restrict an existing one to the current user. The mode given when
+// creating a file doesn't apply to existing ones. A file that can't
+// be restricted (such as one owned by someone else) is only warned
+// about, so that handshakes still work.
+func secureKeyLog(fn string) {
+	var e error
+	var f *os.File
+
+	//nolint:mnd // u=rw,go=-
+	f, e = os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if e != nil {
+		logWarn(1, "failed to open %s: %s", fn, e.Error())
+		return
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if e = f.Chmod(0o600); e != nil { //nolint:mnd // u=rw,go=-
+		logWarn(1, "failed to restrict %s: %s", fn, e.Error())
+	}
+}
+
+// Write will append the provided key log line to the file.
+func (fn keyLogWriter) Write(p []byte) (int, error) {
+	var e error
+	var f *os.File
+	var n int
+
+	//nolint:mnd // u=rw,go=-
+	f, e = os.OpenFile(
+		string(fn),
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY,
+		0o600,
+	)
+	if e != nil {
+		return 0, errors.Newf("failed to open %s: %w", fn, e)
+	}
+
+	if n, e = f.Write(p); e != nil {
+		_ = f.Close()
+		return n, errors.Newf("failed to write %s: %w", fn, e)
+	}
+
+	if e = f.Close(); e != nil {
+		return n, errors.Newf("failed to close %s: %w", fn, e)
+	}
+
+	return n, nil
+}
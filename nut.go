@@ -1,7 +1,9 @@
 package nutsak
 
 import (
+	"net"
 	"strings"
+	"time"
 
 	"github.com/mjwhitta/errors"
 )
@@ -24,31 +26,183 @@ type NUt interface {
 	Write(p []byte) (n int, e error)
 }
 
+// Forker is a NUt that creates a new child NUt for each client
+// session, so that each can be paired with its own peer.
+type Forker interface {
+	NUt
+
+	// Sessions will return nil if the NUt is not forking
+	Sessions() <-chan NUt
+}
+
+// PacketNUt is a NUt that can read and write whole datagrams, along
+// with their addresses. When both NUts in a Pair are PacketNUts,
+// message boundaries are preserved.
+type PacketNUt interface {
+	ReadPacket(p []byte) (n int, src net.Addr, e error)
+	WritePacket(p []byte, dst net.Addr) (n int, e error)
+}
+
+// Reloader is a NUt that can reload its configuration (such as TLS
+// certs) without going down.
+type Reloader interface {
+	Reload() error
+}
+
+// StatsReporter is a NUt that keeps counters (such as handshakes or
+// connections).
+type StatsReporter interface {
+	Stats() map[string]uint64
+}
+
+// clienter is a listener without fork that serves one client after
+// another, so that anything kept for a client can start over with the
+// next.
+type clienter interface {
+	clients() uint64
+}
+
+// limiter is a NUt with an idle timeout or max duration, after which
+// Pair will tear down the tunnel.
+type limiter interface {
+	limits() (idle time.Duration, maxDuration time.Duration)
+}
+
 type nutConstruct func(string) (NUt, error)
 
+// seeder is a NUt that remembers the seed it was created from, so
+// that Pair can create more like it without reordering options.
+type seeder interface {
+	origin() string
+}
+
+// sharer is a NUt that fork sessions must share, rather than each
+// creating their own from the same seed.
+type sharer interface {
+	shared() bool
+}
+
+// splitter is a listener without fork that can still give each of
+// its clients their own session, which Pair asks it to do before
+// bringing it up.
+type splitter interface {
+	Forker
+
+	split() bool
+}
+
 // Verify interface compliance at compile time
 var (
 	_ NUt = (*FileNUt)(nil)
+	_ NUt = (*FilteredNUt)(nil)
+	_ NUt = (*FramedNUt)(nil)
+	_ NUt = (*ReplayNUt)(nil)
+	_ NUt = (*StartTLSNUt)(nil)
 	_ NUt = (*StdioNUt)(nil)
 	_ NUt = (*TCPNUt)(nil)
+	_ NUt = (*TLSInfoNUt)(nil)
 	_ NUt = (*TLSNUt)(nil)
 	_ NUt = (*UDPNUt)(nil)
+	_ NUt = (*sharedNUt)(nil)
+
+	_ Forker = (*FilteredNUt)(nil)
+	_ Forker = (*FramedNUt)(nil)
+	_ Forker = (*TCPNUt)(nil)
+	_ Forker = (*TLSNUt)(nil)
+	_ Forker = (*UDPNUt)(nil)
+
+	_ clienter = (*FramedNUt)(nil)
+	_ clienter = (*TCPNUt)(nil)
+	_ clienter = (*TLSNUt)(nil)
+
+	_ endpointer = (*FilteredNUt)(nil)
+	_ endpointer = (*FramedNUt)(nil)
+	_ endpointer = (*TCPNUt)(nil)
+	_ endpointer = (*TLSNUt)(nil)
+	_ endpointer = (*UDPNUt)(nil)
+	_ endpointer = (*tcpSession)(nil)
+	_ endpointer = (*udpSession)(nil)
+
+	_ limiter = (*FileNUt)(nil)
+	_ limiter = (*FilteredNUt)(nil)
+	_ limiter = (*FramedNUt)(nil)
+	_ limiter = (*ReplayNUt)(nil)
+	_ limiter = (*StdioNUt)(nil)
+	_ limiter = (*TCPNUt)(nil)
+	_ limiter = (*TLSNUt)(nil)
+	_ limiter = (*UDPNUt)(nil)
+	_ limiter = (*sharedNUt)(nil)
+	_ limiter = (*tcpSession)(nil)
+	_ limiter = (*udpSession)(nil)
+
+	_ PacketNUt = (*FramedNUt)(nil)
+	_ PacketNUt = (*UDPNUt)(nil)
+	_ PacketNUt = (*udpSession)(nil)
+
+	_ Reloader = (*FilteredNUt)(nil)
+	_ Reloader = (*FramedNUt)(nil)
+	_ Reloader = (*TLSNUt)(nil)
+
+	_ StatsReporter = (*FilteredNUt)(nil)
+	_ StatsReporter = (*FramedNUt)(nil)
+	_ StatsReporter = (*TCPNUt)(nil)
+	_ StatsReporter = (*TLSNUt)(nil)
+	_ StatsReporter = (*UDPNUt)(nil)
+
+	_ seeder = (*FileNUt)(nil)
+	_ seeder = (*FilteredNUt)(nil)
+	_ seeder = (*FramedNUt)(nil)
+	_ seeder = (*ReplayNUt)(nil)
+	_ seeder = (*StartTLSNUt)(nil)
+	_ seeder = (*StdioNUt)(nil)
+	_ seeder = (*TCPNUt)(nil)
+	_ seeder = (*TLSInfoNUt)(nil)
+	_ seeder = (*TLSNUt)(nil)
+	_ seeder = (*UDPNUt)(nil)
+
+	_ sharer = (*FileNUt)(nil)
+	_ sharer = (*FilteredNUt)(nil)
+	_ sharer = (*FramedNUt)(nil)
+	_ sharer = (*StdioNUt)(nil)
+
+	_ splitter = (*FilteredNUt)(nil)
+	_ splitter = (*UDPNUt)(nil)
 
 	nutLookup map[string]nutConstruct = map[string]nutConstruct{
-		"-":          NewStdioNUt,
-		"file":       NewFileNUt,
-		"stdin":      NewStdioNUt,
-		"stdio":      NewStdioNUt,
-		"stdout":     NewStdioNUt,
-		"tcp":        NewTCPNUt,
-		"tcp-l":      NewTCPNUt,
-		"tcp-listen": NewTCPNUt,
-		"tls":        NewTLSNUt,
-		"tls-l":      NewTLSNUt,
-		"tls-listen": NewTLSNUt,
-		"udp":        NewUDPNUt,
-		"udp-l":      NewUDPNUt,
-		"udp-listen": NewUDPNUt,
+		"-":                 NewStdioNUt,
+		"file":              NewFileNUt,
+		"replay":            NewReplayNUt,
+		"starttls-ftp":      NewStartTLSNUt,
+		"starttls-imap":     NewStartTLSNUt,
+		"starttls-postgres": NewStartTLSNUt,
+		"starttls-smtp":     NewStartTLSNUt,
+		"stdin":             NewStdioNUt,
+		"stdio":             NewStdioNUt,
+		"stdout":            NewStdioNUt,
+		"tcp":               NewTCPNUt,
+		"tcp-l":             NewTCPNUt,
+		"tcp-listen":        NewTCPNUt,
+		"tcp4":              NewTCPNUt,
+		"tcp4-l":            NewTCPNUt,
+		"tcp4-listen":       NewTCPNUt,
+		"tcp6":              NewTCPNUt,
+		"tcp6-l":            NewTCPNUt,
+		"tcp6-listen":       NewTCPNUt,
+		"tls":               NewTLSNUt,
+		"tls-info":          NewTLSInfoNUt,
+		"tls-l":             NewTLSNUt,
+		"tls-listen":        NewTLSNUt,
+		"udp":               NewUDPNUt,
+		"udp-bcast":         NewUDPNUt,
+		"udp-l":             NewUDPNUt,
+		"udp-listen":        NewUDPNUt,
+		"udp-mcast":         NewUDPNUt,
+		"udp4":              NewUDPNUt,
+		"udp4-l":            NewUDPNUt,
+		"udp4-listen":       NewUDPNUt,
+		"udp6":              NewUDPNUt,
+		"udp6-l":            NewUDPNUt,
+		"udp6-listen":       NewUDPNUt,
 	}
 )
 
@@ -59,9 +213,18 @@ func NewNUt(seed string) (NUt, error) {
 
 	theType, _, _ = strings.Cut(seed, ":")
 
+	// Filters wrap everything else, so check them first
+	if hasFilter(seed) {
+		return NewFilteredNUt(seed)
+	}
+
 	if _, ok := nutLookup[theType]; !ok {
 		return nil, errors.Newf("unsupported NUt: %s", theType)
 	}
 
+	if hasFrame(seed) {
+		return NewFramedNUt(seed)
+	}
+
 	return nutLookup[theType](seed)
 }
@@ -2,10 +2,24 @@
 package nutsak_test
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/sha512"
+	"crypto/tls"
+	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -14,6 +28,28 @@ import (
 	assert "github.com/stretchr/testify/require"
 )
 
+// acceptRemote will accept a single connection on the provided
+// listener and return its remote address.
+func acceptRemote(t *testing.T, l *net.TCPListener) string {
+	t.Helper()
+
+	var c net.Conn
+	var e error
+
+	_ = l.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if c, e = l.Accept(); e != nil {
+		assert.NoError(t, e)
+		return ""
+	}
+
+	defer func() {
+		_ = c.Close()
+	}()
+
+	return c.RemoteAddr().String()
+}
+
 func compare(t *testing.T, fn string) {
 	t.Helper()
 
@@ -29,6 +65,336 @@ func compare(t *testing.T, fn string) {
 	assert.Equal(t, expected, hex.EncodeToString(hash[:])[0:32])
 }
 
+func copyFile(t *testing.T, src string, dst string) {
+	t.Helper()
+
+	var b []byte
+	var e error
+	var future time.Time = time.Now().Add(time.Minute)
+
+	b, e = os.ReadFile(src)
+	assert.NoError(t, e)
+
+	e = os.WriteFile(dst, b, 0o600)
+	assert.NoError(t, e)
+
+	// Ensure modification time changes
+	e = os.Chtimes(dst, future, future)
+	assert.NoError(t, e)
+}
+
+func dialWithCert(t *testing.T, addr string) error {
+	t.Helper()
+
+	var c *tls.Conn
+	var cert tls.Certificate
+	var e error
+
+	cert, e = tls.LoadX509KeyPair(
+		"testdata/pki/certs/user.cert.pem",
+		"testdata/pki/private/user.key.pem",
+	)
+	assert.NoError(t, e)
+
+	c, e = tls.Dial(
+		"tcp",
+		addr,
+		&tls.Config{
+			Certificates:       []tls.Certificate{cert},
+			InsecureSkipVerify: true, //nolint:gosec // Test
+		},
+	)
+	if e != nil {
+		return e
+	}
+
+	defer func() {
+		_ = c.Close()
+	}()
+
+	// Rejections in TLS 1.3 arrive after the client handshake
+	_ = c.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+
+	if _, e = c.Read(make([]byte, 1)); os.IsTimeout(e) {
+		return nil
+	}
+
+	return e
+}
+
+func dialTwice(t *testing.T, addr string) bool {
+	t.Helper()
+
+	var c *tls.Conn
+	var cfg *tls.Config = &tls.Config{
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+		InsecureSkipVerify: true, //nolint:gosec // Test
+	}
+	var e error
+
+	for range 2 {
+		c, e = tls.Dial("tcp", addr, cfg)
+		assert.NoError(t, e)
+
+		// Session tickets arrive after the handshake in TLS 1.3
+		_ = c.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, _ = c.Read(make([]byte, 1))
+		_ = c.Close()
+	}
+
+	return c.ConnectionState().DidResume
+}
+
+// downWhileConnecting will check that Down stops a client that is
+// still retrying its first connection, and that Up then fails.
+func downWhileConnecting(t *testing.T, seed string) {
+	t.Helper()
+
+	var a sak.NUt
+	var down chan error = make(chan error, 1)
+	var e error
+	var up chan error = make(chan error, 1)
+
+	// Nothing is listening, so this retries forever
+	a, e = sak.NewNUt(seed)
+	assert.NoError(t, e)
+
+	go func() {
+		up <- a.Up()
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, a.IsUp())
+
+	go func() {
+		down <- a.Down()
+	}()
+
+	select {
+	case e = <-down:
+		assert.NoError(t, e)
+	case <-time.After(time.Second):
+		assert.Fail(t, "down blocked while connecting")
+	}
+
+	select {
+	case e = <-up:
+		assert.Error(t, e)
+	case <-time.After(time.Second):
+		assert.Fail(t, "up did not stop connecting")
+	}
+
+	assert.False(t, a.IsUp())
+}
+
+// fakeDNS will replace the default resolver with one that answers
+// every A query with the provided addresses, and every other query
+// with nothing.
+func fakeDNS(t *testing.T, ips *atomic.Pointer[[]net.IP]) {
+	t.Helper()
+
+	var orig *net.Resolver = net.DefaultResolver
+
+	t.Cleanup(
+		func() {
+			net.DefaultResolver = orig
+		},
+	)
+
+	net.DefaultResolver = &net.Resolver{
+		Dial: func(
+			_ context.Context,
+			_ string,
+			_ string,
+		) (net.Conn, error) {
+			var c net.Conn
+			var s net.Conn
+
+			// Not a PacketConn, so queries are length-prefixed
+			c, s = net.Pipe()
+
+			go func() {
+				defer func() {
+					_ = s.Close()
+				}()
+
+				for {
+					var ans [][]byte
+					var n int
+					var q []byte
+					var r []byte
+
+					q = make([]byte, 2)
+					if _, e := io.ReadFull(s, q); e != nil {
+						return
+					}
+
+					q = make([]byte, binary.BigEndian.Uint16(q))
+					if _, e := io.ReadFull(s, q); e != nil {
+						return
+					}
+
+					// Skip the header and question name
+					n = 12
+					for (n < len(q)) && (q[n] != 0) {
+						n += int(q[n]) + 1
+					}
+
+					n += 5 // Null label, type, and class
+
+					if binary.BigEndian.Uint16(q[n-4:]) == 1 {
+						for _, ip := range *ips.Load() {
+							ans = append(
+								ans,
+								append(
+									[]byte{
+										0xc0, 12, 0, 1, 0, 1,
+										0, 0, 0, 1, 0, 4,
+									},
+									ip.To4()...,
+								),
+							)
+						}
+					}
+
+					r = append(r, q[:2]...)
+					r = append(r, 0x81, 0x80, 0, 1, 0, byte(len(ans)))
+					r = append(r, 0, 0, 0, 0)
+					r = append(r, q[12:n]...)
+					r = append(r, bytes.Join(ans, nil)...)
+
+					r = append(
+						binary.BigEndian.AppendUint16(
+							nil,
+							uint16(len(r)), //nolint:gosec // Small
+						),
+						r...,
+					)
+
+					if _, e := s.Write(r); e != nil {
+						return
+					}
+				}
+			}()
+
+			return c, nil
+		},
+		PreferGo: true,
+	}
+}
+
+func fakeStartTLS(
+	t *testing.T,
+	addr string,
+	dialog func(c net.Conn, r *bufio.Reader),
+) net.Listener {
+	t.Helper()
+
+	var cert tls.Certificate
+	var e error
+	var l net.Listener
+
+	cert, e = tls.LoadX509KeyPair(
+		"testdata/pki/certs/localhost.cert.pem",
+		"testdata/pki/private/localhost.key.pem",
+	)
+	assert.NoError(t, e)
+
+	l, e = net.Listen("tcp", addr)
+	assert.NoError(t, e)
+
+	go func() {
+		var c net.Conn
+		var e error
+		var tc *tls.Conn
+
+		if c, e = l.Accept(); e != nil {
+			return
+		}
+
+		defer func() {
+			_ = c.Close()
+		}()
+
+		dialog(c, bufio.NewReader(c))
+
+		tc = tls.Server(
+			c,
+			&tls.Config{Certificates: []tls.Certificate{cert}},
+		)
+		if e = tc.Handshake(); e != nil {
+			return
+		}
+
+		_, _ = tc.Write([]byte("hello"))
+		_, _ = tc.Read(make([]byte, 1))
+	}()
+
+	return l
+}
+
+func peerCN(t *testing.T, addr string) string {
+	t.Helper()
+
+	var c *tls.Conn
+	var e error
+
+	c, e = tls.Dial(
+		"tcp",
+		addr,
+		&tls.Config{InsecureSkipVerify: true}, //nolint:gosec // Test
+	)
+	assert.NoError(t, e)
+
+	defer func() {
+		_ = c.Close()
+	}()
+
+	return c.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+// pingPong will connect to the provided address, expect a greeting,
+// send a ping, and return how long the pong took.
+func pingPong(t *testing.T, addr string) time.Duration {
+	t.Helper()
+
+	var b []byte = make([]byte, 6)
+	var c net.Conn
+	var e error
+	var start time.Time
+
+	for range 100 {
+		if c, e = net.Dial("tcp", addr); e == nil {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.NoError(t, e)
+
+	defer func() {
+		_ = c.Close()
+	}()
+
+	_ = c.SetDeadline(time.Now().Add(2 * time.Second))
+
+	_, e = io.ReadFull(c, b)
+	assert.NoError(t, e)
+	assert.Equal(t, "hello\n", string(b))
+
+	_, e = c.Write([]byte("ping\n"))
+	assert.NoError(t, e)
+
+	start = time.Now()
+
+	_, e = io.ReadFull(c, b[:5])
+	assert.NoError(t, e)
+	assert.Equal(t, "pong\n", string(b[:5]))
+
+	return time.Since(start)
+}
+
 func sharedNetworkTests(t *testing.T, fn string, seeds ...string) {
 	t.Helper()
 
@@ -258,314 +624,3779 @@ func TestFileNUt(t *testing.T) {
 	)
 }
 
-func TestStdioNUt(t *testing.T) {
+func TestFilteredNUt(t *testing.T) {
 	t.Run(
-		"InvalidAddr",
+		"Clients",
 		func(t *testing.T) {
+			var a sak.NUt
+			var b []byte = make([]byte, 16)
+			var c net.Conn
 			var e error
+			var n int
 
-			// Create NUt
-			_, e = sak.NewNUt("stdio:asdf")
-			assert.Error(t, e)
-		},
-	)
+			a, e = sak.NewNUt("tcp-l:127.13.37.1:5401,encode=base64")
+			assert.NoError(t, e)
 
-	t.Run(
-		"UnknownOption",
-		func(t *testing.T) {
-			var e error
+			e = a.Up()
+			assert.NoError(t, e)
 
-			// Create NUt
-			_, e = sak.NewNUt("stdio:,asdf")
-			assert.Error(t, e)
+			defer func() {
+				_ = a.Down()
+			}()
+
+			c, e = net.Dial("tcp", "127.13.37.1:5401")
+			assert.NoError(t, e)
+
+			// Leave partial input in both directions
+			_, e = c.Write([]byte("Zmlyc3"))
+			assert.NoError(t, e)
+
+			n, e = io.ReadAtLeast(a, b, 3)
+			assert.NoError(t, e)
+			assert.Equal(t, "fir", string(b[:n]))
+
+			_, e = a.Write([]byte("ab"))
+			assert.NoError(t, e)
+
+			// Reset, so the next write fails and the listener moves
+			// on to the next client
+			e = c.(*net.TCPConn).SetLinger(0)
+			assert.NoError(t, e)
+
+			_ = c.Close()
+
+			_, e = a.Write([]byte("cd"))
+			assert.NoError(t, e)
+
+			// Nothing left over from the first client is applied to
+			// the second, in either direction
+			c, e = net.Dial("tcp", "127.13.37.1:5401")
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = c.Close()
+			}()
+
+			_, e = c.Write([]byte("aGkh"))
+			assert.NoError(t, e)
+
+			// The first client's stream ends before the second's
+			n, e = io.ReadAtLeast(a, b, 4)
+			assert.NoError(t, e)
+			assert.Equal(t, "shi!", string(b[:n]))
+
+			_, e = a.Write([]byte("hi!"))
+			assert.NoError(t, e)
+
+			n, e = io.ReadFull(c, b[:4])
+			assert.NoError(t, e)
+			assert.Equal(t, "aGkh", string(b[:n]))
 		},
 	)
 
 	t.Run(
-		"Success",
+		"Codecs",
 		func(t *testing.T) {
 			var a sak.NUt
-			var b sak.NUt
+			var b []byte = make([]byte, 16)
+			var c net.Conn
 			var e error
-			var grErrs chan error = make(chan error, 1)
+			var l net.Listener
+			var n int
+			var out []byte
+
+			l, e = net.Listen("tcp", "127.13.37.1:5397")
+			assert.NoError(t, e)
 
 			defer func() {
-				for e := range grErrs {
+				_ = l.Close()
+			}()
+
+			for _, test := range []struct {
+				opts string
+				in   string
+				wire string
+			}{
+				{"encode=base64,wrap=4", "hello", "aGVs\nbG8=\n"},
+				{"filter=base64url", "\xfb\xff", "-_8="},
+				{"encode=hex", "hi", "6869"},
+				{"encode=urlencode", "a b/~", "a%20b%2F~"},
+				{"decode=base64", "aGVs\nbG8=", "hello"},
+			} {
+				a, e = sak.NewNUt("tcp:127.13.37.1:5397," + test.opts)
+				assert.NoError(t, e)
+
+				e = a.Up()
+				assert.NoError(t, e)
+
+				c, e = l.Accept()
+				assert.NoError(t, e)
+
+				// Write a byte at a time, to split encoded quanta
+				for i := range len(test.in) {
+					_, e = a.Write([]byte{test.in[i]})
 					assert.NoError(t, e)
 				}
-			}()
 
-			// Create NUts
-			a, e = sak.NewNUt("-")
-			assert.NoError(t, e)
+				// Down flushes any partial input
+				e = a.Down()
+				assert.NoError(t, e)
 
-			b, e = sak.NewNUt("-")
+				out, e = io.ReadAll(c)
+				assert.NoError(t, e)
+				assert.Equal(t, test.wire, string(out), test.opts)
+
+				_ = c.Close()
+			}
+
+			// Read data is decoded, even when split mid-quantum
+			a, e = sak.NewNUt("urlencode|base64|tcp:127.13.37.1:5397")
 			assert.NoError(t, e)
 
-			e = a.Open() // For coverage
+			e = a.Up()
 			assert.NoError(t, e)
 
-			// Pair NUts
-			go func() {
-				grErrs <- sak.Pair(a, b)
+			c, e = l.Accept()
+			assert.NoError(t, e)
 
-				close(grErrs)
+			defer func() {
+				_ = c.Close()
 			}()
 
-			// Wait
-			time.Sleep(2 * time.Second)
+			// base64 of "w%6Frld"
+			for _, chunk := range []string{"dy", "U2\n", "RnJsZA=="} {
+				_, e = c.Write([]byte(chunk))
+				assert.NoError(t, e)
 
-			// Stop NUts
-			e = a.Close() // For coverage
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			n, e = io.ReadAtLeast(a, b, 5)
 			assert.NoError(t, e)
+			assert.Equal(t, "world", string(b[:n]))
 
-			e = b.Down()
+			e = a.Down()
 			assert.NoError(t, e)
 		},
 	)
-}
 
-func TestStream(t *testing.T) {
-	var a sak.NUt
-	var b sak.NUt
-	var e error
-	var grErrs chan error = make(chan error, 1)
+	t.Run(
+		"Invalid",
+		func(t *testing.T) {
+			var e error
 
-	defer func() {
-		for e := range grErrs {
-			assert.NoError(t, e)
-		}
-	}()
+			for _, seed := range []string{
+				"asdf|tcp:127.13.37.1:4444",
+				"base64=0|tcp:127.13.37.1:4444",
+				"gzip=9|tcp:127.13.37.1:4444",
+				"hex|asdf:127.13.37.1:4444",
+				"hex|tcp:127.13.37.1:4444,asdf",
+				"tcp:127.13.37.1:4444,filter=",
+				"tcp:127.13.37.1:4444,filter=hex:asdf",
+				"tcp:127.13.37.1:4444,encode=asdf",
+				"tcp:127.13.37.1:4444,encode=hex,encode=hex",
+				"tcp:127.13.37.1:4444,encode=hex,wrap=asdf",
+				"tcp:127.13.37.1:4444,wrap=76",
+				"trace=asdf|tcp:127.13.37.1:4444",
+			} {
+				_, e = sak.NewNUt(seed)
+				assert.Error(t, e)
+			}
 
-	// Create NUts
-	a, e = sak.NewNUt("-")
-	assert.NoError(t, e)
+			e = sak.RegisterFilter("hex", nil)
+			assert.Error(t, e)
 
-	b, e = sak.NewNUt("-")
-	assert.NoError(t, e)
+			e = sak.RegisterFilter("a|b", nil)
+			assert.Error(t, e)
+		},
+	)
 
-	// Stream NUts
-	go func() {
-		grErrs <- sak.Stream(a, b)
+	t.Run(
+		"String",
+		func(t *testing.T) {
+			var a sak.NUt
+			var e error
 
-		close(grErrs)
-	}()
+			for _, seed := range []string{
+				"hex|gzip|tcp:127.13.37.1:4444",
+				"hex|tcp:127.13.37.1:4444,filter=gzip",
+				"tcp:127.13.37.1:4444,filter=hex:gzip",
+			} {
+				a, e = sak.NewNUt(seed)
+				assert.NoError(t, e)
+				assert.Equal(
+					t,
+					"hex|gzip|tcp:127.13.37.1:4444",
+					a.String(),
+				)
+			}
 
-	// Wait
-	time.Sleep(2 * time.Second)
+			a, e = sak.NewNUt(
+				"trace=text|tcp:127.13.37.1:4444,filter=trace=hex",
+			)
+			assert.NoError(t, e)
+			assert.Equal(
+				t,
+				"trace|trace=hex|tcp:127.13.37.1:4444",
+				a.String(),
+			)
 
-	// Stop NUts
-	e = a.Down()
-	assert.NoError(t, e)
+			a, e = sak.NewNUt(
+				"tcp:127.13.37.1:4444,filter=gzip,decode=hex,wrap=8",
+			)
+			assert.NoError(t, e)
+			assert.Equal(
+				t,
+				"gzip|decode=hex=8|tcp:127.13.37.1:4444",
+				a.String(),
+			)
+		},
+	)
 
-	e = b.Down()
-	assert.NoError(t, e)
-}
+	t.Run(
+		"Wire",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b []byte = make([]byte, 16)
+			var c net.Conn
+			var e error
+			var gr *gzip.Reader
+			var gw *gzip.Writer
+			var l net.Listener
+			var n int
+
+			l, e = net.Listen("tcp", "127.13.37.1:5391")
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = l.Close()
+			}()
+
+			a, e = sak.NewNUt("hex|gzip|tcp:127.13.37.1:5391")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			c, e = l.Accept()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = c.Close()
+			}()
+
+			// Written data is hex encoded, then compressed
+			_, e = a.Write([]byte("hello"))
+			assert.NoError(t, e)
+
+			gr, e = gzip.NewReader(c)
+			assert.NoError(t, e)
+
+			n, e = gr.Read(b)
+			assert.NoError(t, e)
+			assert.Equal(t, "68656c6c6f", string(b[:n]))
+
+			// Read data is decompressed, then hex decoded
+			gw = gzip.NewWriter(c)
+
+			_, e = gw.Write([]byte("77 6f\n72 6c 64"))
+			assert.NoError(t, e)
+
+			e = gw.Flush()
+			assert.NoError(t, e)
+
+			n, e = io.ReadAtLeast(a, b, 5)
+			assert.NoError(t, e)
+			assert.Equal(t, "world", string(b[:n]))
+
+			e = a.Down()
+			assert.NoError(t, e)
+		},
+	)
 
-func TestTCPNUt(t *testing.T) {
 	sharedNetworkTests(
 		t,
-		"testdata/out_tcp",
-		"tcp:doesnotexist.asdf.com:4444",
-		"tcp-listen:doesnotexist.asdf.com:4444",
-		"tcp:127.13.37.1:4444,asdf",
+		"testdata/out_filter",
+		"gzip|tcp:doesnotexist.asdf.com:4444",
+		"gzip|tcp-listen:doesnotexist.asdf.com:4444",
+		"gzip|tcp:127.13.37.1:4444,asdf",
 		"file:testdata/in",
-		"tcp:127.13.37.1:4444",
-		"tcp-l:127.13.37.1:4444,fork",
-		"file:testdata/out_tcp,mode=write",
+		"gzip|hex|tcp:127.13.37.1:5392",
+		"tcp-l:127.13.37.1:5392,fork,filter=gzip:hex",
+		"file:testdata/out_filter,mode=write",
 	)
 }
 
-func TestTLSNUt(t *testing.T) {
+func TestFramedNUt(t *testing.T) {
 	t.Run(
-		"InvalidCA",
+		"Invalid",
 		func(t *testing.T) {
 			var e error
 
-			// Create NUt
-			_, e = sak.NewNUt(
-				strings.Join(
-					[]string{
-						"tls:127.13.37.1:8443",
-						"ca=/noexist",
-						"cert=/noexist",
-						"key=/noexist",
-					},
-					",",
-				),
+			for _, seed := range []string{
+				"tcp:127.13.37.1:5366,frame=len8",
+				"tcp:127.13.37.1:5366,frame=len16,frame=len32",
+				"tcp:127.13.37.1:5366,frame=len16,asdf",
+				"udp:127.13.37.1:5366,frame=len16",
+			} {
+				_, e = sak.NewNUt(seed)
+				assert.Error(t, e)
+			}
+		},
+	)
+
+	t.Run(
+		"Large",
+		func(t *testing.T) {
+			var a sak.NUt
+			var buf []byte = make([]byte, 32*1024)
+			var c net.Conn
+			var e error
+			var frame []byte = []byte{0, 0, 0xa0, 0}
+			var l *net.TCPListener
+			var n int
+			var payload []byte = bytes.Repeat([]byte("a"), 40*1024)
+			var read []byte
+
+			l, e = net.ListenTCP(
+				"tcp",
+				&net.TCPAddr{
+					IP:   net.IPv4(127, 13, 37, 1),
+					Port: 5369,
+				},
 			)
-			assert.Error(t, e)
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = l.Close()
+			}()
+
+			a, e = sak.NewNUt("tcp:127.13.37.1:5369,frame=len32")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = a.Down()
+			}()
+
+			c, e = l.Accept()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = c.Close()
+			}()
+
+			_, e = c.Write(append(frame, payload...))
+			assert.NoError(t, e)
+
+			// Frames larger than the buffer of io.Copy are still read
+			// in full on the stream path
+			for len(read) < len(payload) {
+				if n, e = a.Read(buf); e != nil {
+					break
+				}
+
+				read = append(read, buf[:n]...)
+			}
+
+			assert.NoError(t, e)
+			assert.Equal(t, payload, read)
 		},
 	)
 
 	t.Run(
-		"InvalidCert",
+		"Oversized",
 		func(t *testing.T) {
+			var a sak.NUt
+			var buf []byte = make([]byte, 64)
+			var c net.Conn
 			var e error
+			var l *net.TCPListener
+			var read chan error = make(chan error, 1)
 
-			// Create NUt
-			_, e = sak.NewNUt(
-				strings.Join(
-					[]string{
-						"tls:127.13.37.1:8443",
-						"cert=/noexist",
-						"key=/noexist",
-					},
-					",",
-				),
+			l, e = net.ListenTCP(
+				"tcp",
+				&net.TCPAddr{
+					IP:   net.IPv4(127, 13, 37, 1),
+					Port: 5362,
+				},
 			)
-			assert.Error(t, e)
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = l.Close()
+			}()
+
+			a, e = sak.NewNUt("tcp:127.13.37.1:5362,frame=len32")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = a.Down()
+			}()
+
+			c, e = l.Accept()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = c.Close()
+			}()
+
+			// A frame no datagram could fill should fail, rather than
+			// waiting to discard gigabytes
+			_, e = c.Write([]byte{0xff, 0xff, 0xff, 0xf0, 'a'})
+			assert.NoError(t, e)
+
+			go func() {
+				_, _, e := a.(sak.PacketNUt).ReadPacket(buf)
+				read <- e
+			}()
+
+			select {
+			case e = <-read:
+				assert.ErrorContains(t, e, "invalid frame")
+			case <-time.After(time.Second):
+				assert.Fail(t, "oversized frame was not rejected")
+			}
+		},
+	)
+
+	t.Run(
+		"Success",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var backend *net.UDPConn
+			var c *net.UDPConn
+			var d sak.NUt
+			var e error
+			var grErrs chan error = make(chan error, 2)
+			var relay sak.NUt
+			var wg sync.WaitGroup
+
+			defer func() {
+				wg.Wait()
+				close(grErrs)
+
+				for e := range grErrs {
+					assert.NoError(t, e)
+				}
+			}()
+
+			// Backend that echoes each datagram
+			backend, e = net.ListenUDP(
+				"udp",
+				&net.UDPAddr{
+					IP:   net.IPv4(127, 13, 37, 1),
+					Port: 5367,
+				},
+			)
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = backend.Close()
+			}()
+
+			go func() {
+				var b []byte = make([]byte, 64)
+				var e error
+				var from *net.UDPAddr
+				var n int
+
+				for {
+					n, from, e = backend.ReadFromUDP(b)
+					if e != nil {
+						return
+					}
+
+					_, _ = backend.WriteToUDP(b[:n], from)
+				}
+			}()
+
+			// Create NUts
+			a, e = sak.NewNUt("udp-l:127.13.37.1:5365")
+			assert.NoError(t, e)
+
+			b, e = sak.NewNUt("tcp:127.13.37.1:5366,frame=len16")
+			assert.NoError(t, e)
+			assert.Contains(t, b.String(), "frame=len16")
+
+			relay, e = sak.NewNUt(
+				"tcp-l:127.13.37.1:5366,frame=len16",
+			)
+			assert.NoError(t, e)
+
+			d, e = sak.NewNUt("udp:127.13.37.1:5367")
+			assert.NoError(t, e)
+
+			// Pair NUts
+			for _, pair := range [][2]sak.NUt{{relay, d}, {a, b}} {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+
+					grErrs <- sak.Pair(pair[0], pair[1])
+				}()
+
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+
+			c, e = net.DialUDP(
+				"udp",
+				nil,
+				&net.UDPAddr{
+					IP:   net.IPv4(127, 13, 37, 1),
+					Port: 5365,
+				},
+			)
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = c.Close()
+			}()
+
+			// Datagrams sent back-to-back should stay separate
+			for _, msg := range []string{"first", "second"} {
+				_, e = c.Write([]byte(msg))
+				assert.NoError(t, e)
+			}
+
+			for _, msg := range []string{"first", "second"} {
+				var buf []byte = make([]byte, 64)
+				var n int
+
+				_ = c.SetReadDeadline(time.Now().Add(time.Second))
+
+				n, e = c.Read(buf)
+				assert.NoError(t, e)
+				assert.Equal(t, msg, string(buf[:n]))
+			}
+
+			// Stop NUts
+			for _, nut := range []sak.NUt{a, b, relay, d} {
+				e = nut.Down()
+				assert.NoError(t, e)
+			}
+		},
+	)
+}
+
+func TestPair(t *testing.T) {
+	t.Run(
+		"IdleTimeout",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var c net.Conn
+			var done chan error = make(chan error, 1)
+			var e error
+
+			a, e = sak.NewNUt(
+				"tcp-l:127.13.37.1:5385,idle-timeout=300ms",
+			)
+			assert.NoError(t, e)
+
+			b, e = sak.NewNUt("file:testdata/out_pair,mode=write")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			go func() {
+				done <- sak.Pair(a, b)
+			}()
+
+			c, e = net.DialTimeout(
+				"tcp",
+				"127.13.37.1:5385",
+				time.Second,
+			)
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = c.Close()
+			}()
+
+			// Traffic keeps the tunnel open
+			for range 6 {
+				_, e = c.Write([]byte("ping\n"))
+				assert.NoError(t, e)
+
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			select {
+			case e = <-done:
+				assert.Fail(t, "tunnel closed while active")
+			default:
+			}
+
+			// No traffic closes the tunnel
+			select {
+			case e = <-done:
+				assert.NoError(t, e)
+			case <-time.After(2 * time.Second):
+				assert.Fail(t, "tunnel still open while idle")
+			}
+
+			assert.False(t, a.IsUp())
+			assert.False(t, b.IsUp())
+		},
+	)
+
+	t.Run(
+		"IdleTimeoutFork",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var c net.Conn
+			var done chan error = make(chan error, 1)
+			var e error
+
+			a, e = sak.NewNUt(
+				"tcp-l:127.13.37.1:5368,fork,idle-timeout=300ms",
+			)
+			assert.NoError(t, e)
+
+			b, e = sak.NewNUt("file:testdata/out_pair,mode=write")
+			assert.NoError(t, e)
+
+			go func() {
+				done <- sak.Pair(a, b)
+			}()
+
+			assert.Eventually(
+				t,
+				a.IsUp,
+				time.Second,
+				10*time.Millisecond,
+			)
+
+			// Idle sessions are closed, but the listener stays up
+			for range 2 {
+				c, e = net.DialTimeout(
+					"tcp",
+					"127.13.37.1:5368",
+					time.Second,
+				)
+				assert.NoError(t, e)
+
+				if c == nil {
+					continue
+				}
+
+				_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+				_, e = c.Read(make([]byte, 1))
+				assert.ErrorIs(t, e, io.EOF)
+
+				_ = c.Close()
+			}
+
+			assert.True(t, a.IsUp())
+
+			e = a.Down()
+			assert.NoError(t, e)
+
+			select {
+			case e = <-done:
+				assert.NoError(t, e)
+			case <-time.After(time.Second):
+				assert.Fail(t, "Pair did not return after Down")
+			}
+		},
+	)
+
+	t.Run(
+		"InvalidLimits",
+		func(t *testing.T) {
+			var e error
+
+			for _, seed := range []string{
+				"file:testdata/in,max-duration=0",
+				"stdio:,idle-timeout=-1s",
+				"tcp:127.13.37.1:4444,idle-timeout=asdf",
+				"udp-l:127.13.37.1:4444,max-duration=asdf",
+			} {
+				_, e = sak.NewNUt(seed)
+				assert.Error(t, e)
+			}
+
+			_, e = sak.NewNUt(
+				"stdio:,idle-timeout=1s,max-duration=1m",
+			)
+			assert.NoError(t, e)
+		},
+	)
+
+	t.Run(
+		"MaxDuration",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var e error
+			var start time.Time = time.Now()
+
+			a, e = sak.NewNUt("udp-l:127.13.37.1:5386")
+			assert.NoError(t, e)
+
+			b, e = sak.NewNUt("file:testdata/out_pair,mode=write")
+			assert.NoError(t, e)
+
+			// Global default, used when NUts have no limit
+			sak.MaxDuration = 300 * time.Millisecond
+
+			defer func() {
+				sak.MaxDuration = 0
+			}()
+
+			e = sak.Pair(a, b)
+			assert.NoError(t, e)
+
+			assert.Less(t, time.Since(start), 2*time.Second)
+		},
+	)
+
+	t.Run(
+		"RecordFork",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var e error
+			var fn string = filepath.Join(t.TempDir(), "rec")
+
+			// Either side being recorded is rejected
+			for _, seeds := range [][]string{
+				{
+					"record=" + fn + "|tcp-l:127.13.37.1:5374,fork",
+					"file:" + os.DevNull + ",mode=write",
+				},
+				{
+					"tcp-l:127.13.37.1:5374,fork",
+					"record=" + fn + "|file:" + os.DevNull,
+				},
+			} {
+				a, e = sak.NewNUt(seeds[0])
+				assert.NoError(t, e)
+
+				b, e = sak.NewNUt(seeds[1])
+				assert.NoError(t, e)
+
+				e = sak.Pair(a, b)
+				assert.Error(t, e)
+				assert.False(t, a.IsUp())
+				assert.NoFileExists(t, fn)
+			}
+		},
+	)
+}
+
+func TestPcapWriter(t *testing.T) {
+	var a sak.NUt
+	var b sak.NUt
+	var buf bytes.Buffer
+	var c net.Conn
+	var client *net.TCPAddr
+	var e error
+	var flags []byte
+	var grErrs chan error = make(chan error, 1)
+	var in []byte
+	var l net.Listener
+	var payload []byte
+	var pcap []byte
+	var pw *sak.PcapWriter
+	var server *net.TCPAddr
+
+	defer func() {
+		for e := range grErrs {
+			assert.NoError(t, e)
+		}
+	}()
+
+	pw, e = sak.NewPcapWriter(&buf)
+	assert.NoError(t, e)
+
+	sak.Trace = pw.Trace
+	defer func() {
+		sak.Trace = nil
+	}()
+
+	l, e = net.Listen("tcp", "127.13.37.1:5393")
+	assert.NoError(t, e)
+
+	defer func() {
+		_ = l.Close()
+	}()
+
+	// Create NUts
+	a, e = sak.NewNUt("file:testdata/in")
+	assert.NoError(t, e)
+
+	b, e = sak.NewNUt("tcp:127.13.37.1:5393")
+	assert.NoError(t, e)
+
+	// Pair NUts
+	go func() {
+		grErrs <- sak.Pair(a, b)
+
+		close(grErrs)
+	}()
+
+	c, e = l.Accept()
+	assert.NoError(t, e)
+
+	in, e = os.ReadFile("testdata/in")
+	assert.NoError(t, e)
+
+	_, e = io.ReadFull(c, make([]byte, len(in)))
+	assert.NoError(t, e)
+
+	// Stop NUts
+	e = a.Down()
+	assert.NoError(t, e)
+
+	e = b.Down()
+	assert.NoError(t, e)
+
+	_ = c.Close()
+
+	// File header: magic and LINKTYPE_RAW
+	pcap = buf.Bytes()
+	assert.Equal(
+		t,
+		uint32(0xa1b2c3d4),
+		binary.LittleEndian.Uint32(pcap),
+	)
+	assert.Equal(
+		t,
+		uint32(101),
+		binary.LittleEndian.Uint32(pcap[20:]),
+	)
+
+	// The client side is the real local address of the TCP NUt
+	client, _ = c.RemoteAddr().(*net.TCPAddr)
+	server, _ = c.LocalAddr().(*net.TCPAddr)
+
+	for pcap = pcap[24:]; len(pcap) > 0; {
+		var src *net.TCPAddr = client
+		var dst *net.TCPAddr = server
+
+		n := int(binary.LittleEndian.Uint32(pcap[8:]))
+		pkt := pcap[16 : 16+n]
+		pcap = pcap[16+n:]
+
+		// SYN-ACK comes back from the server
+		if len(flags) == 1 {
+			src, dst = server, client
+		}
+
+		// IPv4 then TCP, with real addresses
+		assert.Equal(t, byte(0x45), pkt[0])
+		assert.Equal(t, byte(6), pkt[9])
+		assert.Equal(t, src.IP.String(), net.IP(pkt[12:16]).String())
+		assert.Equal(t, dst.IP.String(), net.IP(pkt[16:20]).String())
+		assert.Equal(t, src.Port, int(pkt[20])<<8|int(pkt[21]))
+		assert.Equal(t, dst.Port, int(pkt[22])<<8|int(pkt[23]))
+
+		flags = append(flags, pkt[33])
+		payload = append(payload, pkt[40:]...)
+	}
+
+	assert.GreaterOrEqual(t, len(flags), 4)
+	assert.Equal(t, []byte{0x02, 0x12, 0x10, 0x18}, flags[:4])
+	assert.Equal(t, in, payload)
+}
+
+func TestReplayNUt(t *testing.T) {
+	t.Run(
+		"Invalid",
+		func(t *testing.T) {
+			var a sak.NUt
+			var e error
+
+			for _, seed := range []string{
+				"replay:",
+				"replay:testdata/out_record,asdf",
+				"replay:testdata/out_record,side=asdf",
+				"replay:testdata/out_record,speed=0",
+				"replay:testdata/out_record,speed=asdf",
+				"record=|tcp:127.13.37.1:4444",
+			} {
+				_, e = sak.NewNUt(seed)
+				assert.Error(t, e)
+			}
+
+			a, e = sak.NewNUt("replay:testdata/asdf")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.Error(t, e)
+		},
+	)
+
+	t.Run(
+		"RecordAndReplay",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var e error
+			var gap time.Duration
+			var l net.Listener
+			var lines []string
+			var rec []byte
+
+			l, e = net.Listen("tcp", "127.13.37.1:5394")
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = l.Close()
+			}()
+
+			// Fake device greets, then answers a ping slowly
+			go func() {
+				var b []byte = make([]byte, 5)
+				var c net.Conn
+				var e error
+
+				if c, e = l.Accept(); e != nil {
+					return
+				}
+
+				defer func() {
+					_ = c.Close()
+				}()
+
+				_, _ = c.Write([]byte("hello\n"))
+
+				if _, e = io.ReadFull(c, b); e == nil {
+					time.Sleep(200 * time.Millisecond)
+					_, _ = c.Write([]byte("pong\n"))
+				}
+			}()
+
+			// Record the device
+			a, e = sak.NewNUt("tcp-l:127.13.37.1:5395")
+			assert.NoError(t, e)
+
+			b, e = sak.NewNUt(
+				"record=testdata/out_record|tcp:127.13.37.1:5394",
+			)
+			assert.NoError(t, e)
+
+			go func() {
+				_ = sak.Pair(a, b)
+			}()
+
+			gap = pingPong(t, "127.13.37.1:5395")
+			assert.GreaterOrEqual(t, gap, 200*time.Millisecond)
+
+			e = a.Down()
+			assert.NoError(t, e)
+
+			e = b.Down()
+			assert.NoError(t, e)
+
+			rec, e = os.ReadFile("testdata/out_record")
+			assert.NoError(t, e)
+
+			// Header, then one chunk per line
+			lines = strings.Split(string(rec), "\n")
+			assert.Len(t, lines, 5)
+			assert.Equal(t, "# nutsak recording v1", lines[0])
+			assert.Contains(t, lines[1], " server aGVsbG8K")
+			assert.Contains(t, lines[2], " client cGluZwo=")
+			assert.Contains(t, lines[3], " server cG9uZwo=")
+			assert.Empty(t, lines[4])
+
+			// Replay the device, twice as fast
+			a, e = sak.NewNUt("tcp-l:127.13.37.1:5396")
+			assert.NoError(t, e)
+
+			b, e = sak.NewNUt("replay:testdata/out_record,speed=2x")
+			assert.NoError(t, e)
+
+			go func() {
+				_ = sak.Pair(a, b)
+			}()
+
+			gap = pingPong(t, "127.13.37.1:5396")
+			assert.GreaterOrEqual(t, gap, 80*time.Millisecond)
+			assert.Less(t, gap, 200*time.Millisecond)
+
+			e = a.Down()
+			assert.NoError(t, e)
+
+			e = b.Down()
+			assert.NoError(t, e)
+		},
+	)
+}
+
+func TestStartTLSNUt(t *testing.T) {
+	var dialogs map[string]func(net.Conn, *bufio.Reader)
+	var port int = 8470
+
+	dialogs = map[string]func(net.Conn, *bufio.Reader){
+		"ftp": func(c net.Conn, r *bufio.Reader) {
+			_, _ = c.Write([]byte("220-fake\r\n220 ready\r\n"))
+			_, _ = r.ReadString('\n')
+			_, _ = c.Write([]byte("234 AUTH TLS ok\r\n"))
+		},
+		"imap": func(c net.Conn, r *bufio.Reader) {
+			_, _ = c.Write([]byte("* OK fake ready\r\n"))
+			_, _ = r.ReadString('\n')
+			_, _ = c.Write([]byte("a001 OK begin TLS\r\n"))
+		},
+		"postgres": func(c net.Conn, r *bufio.Reader) {
+			_, _ = io.ReadFull(r, make([]byte, 8))
+			_, _ = c.Write([]byte("S"))
+		},
+		"smtp": func(c net.Conn, r *bufio.Reader) {
+			_, _ = c.Write([]byte("220 fake ESMTP\r\n"))
+			_, _ = r.ReadString('\n')
+			_, _ = c.Write([]byte("250-fake\r\n250 STARTTLS\r\n"))
+			_, _ = r.ReadString('\n')
+			_, _ = c.Write([]byte("220 go ahead\r\n"))
+		},
+	}
+
+	for proto, dialog := range dialogs {
+		var addr string = "127.13.37.1:" + strconv.Itoa(port)
+
+		port++
+
+		t.Run(
+			proto,
+			func(t *testing.T) {
+				var a sak.NUt
+				var b []byte = make([]byte, 5)
+				var e error
+				var l net.Listener = fakeStartTLS(t, addr, dialog)
+
+				defer func() {
+					_ = l.Close()
+				}()
+
+				a, e = sak.NewNUt(
+					strings.Join(
+						[]string{
+							"starttls-" + proto + ":" + addr,
+							"ca=testdata/pki/ca/ca.cert.pem",
+							"verify",
+						},
+						",",
+					),
+				)
+				assert.NoError(t, e)
+
+				e = a.Up()
+				assert.NoError(t, e)
+
+				_, e = io.ReadFull(a, b)
+				assert.NoError(t, e)
+				assert.Equal(t, "hello", string(b))
+
+				e = a.Down()
+				assert.NoError(t, e)
+			},
+		)
+	}
+
+	t.Run(
+		"UnknownOption",
+		func(t *testing.T) {
+			var e error
+
+			// Create NUt
+			_, e = sak.NewNUt("starttls-smtp:127.13.37.1:25,asdf")
+			assert.Error(t, e)
+
+			_, e = sak.NewNUt("starttls-smtp:127.13.37.1:25,fork")
+			assert.Error(t, e)
+		},
+	)
+}
+
+func TestStdioNUt(t *testing.T) {
+	t.Run(
+		"InvalidAddr",
+		func(t *testing.T) {
+			var e error
+
+			// Create NUt
+			_, e = sak.NewNUt("stdio:asdf")
+			assert.Error(t, e)
+		},
+	)
+
+	t.Run(
+		"UnknownOption",
+		func(t *testing.T) {
+			var e error
+
+			// Create NUt
+			_, e = sak.NewNUt("stdio:,asdf")
+			assert.Error(t, e)
+		},
+	)
+
+	t.Run(
+		"Success",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var e error
+			var grErrs chan error = make(chan error, 1)
+
+			defer func() {
+				for e := range grErrs {
+					assert.NoError(t, e)
+				}
+			}()
+
+			// Create NUts
+			a, e = sak.NewNUt("-")
+			assert.NoError(t, e)
+
+			b, e = sak.NewNUt("-")
+			assert.NoError(t, e)
+
+			e = a.Open() // For coverage
+			assert.NoError(t, e)
+
+			// Pair NUts
+			go func() {
+				grErrs <- sak.Pair(a, b)
+
+				close(grErrs)
+			}()
+
+			// Wait
+			time.Sleep(2 * time.Second)
+
+			// Stop NUts
+			e = a.Close() // For coverage
+			assert.NoError(t, e)
+
+			e = b.Down()
+			assert.NoError(t, e)
+		},
+	)
+}
+
+func TestStream(t *testing.T) {
+	var a sak.NUt
+	var b sak.NUt
+	var e error
+	var grErrs chan error = make(chan error, 1)
+
+	defer func() {
+		for e := range grErrs {
+			assert.NoError(t, e)
+		}
+	}()
+
+	// Create NUts
+	a, e = sak.NewNUt("-")
+	assert.NoError(t, e)
+
+	b, e = sak.NewNUt("-")
+	assert.NoError(t, e)
+
+	// Stream NUts
+	go func() {
+		grErrs <- sak.Stream(a, b)
+
+		close(grErrs)
+	}()
+
+	// Wait
+	time.Sleep(2 * time.Second)
+
+	// Stop NUts
+	e = a.Down()
+	assert.NoError(t, e)
+
+	e = b.Down()
+	assert.NoError(t, e)
+}
+
+func TestTCPNUt(t *testing.T) {
+	t.Run(
+		"ACL",
+		func(t *testing.T) {
+			var a sak.NUt
+			var bad string = filepath.Join(t.TempDir(), "acl")
+			var e error
+			var ok bool
+			var stats sak.StatsReporter
+
+			e = os.WriteFile(bad, []byte("permit 127.0.0.1\n"), 0o600)
+			assert.NoError(t, e)
+
+			for _, seed := range []string{
+				"tcp:127.13.37.1:4444,allow=127.0.0.1",
+				"tcp-l:127.13.37.1:4444,acl=" + bad,
+				"tcp-l:127.13.37.1:4444,acl=testdata/asdf",
+				"tcp-l:127.13.37.1:4444,allow=asdf",
+				"tcp-l:127.13.37.1:4444,deny=",
+				"tls-l:127.13.37.1:4444,deny=127.0.0.1/33",
+			} {
+				_, e = sak.NewNUt(seed)
+				assert.Error(t, e)
+			}
+
+			// Lists continue across commas
+			a, e = sak.NewNUt(
+				"tcp-l:4444,allow=10.0.0.0/8,10.1.1.1,fork",
+			)
+			assert.NoError(t, e)
+			assert.Contains(t, a.String(), "=10.0.0.0/8,10.1.1.1")
+
+			for _, seed := range []string{
+				"tcp-l:127.13.37.1:5389,fork,acl=testdata/acl",
+				strings.Join(
+					[]string{
+						"tcp-l:127.13.37.1:5389",
+						"fork",
+						"allow=127.13.37.0/24",
+						"deny=127.13.37.3",
+					},
+					",",
+				),
+			} {
+				a, e = sak.NewNUt(seed)
+				assert.NoError(t, e)
+
+				stats, ok = a.(sak.StatsReporter)
+				assert.True(t, ok)
+
+				e = a.Up()
+				assert.NoError(t, e)
+
+				for local, allowed := range map[string]bool{
+					"127.0.0.1":   false,
+					"127.13.37.2": true,
+					"127.13.37.3": false,
+				} {
+					var c net.Conn
+					var d *net.Dialer = &net.Dialer{
+						LocalAddr: &net.TCPAddr{
+							IP: net.ParseIP(local),
+						},
+					}
+
+					c, e = d.Dial("tcp", "127.13.37.1:5389")
+					assert.NoError(t, e)
+
+					// Rejected peers are closed right away
+					_ = c.SetReadDeadline(
+						time.Now().Add(100 * time.Millisecond),
+					)
+					_, e = c.Read(make([]byte, 1))
+
+					if allowed {
+						assert.ErrorIs(t, e, os.ErrDeadlineExceeded)
+					} else {
+						assert.ErrorIs(t, e, io.EOF)
+					}
+
+					_ = c.Close()
+				}
+
+				assert.Equal(t, uint64(1), stats.Stats()["accepted"])
+				assert.Equal(t, uint64(2), stats.Stats()["denied"])
+
+				e = a.Down()
+				assert.NoError(t, e)
+			}
+		},
+	)
+
+	t.Run(
+		"Bind",
+		func(t *testing.T) {
+			var a sak.NUt
+			var e error
+			var l *net.TCPListener
+
+			for _, seed := range []string{
+				"tcp:127.13.37.1:5375,bind=[::1",
+				"tcp-l:127.13.37.1:5375,bind=127.13.37.2",
+			} {
+				_, e = sak.NewNUt(seed)
+				assert.Error(t, e)
+			}
+
+			l, e = net.ListenTCP(
+				"tcp",
+				&net.TCPAddr{
+					IP:   net.IPv4(127, 13, 37, 1),
+					Port: 5375,
+				},
+			)
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = l.Close()
+			}()
+
+			for bind, expected := range map[string]string{
+				"127.13.37.2":      "127.13.37.2:",
+				"127.13.37.2:5376": "127.13.37.2:5376",
+			} {
+				a, e = sak.NewNUt(
+					"tcp:127.13.37.1:5375,bind=" + bind,
+				)
+				assert.NoError(t, e)
+
+				e = a.Up()
+				assert.NoError(t, e)
+
+				assert.Contains(t, acceptRemote(t, l), expected)
+
+				e = a.Down()
+				assert.NoError(t, e)
+			}
+		},
+	)
+
+	t.Run(
+		"ConnLimits",
+		func(t *testing.T) {
+			var a sak.NUt
+			var c []net.Conn
+			var e error
+			var start time.Time
+			var stats sak.StatsReporter
+
+			for _, seed := range []string{
+				"tcp:127.13.37.1:4444,max-conns=1",
+				"tcp-l:127.13.37.1:4444,accept-rate=0/s",
+				"tcp-l:127.13.37.1:4444,accept-rate=10",
+				"tcp-l:127.13.37.1:4444,accept-rate=10/asdf",
+				"tcp-l:127.13.37.1:4444,max-conns=0",
+				"tcp-l:127.13.37.1:4444,max-conns-per-ip=asdf",
+				"tls-l:127.13.37.1:4444,max-conns=-1",
+			} {
+				_, e = sak.NewNUt(seed)
+				assert.Error(t, e)
+			}
+
+			dial := func(n int) {
+				t.Helper()
+
+				for range n {
+					conn, e := net.Dial("tcp", "127.13.37.1:5388")
+					assert.NoError(t, e)
+
+					c = append(c, conn)
+				}
+			}
+
+			hangup := func() {
+				for _, conn := range c {
+					_ = conn.Close()
+				}
+
+				c = nil
+			}
+
+			count := func(stat string, expected uint64) {
+				t.Helper()
+
+				assert.Eventually(
+					t,
+					func() bool {
+						return stats.Stats()[stat] == expected
+					},
+					2*time.Second,
+					10*time.Millisecond,
+				)
+			}
+
+			listen := func(o string) {
+				t.Helper()
+
+				var ok bool
+
+				a, e = sak.NewNUt("tcp-l:127.13.37.1:5388,fork," + o)
+				assert.NoError(t, e)
+
+				stats, ok = a.(sak.StatsReporter)
+				assert.True(t, ok)
+
+				e = a.Up()
+				assert.NoError(t, e)
+
+				// Sessions hold their slots until clients hang up
+				go func(sessions <-chan sak.NUt) {
+					for s := range sessions {
+						go func() {
+							_ = s.Up()
+							_, _ = io.Copy(io.Discard, s)
+							_ = s.Down()
+						}()
+					}
+				}(a.(sak.Forker).Sessions())
+			}
+
+			// Extra connections from the same IP are closed
+			listen("max-conns-per-ip=1")
+
+			dial(2)
+			count("rejected", 1)
+			assert.Equal(t, uint64(1), stats.Stats()["accepted"])
+
+			_ = c[1].SetReadDeadline(time.Now().Add(time.Second))
+			_, e = c[1].Read(make([]byte, 1))
+			assert.ErrorIs(t, e, io.EOF)
+
+			hangup()
+
+			e = a.Down()
+			assert.NoError(t, e)
+
+			// Extra connections wait until a slot is free
+			listen("max-conns=1")
+
+			dial(2)
+			count("throttled", 1)
+			assert.Equal(t, uint64(1), stats.Stats()["accepted"])
+
+			_ = c[0].Close()
+			count("accepted", 2)
+
+			hangup()
+
+			e = a.Down()
+			assert.NoError(t, e)
+
+			// Accepts are spread out
+			listen("accept-rate=4/s")
+
+			start = time.Now()
+
+			dial(3)
+			count("accepted", 3)
+			assert.Greater(t, time.Since(start), 400*time.Millisecond)
+			assert.Equal(t, uint64(2), stats.Stats()["throttled"])
+
+			hangup()
+
+			e = a.Down()
+			assert.NoError(t, e)
+		},
+	)
+
+	t.Run(
+		"DownWhileConnecting",
+		func(t *testing.T) {
+			downWhileConnecting(t, "tcp:127.13.37.1:5363")
+		},
+	)
+
+	t.Run(
+		"Families",
+		func(t *testing.T) {
+			var a sak.NUt
+			var c net.Conn
+			var e error
+
+			for _, seed := range []string{
+				"tcp:[::1:4444",
+				"tcp:127.13.37.1:4444,pf=ip5",
+				"tcp4:127.13.37.1:4444,pf=ip6",
+				"tcp6-l:[::1]:4444,pf=ip4",
+			} {
+				_, e = sak.NewNUt(seed)
+				assert.Error(t, e)
+			}
+
+			// Matching pf is allowed
+			a, e = sak.NewNUt("tcp6-l:[::1]:4444,pf=ip6")
+			assert.NoError(t, e)
+			assert.Equal(t, "tcp6-listen", a.Type())
+
+			// IPv4 literal can't be used with IPv6
+			a, e = sak.NewNUt("tcp-l:127.13.37.1:5370,pf=ip6")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.Error(t, e)
+
+			// Bare port should listen on both IPv4 and IPv6
+			a, e = sak.NewNUt("tcp-l:5370")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			for _, addr := range []string{
+				"127.0.0.1:5370",
+				"[::1]:5370",
+			} {
+				c, e = net.DialTimeout("tcp", addr, time.Second)
+				assert.NoError(t, e)
+
+				if c != nil {
+					_ = c.Close()
+				}
+			}
+
+			e = a.Down()
+			assert.NoError(t, e)
+
+			// Explicit family should only listen on that family
+			a, e = sak.NewNUt("tcp6-l:5371")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			c, e = net.DialTimeout("tcp", "[::1]:5371", time.Second)
+			assert.NoError(t, e)
+
+			if c != nil {
+				_ = c.Close()
+			}
+
+			_, e = net.DialTimeout("tcp", "127.0.0.1:5371", 0)
+			assert.Error(t, e)
+
+			e = a.Down()
+			assert.NoError(t, e)
+		},
+	)
+
+	t.Run(
+		"Fork",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var c []net.Conn
+			var e error
+			var paired chan error = make(chan error, 1)
+
+			a, e = sak.NewNUt("tcp-l:127.13.37.1:5364,fork,echo")
+			assert.NoError(t, e)
+
+			b, e = sak.NewNUt("file:" + os.DevNull + ",mode=write")
+			assert.NoError(t, e)
+
+			go func() {
+				paired <- sak.Pair(a, b)
+			}()
+
+			assert.Eventually(
+				t,
+				a.IsUp,
+				time.Second,
+				10*time.Millisecond,
+			)
+
+			for range 2 {
+				conn, e := net.DialTimeout(
+					"tcp",
+					"127.13.37.1:5364",
+					time.Second,
+				)
+				assert.NoError(t, e)
+
+				if conn != nil {
+					c = append(c, conn)
+				}
+			}
+
+			// Each client should only ever see its own data
+			for i, conn := range c {
+				_, e = conn.Write([]byte("client" + strconv.Itoa(i)))
+				assert.NoError(t, e)
+			}
+
+			for i, conn := range c {
+				var buf []byte = make([]byte, 64)
+				var n int
+
+				_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+				n, e = io.ReadAtLeast(conn, buf, len("client0"))
+				assert.NoError(t, e)
+				assert.Equal(
+					t,
+					"client"+strconv.Itoa(i),
+					string(buf[:n]),
+				)
+
+				_ = conn.Close()
+			}
+
+			e = a.Down()
+			assert.NoError(t, e)
+
+			select {
+			case e = <-paired:
+				assert.NoError(t, e)
+			case <-time.After(time.Second):
+				assert.Fail(t, "Pair did not return after Down")
+			}
+		},
+	)
+
+	t.Run(
+		"ForkSharedFile",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var e error
+			var fn string = filepath.Join(t.TempDir(), "out")
+			var out []byte
+			var paired chan error = make(chan error, 1)
+
+			a, e = sak.NewNUt("tcp-l:127.13.37.1:5373,fork")
+			assert.NoError(t, e)
+
+			b, e = sak.NewNUt("file:" + fn + ",mode=write")
+			assert.NoError(t, e)
+
+			go func() {
+				paired <- sak.Pair(a, b)
+			}()
+
+			assert.Eventually(
+				t,
+				a.IsUp,
+				time.Second,
+				10*time.Millisecond,
+			)
+
+			// The file is not truncated for each client
+			for _, msg := range []string{"client0\n", "client1\n"} {
+				c, e := net.DialTimeout(
+					"tcp",
+					"127.13.37.1:5373",
+					time.Second,
+				)
+				assert.NoError(t, e)
+
+				if c == nil {
+					continue
+				}
+
+				_, e = c.Write([]byte(msg))
+				assert.NoError(t, e)
+
+				time.Sleep(100 * time.Millisecond)
+				_ = c.Close()
+			}
+
+			assert.Eventually(
+				t,
+				func() bool {
+					out, _ = os.ReadFile(fn)
+					return len(out) == len("client0\nclient1\n")
+				},
+				time.Second,
+				10*time.Millisecond,
+			)
+			assert.Equal(t, "client0\nclient1\n", string(out))
+
+			e = a.Down()
+			assert.NoError(t, e)
+
+			select {
+			case e = <-paired:
+				assert.NoError(t, e)
+			case <-time.After(time.Second):
+				assert.Fail(t, "Pair did not return after Down")
+			}
+
+			assert.False(t, b.IsUp())
+		},
+	)
+
+	t.Run(
+		"Resolve",
+		func(t *testing.T) {
+			var a sak.NUt
+			var c net.Conn
+			var e error
+			var ips atomic.Pointer[[]net.IP]
+			var l1 *net.TCPListener
+			var l2 *net.TCPListener
+			var moved chan struct{} = make(chan struct{})
+
+			// Nothing listens on the first record
+			ips.Store(
+				&[]net.IP{
+					net.IPv4(127, 13, 37, 9),
+					net.IPv4(127, 13, 37, 1),
+				},
+			)
+			fakeDNS(t, &ips)
+
+			for i, l := range []**net.TCPListener{&l1, &l2} {
+				*l, e = net.ListenTCP(
+					"tcp",
+					&net.TCPAddr{
+						IP:   net.IPv4(127, 13, 37, byte(i+1)),
+						Port: 5387,
+					},
+				)
+				assert.NoError(t, e)
+
+				defer func() {
+					_ = (*l).Close()
+				}()
+			}
+
+			a, e = sak.NewNUt("tcp:multi.nutsak.test:5387,retry=5")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = a.Down()
+			}()
+
+			// Fails over to the second record
+			c, e = l1.Accept()
+			assert.NoError(t, e)
+
+			// Reconnect should re-resolve to the new address
+			ips.Store(&[]net.IP{net.IPv4(127, 13, 37, 2)})
+			_ = c.Close()
+
+			go func() {
+				var c net.Conn
+				var e error
+
+				if c, e = l2.Accept(); e != nil {
+					return
+				}
+
+				_ = c.Close()
+				close(moved)
+			}()
+
+			// Writes will fail until the connection is replaced
+			go func() {
+				for {
+					select {
+					case <-moved:
+						return
+					default:
+						_, _ = a.Write([]byte("hello\n"))
+						time.Sleep(10 * time.Millisecond)
+					}
+				}
+			}()
+
+			select {
+			case <-moved:
+			case <-time.After(5 * time.Second):
+				assert.Fail(t, "failed to reconnect to new address")
+			}
+		},
+	)
+
+	t.Run(
+		"Retry",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var e error
+			var start time.Time
+
+			for _, seed := range []string{
+				"tcp:127.13.37.1:4444,backoff=asdf",
+				"tcp:127.13.37.1:4444,connect-timeout=0",
+				"tcp:127.13.37.1:4444,max=asdf",
+				"tcp:127.13.37.1:4444,retry=-1",
+				"tcp-l:127.13.37.1:4444,retry=1",
+			} {
+				_, e = sak.NewNUt(seed)
+				assert.Error(t, e)
+			}
+
+			// Fail fast, and Pair should return the dial error
+			a, e = sak.NewNUt("tcp:127.13.37.1:5384,retry=0")
+			assert.NoError(t, e)
+
+			b, e = sak.NewNUt("file:testdata/in")
+			assert.NoError(t, e)
+
+			e = sak.Pair(a, b)
+			assert.ErrorContains(t, e, "connect failed")
+
+			// Backoff is capped by max
+			a, e = sak.NewNUt(
+				"tcp:127.13.37.1:5384,backoff=exp,max=100ms,retry=2",
+			)
+			assert.NoError(t, e)
+
+			start = time.Now()
+
+			e = a.Up()
+			assert.Error(t, e)
+			assert.Less(t, time.Since(start), time.Second)
+
+			// Retry until the listener is up
+			go func() {
+				var e error
+				var l *net.TCPListener
+
+				time.Sleep(300 * time.Millisecond)
+
+				l, e = net.ListenTCP(
+					"tcp",
+					&net.TCPAddr{
+						IP:   net.IPv4(127, 13, 37, 1),
+						Port: 5384,
+					},
+				)
+				if e != nil {
+					return
+				}
+
+				defer func() {
+					_ = l.Close()
+				}()
+
+				_ = acceptRemote(t, l)
+			}()
+
+			a, e = sak.NewNUt(
+				"tcp:127.13.37.1:5384,backoff=exp,max=100ms,retry=20",
+			)
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			e = a.Down()
+			assert.NoError(t, e)
+		},
+	)
+
+	t.Run(
+		"SockOpts",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var c sak.NUt
+			var e error
+			var l *net.TCPListener
+
+			for _, seed := range []string{
+				"tcp:127.13.37.1:4444,bind-device=",
+				"tcp:127.13.37.1:4444,keepalive=-1s",
+				"tcp:127.13.37.1:4444,linger=asdf",
+				"tcp:127.13.37.1:4444,mark=-1",
+				"tcp:127.13.37.1:4444,nodelay=asdf",
+				"tcp:127.13.37.1:4444,rcvbuf=0",
+				"tcp:127.13.37.1:4444,sndbuf=asdf",
+				"tcp:127.13.37.1:4444,tos=256",
+				"tcp:127.13.37.1:4444,ttl=0",
+			} {
+				_, e = sak.NewNUt(seed)
+				assert.Error(t, e)
+			}
+
+			// Unknown devices fail when the socket is created
+			a, e = sak.NewNUt(
+				"tcp-l:127.13.37.1:5380,bind-device=asdf0",
+			)
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.ErrorContains(t, e, "bind-device asdf0")
+
+			a, e = sak.NewNUt(
+				strings.Join(
+					[]string{
+						"tcp-l:127.13.37.1:5380",
+						"keepalive=10s",
+						"rcvbuf=65536",
+						"reuseaddr",
+						"sndbuf=65536",
+						"tos=0x10",
+						"ttl=7",
+					},
+					",",
+				),
+			)
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = a.Down()
+			}()
+
+			if runtime.GOOS != "windows" {
+				// Without reuseport, the port is in use
+				b, e = sak.NewNUt("tcp-l:127.13.37.1:5381")
+				assert.NoError(t, e)
+
+				c, e = sak.NewNUt("tcp-l:127.13.37.1:5381")
+				assert.NoError(t, e)
+
+				e = b.Up()
+				assert.NoError(t, e)
+
+				e = c.Up()
+				assert.Error(t, e)
+
+				e = b.Down()
+				assert.NoError(t, e)
+
+				b, e = sak.NewNUt("tcp-l:127.13.37.1:5381,reuseport")
+				assert.NoError(t, e)
+
+				c, e = sak.NewNUt("tcp-l:127.13.37.1:5381,reuseport")
+				assert.NoError(t, e)
+
+				e = b.Up()
+				assert.NoError(t, e)
+
+				e = c.Up()
+				assert.NoError(t, e)
+
+				_ = b.Down()
+				_ = c.Down()
+			}
+
+			l, e = net.ListenTCP(
+				"tcp",
+				&net.TCPAddr{
+					IP:   net.IPv4(127, 13, 37, 1),
+					Port: 5382,
+				},
+			)
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = l.Close()
+			}()
+
+			b, e = sak.NewNUt(
+				"tcp:127.13.37.1:5382,linger=0,nodelay=off,ttl=9",
+			)
+			assert.NoError(t, e)
+
+			e = b.Up()
+			assert.NoError(t, e)
+
+			assert.NotEmpty(t, acceptRemote(t, l))
+
+			e = b.Down()
+			assert.NoError(t, e)
+		},
+	)
+
+	sharedNetworkTests(
+		t,
+		"testdata/out_tcp",
+		"tcp:doesnotexist.asdf.com:4444",
+		"tcp-listen:doesnotexist.asdf.com:4444",
+		"tcp:127.13.37.1:4444,asdf",
+		"file:testdata/in",
+		"tcp:127.13.37.1:4444",
+		"tcp-l:127.13.37.1:4444,fork",
+		"file:testdata/out_tcp,mode=write",
+	)
+}
+
+func TestTLSNUt(t *testing.T) {
+	t.Run(
+		"Authorization",
+		func(t *testing.T) {
+			var opts []string = []string{
+				"ca=testdata/pki/ca/ca.cert.pem",
+				"cert=testdata/pki/certs/localhost.cert.pem",
+				"fork",
+				"key=testdata/pki/private/localhost.key.pem",
+				"verify",
+			}
+			var tests []struct {
+				opt     string
+				allowed bool
+			} = []struct {
+				opt     string
+				allowed bool
+			}{
+				{"allow-cn=us*", true},
+				{"allow-cn=admin:root", false},
+				{"allow-ou=CyberSecurity*", true},
+				{"allow-ou=Finance", false},
+				{"allow-san=localhost:user", true},
+				{"allow-san=*.example.com", false},
+				{"crl=testdata/pki/crl/ca.crl.pem", false},
+				{"crl=testdata/pki/crl/expired.crl.pem", false},
+			}
+
+			for i, test := range tests {
+				var a sak.NUt
+				var addr string
+				var e error
+				var seed string
+
+				addr = "127.13.37.1:" + strconv.Itoa(8450+i)
+				seed = "tls-l:" + addr + "," + strings.Join(opts, ",")
+
+				a, e = sak.NewNUt(seed + "," + test.opt)
+				assert.NoError(t, e)
+
+				e = a.Up()
+				assert.NoError(t, e)
+
+				e = dialWithCert(t, addr)
+				if test.allowed {
+					assert.NoError(t, e, test.opt)
+				} else {
+					assert.Error(t, e, test.opt)
+				}
+
+				e = a.Down()
+				assert.NoError(t, e)
+			}
+		},
+	)
+
+	t.Run(
+		"AuthorizationNoVerify",
+		func(t *testing.T) {
+			var e error
+
+			_, e = sak.NewNUt(
+				strings.Join(
+					[]string{
+						"tls-l:127.13.37.1:8443",
+						"cert=testdata/pki/certs/localhost.cert.pem",
+						"key=testdata/pki/private/localhost.key.pem",
+						"allow-cn=user",
+					},
+					",",
+				),
+			)
+			assert.Error(t, e)
+
+			_, e = sak.NewNUt("tls:127.13.37.1:8443,allow-cn=user")
+			assert.Error(t, e)
+		},
+	)
+
+	t.Run(
+		"Bind",
+		func(t *testing.T) {
+			var a sak.NUt
+			var e error
+			var l *net.TCPListener
+			var remote chan string = make(chan string, 1)
+
+			_, e = sak.NewNUt("tls-l:127.13.37.1:5379,bind=127.0.0.1")
+			assert.Error(t, e)
+
+			l, e = net.ListenTCP(
+				"tcp",
+				&net.TCPAddr{
+					IP:   net.IPv4(127, 13, 37, 1),
+					Port: 5379,
+				},
+			)
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = l.Close()
+			}()
+
+			a, e = sak.NewNUt(
+				"tls:127.13.37.1:5379,bind=127.13.37.2,retry=0",
+			)
+			assert.NoError(t, e)
+
+			go func() {
+				remote <- acceptRemote(t, l)
+			}()
+
+			// Not a TLS server, so the handshake fails
+			e = a.Up()
+			assert.Error(t, e)
+
+			assert.Contains(t, <-remote, "127.13.37.2:")
+		},
+	)
+
+	t.Run(
+		"DownWhileConnecting",
+		func(t *testing.T) {
+			downWhileConnecting(t, "tls:127.13.37.1:5363")
+		},
+	)
+
+	t.Run(
+		"HandshakeStall",
+		func(t *testing.T) {
+			var a sak.NUt
+			var addr string = "127.13.37.1:8448"
+			var c *tls.Conn
+			var e error
+			var stalled net.Conn
+
+			a, e = sak.NewNUt(
+				strings.Join(
+					[]string{
+						"tls-l:" + addr,
+						"cert=testdata/pki/certs/localhost.cert.pem",
+						"fork",
+						"key=testdata/pki/private/localhost.key.pem",
+					},
+					",",
+				),
+			)
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = a.Down()
+			}()
+
+			// Connect, but never send a ClientHello
+			stalled, e = net.Dial("tcp", addr)
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = stalled.Close()
+			}()
+
+			// Other clients shouldn't have to wait on the stalled one
+			c, e = tls.DialWithDialer(
+				&net.Dialer{Timeout: time.Second},
+				"tcp",
+				addr,
+				&tls.Config{
+					InsecureSkipVerify: true, //nolint:gosec // Test
+				},
+			)
+			assert.NoError(t, e)
+
+			if c != nil {
+				_ = c.Close()
+			}
+		},
+	)
+
+	t.Run(
+		"InvalidCA",
+		func(t *testing.T) {
+			var e error
+
+			// Create NUt
+			_, e = sak.NewNUt(
+				strings.Join(
+					[]string{
+						"tls:127.13.37.1:8443",
+						"ca=/noexist",
+						"cert=/noexist",
+						"key=/noexist",
+					},
+					",",
+				),
+			)
+			assert.Error(t, e)
+		},
+	)
+
+	t.Run(
+		"InvalidCert",
+		func(t *testing.T) {
+			var e error
+
+			// Create NUt
+			_, e = sak.NewNUt(
+				strings.Join(
+					[]string{
+						"tls:127.13.37.1:8443",
+						"cert=/noexist",
+						"key=/noexist",
+					},
+					",",
+				),
+			)
+			assert.Error(t, e)
+		},
+	)
+
+	t.Run(
+		"InvalidCipher",
+		func(t *testing.T) {
+			var e error
+
+			// Create NUt
+			_, e = sak.NewNUt("tls:127.13.37.1:8443,ciphers=asdf")
+			assert.Error(t, e)
+		},
+	)
+
+	t.Run(
+		"InvalidCurve",
+		func(t *testing.T) {
+			var e error
+
+			// Create NUt
+			_, e = sak.NewNUt("tls:127.13.37.1:8443,curves=P-256:a")
+			assert.Error(t, e)
+		},
+	)
+
+	t.Run(
+		"InvalidKey",
+		func(t *testing.T) {
+			var e error
+
+			// Create NUt
+			_, e = sak.NewNUt(
+				strings.Join(
+					[]string{
+						"tls:127.13.37.1:8443",
+						"key=/noexist",
+					},
+					",",
+				),
+			)
+			assert.Error(t, e)
+		},
+	)
+
+	t.Run(
+		"InvalidVersion",
+		func(t *testing.T) {
+			var e error
+
+			// Create NUt
+			_, e = sak.NewNUt("tls:127.13.37.1:8443,minver=9.9")
+			assert.Error(t, e)
+
+			_, e = sak.NewNUt(
+				"tls:127.13.37.1:8443,minver=1.3,maxver=1.2",
+			)
+			assert.Error(t, e)
+		},
+	)
+
+	t.Run(
+		"KeyLog",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var e error
+			var fi os.FileInfo
+			var grErrs chan error = make(chan error, 1)
+			var keylog []byte
+
+			defer func() {
+				for e := range grErrs {
+					assert.NoError(t, e)
+				}
+			}()
+
+			// Start with a world-readable file, to ensure it's fixed
+			e = os.WriteFile("testdata/out_keylog", nil, 0o644)
+			assert.NoError(t, e)
+
+			e = os.Chmod("testdata/out_keylog", 0o644)
+			assert.NoError(t, e)
+
+			// Create NUts
+			a, e = sak.NewNUt(
+				strings.Join(
+					[]string{
+						"tls-l:127.13.37.1:8444",
+						"cert=testdata/pki/certs/localhost.cert.pem",
+						"key=testdata/pki/private/localhost.key.pem",
+					},
+					",",
+				),
+			)
+			assert.NoError(t, e)
+
+			b, e = sak.NewNUt(
+				"tls:127.13.37.1:8444,keylog=testdata/out_keylog",
+			)
+			assert.NoError(t, e)
+
+			// Pair NUts
+			go func() {
+				grErrs <- sak.Pair(a, b)
+
+				close(grErrs)
+			}()
+
+			// Wait
+			time.Sleep(time.Second)
+
+			// Stop NUts
+			e = a.Down()
+			assert.NoError(t, e)
+
+			e = b.Down()
+			assert.NoError(t, e)
+
+			fi, e = os.Stat("testdata/out_keylog")
+			assert.NoError(t, e)
+			assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+			keylog, e = os.ReadFile("testdata/out_keylog")
+			assert.NoError(t, e)
+			assert.Contains(t, string(keylog), "CLIENT_")
+		},
+	)
+
+	t.Run(
+		"MissingCA",
+		func(t *testing.T) {
+			var e error
+
+			// Create NUt
+			_, e = sak.NewNUt(
+				strings.Join(
+					[]string{
+						"tls-l:127.13.37.1:8443",
+						"cert=testdata/pki/certs/localhost.cert.pem",
+						"fork",
+						"key=testdata/pki/private/localhost.key.pem",
+						"verify",
+					},
+					",",
+				),
+			)
+			assert.Error(t, e)
+		},
+	)
+
+	t.Run(
+		"MissingCert",
+		func(t *testing.T) {
+			var e error
+
+			// Create NUt
+			_, e = sak.NewNUt(
+				strings.Join(
+					[]string{
+						"tls:127.13.37.1:8443",
+						"key=testdata/pki/private/localhost.key.pem",
+					},
+					",",
+				),
+			)
+			assert.Error(t, e)
+
+			_, e = sak.NewNUt(
+				strings.Join(
+					[]string{
+						"tls-l:127.13.37.1:8443",
+						"ca=testdata/pki/ca/ca.cert.pem",
+						"fork",
+						"key=testdata/pki/private/localhost.key.pem",
+						"verify",
+					},
+					",",
+				),
+			)
+			assert.Error(t, e)
+		},
+	)
+
+	t.Run(
+		"MissingKey",
+		func(t *testing.T) {
+			var e error
+
+			// Create NUt
+			_, e = sak.NewNUt(
+				strings.Join(
+					[]string{
+						"tls:127.13.37.1:8443",
+						"cert=testdata/pki/certs/localhost.cert.pem",
+					},
+					",",
+				),
+			)
+			assert.Error(t, e)
+
+			_, e = sak.NewNUt(
+				strings.Join(
+					[]string{
+						"tls-l:127.13.37.1:8443",
+						"ca=testdata/pki/ca/ca.cert.pem",
+						"cert=testdata/pki/certs/localhost.cert.pem",
+						"fork",
+						"verify",
+					},
+					",",
+				),
+			)
+			assert.Error(t, e)
+		},
+	)
+
+	t.Run(
+		"Negotiation",
+		func(t *testing.T) {
+			var a sak.NUt
+			var addr string = "127.13.37.1:8447"
+			var c *tls.Conn
+			var cs uint16 = tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+			var e error
+			var state tls.ConnectionState
+
+			a, e = sak.NewNUt(
+				strings.Join(
+					[]string{
+						"tls-l:" + addr,
+						"cert=testdata/pki/certs/localhost.cert.pem",
+						"ciphers=" + tls.CipherSuiteName(cs),
+						"curves=P-384",
+						"fork",
+						"key=testdata/pki/private/localhost.key.pem",
+						"maxver=1.2",
+						"minver=1.2",
+					},
+					",",
+				),
+			)
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = a.Down()
+			}()
+
+			// The client supports everything, so the listener decides
+			c, e = tls.Dial(
+				"tcp",
+				addr,
+				&tls.Config{
+					InsecureSkipVerify: true, //nolint:gosec // Test
+				},
+			)
+			assert.NoError(t, e)
+
+			if c == nil {
+				return
+			}
+
+			state = c.ConnectionState()
+			_ = c.Close()
+
+			assert.Equal(t, uint16(tls.VersionTLS12), state.Version)
+			assert.Equal(t, cs, state.CipherSuite)
+			assert.Equal(t, tls.CurveP384, state.CurveID)
+
+			// Clients outside of the allowed versions are rejected
+			_, e = tls.Dial(
+				"tcp",
+				addr,
+				&tls.Config{
+					InsecureSkipVerify: true, //nolint:gosec // Test
+					MinVersion:         tls.VersionTLS13,
+				},
+			)
+			assert.Error(t, e)
+		},
+	)
+
+	t.Run(
+		"Reload",
+		func(t *testing.T) {
+			var a sak.NUt
+			var addr string = "127.13.37.1:8445"
+			var e error
+
+			copyFile(
+				t,
+				"testdata/pki/certs/localhost.cert.pem",
+				"testdata/out_reload_cert",
+			)
+			copyFile(
+				t,
+				"testdata/pki/private/localhost.key.pem",
+				"testdata/out_reload_key",
+			)
+
+			// Create NUt
+			a, e = sak.NewNUt(
+				strings.Join(
+					[]string{
+						"tls-l:" + addr,
+						"cert=testdata/out_reload_cert",
+						"fork",
+						"key=testdata/out_reload_key",
+						"reload",
+					},
+					",",
+				),
+			)
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = a.Down()
+			}()
+
+			assert.Equal(t, "localhost", peerCN(t, addr))
+
+			// Rotate on disk
+			copyFile(
+				t,
+				"testdata/pki/certs/user.cert.pem",
+				"testdata/out_reload_cert",
+			)
+			copyFile(
+				t,
+				"testdata/pki/private/user.key.pem",
+				"testdata/out_reload_key",
+			)
+
+			assert.Equal(t, "user", peerCN(t, addr))
+
+			// Rotate cert before key, old pair should remain
+			copyFile(
+				t,
+				"testdata/pki/certs/localhost.cert.pem",
+				"testdata/out_reload_cert",
+			)
+
+			assert.Equal(t, "user", peerCN(t, addr))
+
+			//nolint:forcetypeassert // Testing interface
+			e = a.(sak.Reloader).Reload()
+			assert.Error(t, e)
+
+			assert.Equal(t, "user", peerCN(t, addr))
+
+			// Rotate on demand
+			copyFile(
+				t,
+				"testdata/pki/private/localhost.key.pem",
+				"testdata/out_reload_key",
+			)
+
+			//nolint:forcetypeassert // Testing interface
+			e = a.(sak.Reloader).Reload()
+			assert.NoError(t, e)
+
+			assert.Equal(t, "localhost", peerCN(t, addr))
+		},
+	)
+
+	t.Run(
+		"Resumption",
+		func(t *testing.T) {
+			var opts []string = []string{
+				"cert=testdata/pki/certs/localhost.cert.pem",
+				"fork",
+				"key=testdata/pki/private/localhost.key.pem",
+			}
+			var tests []struct {
+				opt     string
+				resumed bool
+			} = []struct {
+				opt     string
+				resumed bool
+			}{
+				{"tickets=on", true},
+				{"tickets=off", false},
+				{"ticket-rotate=1h", true},
+			}
+
+			for i, test := range tests {
+				var a sak.NUt
+				var addr string
+				var e error
+				var seed string
+				var stats map[string]uint64
+
+				addr = "127.13.37.1:" + strconv.Itoa(8480+i)
+				seed = "tls-l:" + addr + "," + strings.Join(opts, ",")
+
+				a, e = sak.NewNUt(seed + "," + test.opt)
+				assert.NoError(t, e)
+
+				e = a.Up()
+				assert.NoError(t, e)
+
+				assert.Equal(t, test.resumed, dialTwice(t, addr))
+
+				//nolint:forcetypeassert // Testing interface
+				stats = a.(sak.StatsReporter).Stats()
+				assert.Equal(t, uint64(2), stats["handshakes"])
+
+				if test.resumed {
+					assert.Equal(t, uint64(1), stats["resumed"])
+				}
+
+				e = a.Down()
+				assert.NoError(t, e)
+			}
+		},
+	)
+
+	t.Run(
+		"ResumptionInvalid",
+		func(t *testing.T) {
+			var e error
+
+			_, e = sak.NewNUt("tls:127.13.37.1:8443,tickets=off")
+			assert.Error(t, e)
+
+			_, e = sak.NewNUt("tls-l:127.13.37.1:8443,resume")
+			assert.Error(t, e)
+
+			_, e = sak.NewNUt(
+				strings.Join(
+					[]string{
+						"tls-l:127.13.37.1:8443",
+						"cert=testdata/pki/certs/localhost.cert.pem",
+						"key=testdata/pki/private/localhost.key.pem",
+						"ticket-rotate=asdf",
+					},
+					",",
+				),
+			)
+			assert.Error(t, e)
+
+			_, e = sak.NewNUt("tls:127.13.37.1:8443,resume")
+			assert.NoError(t, e)
+		},
+	)
+
+	sharedNetworkTests(
+		t,
+		"testdata/out_tls",
+		"tls:doesnotexist.asdf.com:8443",
+		strings.Join(
+			[]string{
+				"tls-listen:doesnotexist.asdf.com:8443",
+				"ca=testdata/pki/ca/ca.cert.pem",
+				"cert=testdata/pki/certs/localhost.cert.pem",
+				"fork",
+				"key=testdata/pki/private/localhost.key.pem",
+				"verify",
+			},
+			",",
+		),
+		"tls:127.13.37.1:8443,asdf",
+		"file:testdata/in",
+		strings.Join(
+			[]string{
+				"tls:127.13.37.1:8443",
+				"ca=testdata/pki/ca/ca.cert.pem",
+				"cert=testdata/pki/certs/user.cert.pem",
+				"key=testdata/pki/private/user.key.pem",
+			},
+			",",
+		),
+		strings.Join(
+			[]string{
+				"tls-l:127.13.37.1:8443",
+				"ca=testdata/pki/ca/ca.cert.pem",
+				"cert=testdata/pki/certs/localhost.cert.pem",
+				"curves=X25519:P-256",
+				"fork",
+				"key=testdata/pki/private/localhost.key.pem",
+				"minver=1.2",
+			},
+			",",
+		),
+		"file:testdata/out_tls,mode=write",
+	)
+}
+
+func TestTLSInfoNUt(t *testing.T) {
+	var a sak.NUt
+	var addr string = "127.13.37.1:8446"
+	var e error
+
+	// Create listener
+	a, e = sak.NewNUt(
+		strings.Join(
+			[]string{
+				"tls-l:" + addr,
+				"alpn=h2:http/1.1",
+				"cert=testdata/pki/certs/localhost.cert.pem",
+				"fork",
+				"key=testdata/pki/private/localhost.key.pem",
+			},
+			",",
+		),
+	)
+	assert.NoError(t, e)
+
+	e = a.Up()
+	assert.NoError(t, e)
+
+	defer func() {
+		_ = a.Down()
+	}()
+
+	t.Run(
+		"JSON",
+		func(t *testing.T) {
+			var b []byte
+			var e error
+			var info sak.TLSInfo
+			var nut sak.NUt
+
+			nut, e = sak.NewNUt("tls-info:" + addr + ",alpn=h2,json")
+			assert.NoError(t, e)
+
+			e = nut.Up()
+			assert.NoError(t, e)
+
+			b, e = io.ReadAll(nut)
+			assert.NoError(t, e)
+
+			e = json.Unmarshal(b, &info)
+			assert.NoError(t, e)
+
+			assert.Equal(t, "h2", info.ALPN)
+			assert.Contains(t, info.SANs, "127.13.37.1")
+			assert.Contains(t, info.Subject, "CN=localhost")
+			assert.Len(t, info.Fingerprint, 64)
+		},
+	)
+
+	t.Run(
+		"Text",
+		func(t *testing.T) {
+			var b []byte
+			var e error
+			var nut sak.NUt
+			var ok bool
+			var state tls.ConnectionState
+
+			nut, e = sak.NewNUt("tls-info:" + addr + ",maxver=1.2")
+			assert.NoError(t, e)
+
+			e = nut.Up()
+			assert.NoError(t, e)
+
+			b, e = io.ReadAll(nut)
+			assert.NoError(t, e)
+			assert.Contains(t, string(b), "Version: TLS 1.2")
+
+			//nolint:forcetypeassert // Testing accessor
+			state, ok = nut.(*sak.TLSInfoNUt).ConnectionState()
+			assert.True(t, ok)
+			assert.Equal(t, uint16(tls.VersionTLS12), state.Version)
+
+			e = nut.Down()
+			assert.NoError(t, e)
+		},
+	)
+
+	t.Run(
+		"UnknownOption",
+		func(t *testing.T) {
+			var e error
+
+			_, e = sak.NewNUt("tls-info:" + addr + ",asdf")
+			assert.Error(t, e)
+		},
+	)
+}
+
+func TestTracer(t *testing.T) {
+	t.Run(
+		"Hexdump",
+		func(t *testing.T) {
+			var sb strings.Builder
+
+			sak.NewTracer(&sb, true).Log("label", []byte("hi\n"))
+
+			assert.Contains(t, sb.String(), " label length=3\n")
+			assert.True(
+				t,
+				strings.HasSuffix(
+					sb.String(),
+					hex.Dump([]byte("hi\n")),
+				),
+			)
+		},
+	)
+
+	t.Run(
+		"Hook",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var e error
+			var grErrs chan error = make(chan error, 1)
+			var in []byte
+			var sb strings.Builder
+
+			defer func() {
+				for e := range grErrs {
+					assert.NoError(t, e)
+				}
+			}()
+
+			sak.Trace = sak.NewTracer(&sb, false).Trace
+			defer func() {
+				sak.Trace = nil
+			}()
+
+			// Create NUts
+			a, e = sak.NewNUt("file:testdata/in")
+			assert.NoError(t, e)
+
+			b, e = sak.NewNUt("file:testdata/out_trace,mode=write")
+			assert.NoError(t, e)
+
+			// Pair NUts
+			go func() {
+				grErrs <- sak.Pair(a, b)
+
+				close(grErrs)
+			}()
+
+			// Wait
+			time.Sleep(time.Second)
+
+			// Stop NUts
+			e = a.Down()
+			assert.NoError(t, e)
+
+			e = b.Down()
+			assert.NoError(t, e)
+
+			compare(t, "testdata/out_trace")
+
+			in, e = os.ReadFile("testdata/in")
+			assert.NoError(t, e)
+
+			assert.Contains(
+				t,
+				sb.String(),
+				a.String()+" > "+b.String(),
+			)
+			assert.Contains(
+				t,
+				sb.String(),
+				strings.ReplaceAll(string(in), "\n", "\\n\n"),
+			)
+		},
+	)
+
+	t.Run(
+		"Text",
+		func(t *testing.T) {
+			var sb strings.Builder
+
+			sak.NewTracer(&sb, false).Log(
+				"label",
+				[]byte("a\\b\tc\r\n\x00"),
+			)
+
+			assert.Contains(t, sb.String(), " label length=8\n")
+			assert.True(
+				t,
+				strings.HasSuffix(
+					sb.String(),
+					"a\\\\b\\tc\\r\\n\n\\x00\n",
+				),
+			)
+		},
+	)
+}
+
+func TestUDPNUt(t *testing.T) {
+	t.Run(
+		"ACL",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b []byte = make([]byte, 16)
+			var e error
+			var n int
+			var src net.Addr
+
+			_, e = sak.NewNUt("udp:127.13.37.1:4444,deny=127.0.0.1")
+			assert.Error(t, e)
+
+			a, e = sak.NewNUt(
+				"udp-l:127.13.37.1:5390,deny=127.13.37.3",
+			)
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = a.Down()
+			}()
+
+			for _, local := range []string{
+				"127.13.37.3",
+				"127.13.37.2",
+			} {
+				var c *net.UDPConn
+
+				c, e = net.DialUDP(
+					"udp",
+					&net.UDPAddr{IP: net.ParseIP(local)},
+					&net.UDPAddr{
+						IP:   net.IPv4(127, 13, 37, 1),
+						Port: 5390,
+					},
+				)
+				assert.NoError(t, e)
+
+				_, e = c.Write([]byte(local))
+				assert.NoError(t, e)
+
+				_ = c.Close()
+			}
+
+			// Denied datagrams are dropped
+			//nolint:forcetypeassert // Testing interface
+			n, src, e = a.(sak.PacketNUt).ReadPacket(b)
+			assert.NoError(t, e)
+			assert.Equal(t, 0, n)
+			assert.Contains(t, src.String(), "127.13.37.3")
+
+			//nolint:forcetypeassert // Testing interface
+			n, _, e = a.(sak.PacketNUt).ReadPacket(b)
+			assert.NoError(t, e)
+			assert.Equal(t, "127.13.37.2", string(b[:n]))
+
+			//nolint:forcetypeassert // Testing interface
+			assert.Equal(
+				t,
+				uint64(1),
+				a.(sak.StatsReporter).Stats()["denied"],
+			)
+		},
+	)
+
+	t.Run(
+		"Bind",
+		func(t *testing.T) {
+			var a sak.NUt
+			var buf []byte = make([]byte, 64)
+			var e error
+			var from *net.UDPAddr
+			var l *net.UDPConn
+
+			_, e = sak.NewNUt("udp-l:127.13.37.1:5377,bind=127.0.0.1")
+			assert.Error(t, e)
+
+			// Address that isn't local can't be bound
+			a, e = sak.NewNUt("udp:127.13.37.1:5377,bind=192.0.2.254")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.Error(t, e)
+
+			l, e = net.ListenUDP(
+				"udp",
+				&net.UDPAddr{
+					IP:   net.IPv4(127, 13, 37, 1),
+					Port: 5377,
+				},
+			)
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = l.Close()
+			}()
+
+			a, e = sak.NewNUt(
+				"udp:127.13.37.1:5377,bind=127.13.37.2:5378",
+			)
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = a.Down()
+			}()
+
+			_, e = a.Write([]byte("hello"))
+			assert.NoError(t, e)
+
+			_ = l.SetReadDeadline(time.Now().Add(time.Second))
+
+			_, from, e = l.ReadFromUDP(buf)
+			assert.NoError(t, e)
+
+			if from != nil {
+				assert.Equal(t, "127.13.37.2:5378", from.String())
+			}
+		},
+	)
+
+	t.Run(
+		"Broadcast",
+		func(t *testing.T) {
+			var a sak.NUt
+			var buf []byte = make([]byte, 64)
+			var c *net.UDPConn
+			var e error
+			var n int
+
+			_, e = sak.NewNUt("udp-bcast:5361,loop")
+			assert.Error(t, e)
+
+			a, e = sak.NewNUt("udp-bcast:127.255.255.255:5361")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = a.Down()
+			}()
+
+			c, e = net.DialUDP(
+				"udp",
+				nil,
+				&net.UDPAddr{
+					IP:   net.IPv4(127, 255, 255, 255),
+					Port: 5361,
+				},
+			)
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = c.Close()
+			}()
+
+			// Our own broadcasts should be ignored
+			_, e = a.Write([]byte("ignored"))
+			assert.NoError(t, e)
+
+			time.Sleep(100 * time.Millisecond)
+
+			_, e = c.Write([]byte("hello"))
+			assert.NoError(t, e)
+
+			for n == 0 {
+				n, e = a.Read(buf)
+				assert.NoError(t, e)
+			}
+
+			assert.Equal(t, "hello", string(buf[:n]))
+		},
+	)
+
+	t.Run(
+		"Families",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var buf []byte = make([]byte, 64)
+			var e error
+			var n int
+
+			for _, seed := range []string{
+				"udp-bcast:5372,pf=ip4",
+				"udp-mcast:[ff02::1]:5372,pf=ip6",
+				"udp4-l:[::1]:5372,pf=ip6",
+			} {
+				_, e = sak.NewNUt(seed)
+				assert.Error(t, e)
+			}
+
+			// Create NUts
+			a, e = sak.NewNUt("udp6-l:[::1]:5372,echo")
+			assert.NoError(t, e)
+			assert.Equal(t, "udp6-listen", a.Type())
+
+			b, e = sak.NewNUt("udp:[::1]:5372,pf=ip6")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = a.Down()
+			}()
+
+			e = b.Up()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = b.Down()
+			}()
+
+			_, e = b.Write([]byte("hello"))
+			assert.NoError(t, e)
+
+			// Listener echoes as it reads
+			n, e = a.Read(buf)
+			assert.NoError(t, e)
+			assert.Equal(t, "hello", string(buf[:n]))
+
+			n, e = b.Read(buf)
+			assert.NoError(t, e)
+			assert.Equal(t, "hello", string(buf[:n]))
+		},
+	)
+
+	t.Run(
+		"Fork",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var backend *net.UDPConn
+			var clients []*net.UDPConn
+			var count int
+			var e error
+			var grErrs chan error = make(chan error, 1)
+			var ok bool
+			var peers sync.Map
+			var stats sak.StatsReporter
+
+			defer func() {
+				for e := range grErrs {
+					assert.NoError(t, e)
+				}
+			}()
+
+			// Backend that replies with the client's source port
+			backend, e = net.ListenUDP(
+				"udp",
+				&net.UDPAddr{
+					IP:   net.IPv4(127, 13, 37, 1),
+					Port: 5357,
+				},
+			)
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = backend.Close()
+			}()
+
+			go func() {
+				var b []byte = make([]byte, 64)
+				var e error
+				var from *net.UDPAddr
+				var n int
+
+				for {
+					n, from, e = backend.ReadFromUDP(b)
+					if e != nil {
+						return
+					}
+
+					peers.Store(from.Port, true)
+
+					_, _ = backend.WriteToUDP(b[:n], from)
+				}
+			}()
+
+			// Create NUts
+			a, e = sak.NewNUt("udp-l:127.13.37.1:5356,fork")
+			assert.NoError(t, e)
+
+			// No sessions until the listener is up
+			//nolint:forcetypeassert // Testing interface
+			_, ok = <-a.(sak.Forker).Sessions()
+			assert.False(t, ok)
+
+			b, e = sak.NewNUt("udp:127.13.37.1:5357")
+			assert.NoError(t, e)
+
+			// Pair NUts
+			go func() {
+				grErrs <- sak.Pair(a, b)
+
+				close(grErrs)
+			}()
+
+			time.Sleep(100 * time.Millisecond)
+
+			for _, msg := range []string{"first", "second"} {
+				var c *net.UDPConn
+
+				c, e = net.DialUDP(
+					"udp",
+					nil,
+					&net.UDPAddr{
+						IP:   net.IPv4(127, 13, 37, 1),
+						Port: 5356,
+					},
+				)
+				assert.NoError(t, e)
+
+				_, e = c.Write([]byte(msg))
+				assert.NoError(t, e)
+
+				clients = append(clients, c)
+			}
+
+			// Each client should get its own reply
+			for i, msg := range []string{"first", "second"} {
+				var buf []byte = make([]byte, 64)
+				var n int
+
+				_ = clients[i].SetReadDeadline(
+					time.Now().Add(time.Second),
+				)
+
+				n, e = clients[i].Read(buf)
+				assert.NoError(t, e)
+				assert.Equal(t, msg, string(buf[:n]))
+
+				_ = clients[i].Close()
+			}
+
+			// Each client should have its own backend socket
+			peers.Range(
+				func(_ any, _ any) bool {
+					count++
+					return true
+				},
+			)
+			assert.Equal(t, 2, count)
+
+			stats, ok = a.(sak.StatsReporter)
+			assert.True(t, ok)
+			assert.Equal(t, uint64(2), stats.Stats()["sessions"])
+
+			// Stop NUts
+			e = a.Down()
+			assert.NoError(t, e)
+		},
+	)
+
+	t.Run(
+		"ForkUnanswered",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var backend *net.UDPConn
+			var clients []*net.UDPConn
+			var e error
+			var grErrs chan error = make(chan error, 1)
+
+			defer func() {
+				for e := range grErrs {
+					assert.NoError(t, e)
+				}
+			}()
+
+			// Backend that never answers some requests, like a DNS
+			// server dropping queries
+			backend, e = net.ListenUDP(
+				"udp",
+				&net.UDPAddr{
+					IP:   net.IPv4(127, 13, 37, 1),
+					Port: 5399,
+				},
+			)
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = backend.Close()
+			}()
+
+			go func() {
+				var b []byte = make([]byte, 64)
+				var e error
+				var from *net.UDPAddr
+				var n int
+
+				for {
+					n, from, e = backend.ReadFromUDP(b)
+					if e != nil {
+						return
+					}
+
+					if string(b[:n]) != "drop" {
+						_, _ = backend.WriteToUDP(b[:n], from)
+					}
+				}
+			}()
+
+			// Create NUts
+			a, e = sak.NewNUt("udp-l:127.13.37.1:5398,fork")
+			assert.NoError(t, e)
+
+			b, e = sak.NewNUt("udp:127.13.37.1:5399")
+			assert.NoError(t, e)
+
+			// Pair NUts
+			go func() {
+				grErrs <- sak.Pair(a, b)
+
+				close(grErrs)
+			}()
+
+			time.Sleep(100 * time.Millisecond)
+
+			for range 2 {
+				var c *net.UDPConn
+
+				c, e = net.DialUDP(
+					"udp",
+					nil,
+					&net.UDPAddr{
+						IP:   net.IPv4(127, 13, 37, 1),
+						Port: 5398,
+					},
+				)
+				assert.NoError(t, e)
+
+				clients = append(clients, c)
+			}
+
+			// The first request is never answered
+			for i, msg := range []string{"drop", "second", "first"} {
+				var buf []byte = make([]byte, 64)
+				var c *net.UDPConn = clients[i%2]
+				var n int
+
+				_, e = c.Write([]byte(msg))
+				assert.NoError(t, e)
+
+				if msg == "drop" {
+					continue
+				}
+
+				_ = c.SetReadDeadline(time.Now().Add(time.Second))
+
+				n, e = c.Read(buf)
+				assert.NoError(t, e)
+				assert.Equal(t, msg, string(buf[:n]))
+			}
+
+			// Nothing else should arrive for either client
+			for _, c := range clients {
+				_ = c.SetReadDeadline(
+					time.Now().Add(100 * time.Millisecond),
+				)
+
+				_, e = c.Read(make([]byte, 64))
+				assert.Error(t, e)
+
+				_ = c.Close()
+			}
+
+			// Stop NUts
+			e = a.Down()
+			assert.NoError(t, e)
+		},
+	)
+
+	t.Run(
+		"InvalidTimeout",
+		func(t *testing.T) {
+			var e error
+
+			_, e = sak.NewNUt("udp-l:127.13.37.1:5353,timeout=asdf")
+			assert.Error(t, e)
+
+			_, e = sak.NewNUt("udp:127.13.37.1:5353,timeout=1s")
+			assert.Error(t, e)
+		},
+	)
+
+	t.Run(
+		"Multicast",
+		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var buf []byte = make([]byte, 64)
+			var e error
+			var n int
+			var seed string = "udp-mcast:239.13.37.1:5360"
+
+			for _, bad := range []string{
+				"udp-mcast:5360",
+				"udp-mcast:239.13.37.1:5360,echo",
+				"udp-mcast:239.13.37.1:5360,ttl=256",
+				"udp-mcast:239.13.37.1:5360,ttl=asdf",
+			} {
+				_, e = sak.NewNUt(bad)
+				assert.Error(t, e)
+			}
+
+			// Not a multicast group
+			a, e = sak.NewNUt("udp-mcast:127.13.37.1:5360")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.Error(t, e)
+
+			// Unknown interface
+			a, e = sak.NewNUt("udp-mcast:239.13.37.1:5360,iface=asdf")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.Error(t, e)
+
+			// Socket options are applied when the socket is created
+			a, e = sak.NewNUt(
+				"udp-mcast:239.13.37.1:5360,bind-device=asdf0",
+			)
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.ErrorContains(t, e, "bind-device asdf0")
+
+			// Create NUts
+			seed += ",iface=lo,loop"
+
+			a, e = sak.NewNUt(seed + ",ttl=0")
+			assert.NoError(t, e)
+
+			b, e = sak.NewNUt(seed + ",bind-device=lo,reuseaddr")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = a.Down()
+			}()
+
+			e = b.Up()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = b.Down()
+			}()
+
+			// Datagram sent to group should be received by members
+			_, e = a.Write([]byte("hello"))
+			assert.NoError(t, e)
+
+			for n == 0 {
+				n, e = b.Read(buf)
+				assert.NoError(t, e)
+			}
+
+			assert.Equal(t, "hello", string(buf[:n]))
+
+			// Our own datagrams should be ignored, despite loop
+			_, e = b.Write([]byte("world"))
+			assert.NoError(t, e)
+
+			n = 0
+			for n == 0 {
+				n, e = a.Read(buf)
+				assert.NoError(t, e)
+			}
+
+			assert.Equal(t, "world", string(buf[:n]))
 		},
 	)
 
 	t.Run(
-		"InvalidKey",
+		"NoClient",
 		func(t *testing.T) {
+			var a sak.NUt
 			var e error
 
-			// Create NUt
-			_, e = sak.NewNUt(
-				strings.Join(
-					[]string{
-						"tls:127.13.37.1:8443",
-						"key=/noexist",
-					},
-					",",
-				),
-			)
+			a, e = sak.NewNUt("udp-l:127.13.37.1:5400")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = a.Down()
+			}()
+
+			// Replies with nowhere to go are not silently dropped
+			_, e = a.Write([]byte("hello"))
 			assert.Error(t, e)
 		},
 	)
 
 	t.Run(
-		"MissingCA",
+		"Packets",
 		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var backend *net.UDPConn
+			var buf []byte = make([]byte, 64*1024)
+			var c *net.UDPConn
 			var e error
+			var grErrs chan error = make(chan error, 1)
+			var msg []byte = bytes.Repeat([]byte("a"), 40000)
+			var n int
+			var sizes chan int = make(chan int, 4)
 
-			// Create NUt
-			_, e = sak.NewNUt(
-				strings.Join(
-					[]string{
-						"tls-l:127.13.37.1:8443",
-						"cert=testdata/pki/certs/localhost.cert.pem",
-						"fork",
-						"key=testdata/pki/private/localhost.key.pem",
-						"verify",
-					},
-					",",
-				),
+			defer func() {
+				for e := range grErrs {
+					assert.NoError(t, e)
+				}
+			}()
+
+			// Backend that reports datagram sizes and echoes
+			backend, e = net.ListenUDP(
+				"udp",
+				&net.UDPAddr{
+					IP:   net.IPv4(127, 13, 37, 1),
+					Port: 5359,
+				},
 			)
-			assert.Error(t, e)
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = backend.Close()
+			}()
+
+			go func() {
+				var b []byte = make([]byte, 64*1024)
+				var e error
+				var from *net.UDPAddr
+				var n int
+
+				for {
+					n, from, e = backend.ReadFromUDP(b)
+					if e != nil {
+						return
+					}
+
+					sizes <- n
+
+					_, _ = backend.WriteToUDP(b[:n], from)
+				}
+			}()
+
+			// Create NUts
+			a, e = sak.NewNUt("udp-l:127.13.37.1:5358")
+			assert.NoError(t, e)
+
+			b, e = sak.NewNUt("udp:127.13.37.1:5359")
+			assert.NoError(t, e)
+
+			// Pair NUts
+			go func() {
+				grErrs <- sak.Pair(a, b)
+
+				close(grErrs)
+			}()
+
+			time.Sleep(100 * time.Millisecond)
+
+			c, e = net.DialUDP(
+				"udp",
+				nil,
+				&net.UDPAddr{
+					IP:   net.IPv4(127, 13, 37, 1),
+					Port: 5358,
+				},
+			)
+			assert.NoError(t, e)
+
+			defer func() {
+				_ = c.Close()
+			}()
+
+			// Oversized datagram should not be split
+			_, e = c.Write(msg)
+			assert.NoError(t, e)
+
+			select {
+			case n = <-sizes:
+				assert.Equal(t, len(msg), n)
+			case <-time.After(time.Second):
+				assert.Fail(t, "backend never received datagram")
+			}
+
+			_ = c.SetReadDeadline(time.Now().Add(time.Second))
+
+			n, e = c.Read(buf)
+			assert.NoError(t, e)
+			assert.Equal(t, len(msg), n)
+
+			// Stop NUts
+			e = a.Down()
+			assert.NoError(t, e)
+
+			e = b.Down()
+			assert.NoError(t, e)
 		},
 	)
 
 	t.Run(
-		"MissingCert",
+		"Sessions",
 		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
+			var backend *net.UDPConn
+			var clients []*net.UDPConn
 			var e error
+			var grErrs chan error = make(chan error, 1)
 
-			// Create NUt
-			_, e = sak.NewNUt(
-				strings.Join(
-					[]string{
-						"tls:127.13.37.1:8443",
-						"key=testdata/pki/private/localhost.key.pem",
-					},
-					",",
-				),
+			defer func() {
+				for e := range grErrs {
+					assert.NoError(t, e)
+				}
+			}()
+
+			// Backend that echoes each request
+			backend, e = net.ListenUDP(
+				"udp",
+				&net.UDPAddr{
+					IP:   net.IPv4(127, 13, 37, 1),
+					Port: 5355,
+				},
 			)
-			assert.Error(t, e)
+			assert.NoError(t, e)
 
-			_, e = sak.NewNUt(
-				strings.Join(
-					[]string{
-						"tls-l:127.13.37.1:8443",
-						"ca=testdata/pki/ca/ca.cert.pem",
-						"fork",
-						"key=testdata/pki/private/localhost.key.pem",
-						"verify",
+			defer func() {
+				_ = backend.Close()
+			}()
+
+			go func() {
+				var b []byte = make([]byte, 64)
+				var e error
+				var from *net.UDPAddr
+				var n int
+
+				for {
+					n, from, e = backend.ReadFromUDP(b)
+					if e != nil {
+						return
+					}
+
+					_, _ = backend.WriteToUDP(b[:n], from)
+				}
+			}()
+
+			// Create NUts
+			a, e = sak.NewNUt("udp-l:127.13.37.1:5354,timeout=1s")
+			assert.NoError(t, e)
+
+			b, e = sak.NewNUt("udp:127.13.37.1:5355")
+			assert.NoError(t, e)
+
+			// Pair NUts
+			go func() {
+				grErrs <- sak.Pair(a, b)
+
+				close(grErrs)
+			}()
+
+			time.Sleep(100 * time.Millisecond)
+
+			for range 2 {
+				var c *net.UDPConn
+
+				c, e = net.DialUDP(
+					"udp",
+					nil,
+					&net.UDPAddr{
+						IP:   net.IPv4(127, 13, 37, 1),
+						Port: 5354,
 					},
-					",",
-				),
+				)
+				assert.NoError(t, e)
+
+				clients = append(clients, c)
+			}
+
+			// Even without fork, overlapping clients each get their
+			// own reply
+			for i, msg := range []string{"first", "second"} {
+				_, e = clients[i].Write([]byte(msg))
+				assert.NoError(t, e)
+			}
+
+			for i, msg := range []string{"first", "second"} {
+				var buf []byte = make([]byte, 64)
+				var n int
+
+				_ = clients[i].SetReadDeadline(
+					time.Now().Add(time.Second),
+				)
+
+				n, e = clients[i].Read(buf)
+				assert.NoError(t, e)
+				assert.Equal(t, msg, string(buf[:n]))
+			}
+
+			for _, c := range clients {
+				_ = c.Close()
+			}
+
+			//nolint:forcetypeassert // Testing interface
+			assert.Equal(
+				t,
+				uint64(2),
+				a.(sak.StatsReporter).Stats()["sessions"],
 			)
-			assert.Error(t, e)
+
+			// Stop NUts
+			e = a.Down()
+			assert.NoError(t, e)
+
+			e = b.Down()
+			assert.NoError(t, e)
 		},
 	)
 
 	t.Run(
-		"MissingKey",
+		"SockOpts",
 		func(t *testing.T) {
+			var a sak.NUt
+			var b sak.NUt
 			var e error
 
-			// Create NUt
-			_, e = sak.NewNUt(
-				strings.Join(
-					[]string{
-						"tls:127.13.37.1:8443",
-						"cert=testdata/pki/certs/localhost.cert.pem",
-					},
-					",",
-				),
-			)
-			assert.Error(t, e)
+			// Stream only options
+			for _, seed := range []string{
+				"udp:127.13.37.1:4444,keepalive=10s",
+				"udp:127.13.37.1:4444,linger=0",
+				"udp-l:127.13.37.1:4444,nodelay",
+			} {
+				_, e = sak.NewNUt(seed)
+				assert.Error(t, e)
+			}
 
-			_, e = sak.NewNUt(
-				strings.Join(
-					[]string{
-						"tls-l:127.13.37.1:8443",
-						"ca=testdata/pki/ca/ca.cert.pem",
-						"cert=testdata/pki/certs/localhost.cert.pem",
-						"fork",
-						"verify",
-					},
-					",",
-				),
+			if runtime.GOOS == "windows" {
+				t.Skip("reuseport is not supported on windows")
+			}
+
+			a, e = sak.NewNUt(
+				"udp-l:127.13.37.1:5383,reuseport,ttl=9",
 			)
-			assert.Error(t, e)
-		},
-	)
+			assert.NoError(t, e)
 
-	sharedNetworkTests(
-		t,
-		"testdata/out_tls",
-		"tls:doesnotexist.asdf.com:8443",
-		strings.Join(
-			[]string{
-				"tls-listen:doesnotexist.asdf.com:8443",
-				"ca=testdata/pki/ca/ca.cert.pem",
-				"cert=testdata/pki/certs/localhost.cert.pem",
-				"fork",
-				"key=testdata/pki/private/localhost.key.pem",
-				"verify",
-			},
-			",",
-		),
-		"tls:127.13.37.1:8443,asdf",
-		"file:testdata/in",
-		strings.Join(
-			[]string{
-				"tls:127.13.37.1:8443",
-				"ca=testdata/pki/ca/ca.cert.pem",
-				"cert=testdata/pki/certs/user.cert.pem",
-				"key=testdata/pki/private/user.key.pem",
-			},
-			",",
-		),
-		strings.Join(
-			[]string{
-				"tls-l:127.13.37.1:8443",
-				"ca=testdata/pki/ca/ca.cert.pem",
-				"cert=testdata/pki/certs/localhost.cert.pem",
-				"fork",
-				"key=testdata/pki/private/localhost.key.pem",
-			},
-			",",
-		),
-		"file:testdata/out_tls,mode=write",
+			b, e = sak.NewNUt("udp-l:127.13.37.1:5383,reuseport")
+			assert.NoError(t, e)
+
+			e = a.Up()
+			assert.NoError(t, e)
+
+			e = b.Up()
+			assert.NoError(t, e)
+
+			_ = a.Down()
+			_ = b.Down()
+		},
 	)
-}
 
-func TestUDPNUt(t *testing.T) {
 	sharedNetworkTests(
 		t,
 		"testdata/out_udp",
@@ -588,6 +4419,12 @@ func TestUnknownSeeds(t *testing.T) {
 	_, e = sak.NewFileNUt("asdf:")
 	assert.Error(t, e)
 
+	_, e = sak.NewReplayNUt("asdf:")
+	assert.Error(t, e)
+
+	_, e = sak.NewStartTLSNUt("asdf:")
+	assert.Error(t, e)
+
 	_, e = sak.NewStdioNUt("asdf:")
 	assert.Error(t, e)
 
@@ -597,6 +4434,9 @@ func TestUnknownSeeds(t *testing.T) {
 	_, e = sak.NewTLSNUt("asdf:")
 	assert.Error(t, e)
 
+	_, e = sak.NewTLSInfoNUt("asdf:")
+	assert.Error(t, e)
+
 	_, e = sak.NewUDPNUt("asdf:")
 	assert.Error(t, e)
 }
@@ -22,9 +22,10 @@
 //	}
 //
 // This will create a TCP listener on port 4444 that forks each new
-// connection. Any received data will be written to STDOUT. The
-// Network Utilities (NUts) are created from seeds. Below are the
-// supported SEED TYPES along with their documentation:
+// connection. Data received from every client will be written to
+// STDOUT (see Forking below). The Network Utilities (NUts) are
+// created from seeds. Below are the supported SEED TYPES along with
+// their documentation:
 //
 // FILE:addr[,mode=(append|read|write)]
 //
@@ -32,75 +33,410 @@
 // filename. This seed is used to read or write a file on disk. The
 // default mode is read.
 //
+// REPLAY:addr[,side=(client|server),speed=NUM[x]]
+//
+// This seed takes an address that is the filename of a recording
+// (see Recording below). This seed is used to play back one side of
+// a recorded session, which is the server side by default, so that a
+// real conversation can be used as a mock. Each chunk of the
+// replayed side is sent once the peer has sent at least as much data
+// as the other side had sent before it, and then after the same
+// delay as in the recording. The speed option divides the delays, so
+// speed=2x plays back twice as fast. Data from the peer is only
+// counted, not compared. The replay ends after the last chunk of the
+// replayed side.
+//
+// STARTTLS-FTP:addr[,TLS options]
+//
+// STARTTLS-IMAP:addr[,TLS options]
+//
+// STARTTLS-POSTGRES:addr[,TLS options]
+//
+// STARTTLS-SMTP:addr[,TLS options]
+//
+// These seeds take an address of the form [IP:]PORT. These seeds are
+// used to make an outgoing plaintext connection, speak the protocol
+// far enough to request an upgrade (AUTH TLS, STARTTLS, or an
+// SSLRequest), and then perform a TLS handshake. All options
+// supported by the TLS seed are also supported. This is useful for
+// debugging TLS on mail and database servers.
+//
 // STDIO:
 //
 // Aliases: -, STDIN, STDOUT
 //
-// This seed takes no address or options. It can be used to read from
-// stdin or write to stdout.
+// This seed takes no address, and no options other than limits (see
+// below). It can be used to read from stdin or write to stdout.
 //
-// TCP:addr
+// TCP:addr[,backoff=(exp|fixed),bind=IP[:PORT],
+// connect-timeout=DURATION,frame=(len16|len32),max=DURATION,
+// pf=(ip4|ip6),retry=NUM,socket options]
 //
 // This seed takes an address of the form [IP:]PORT. The IP is
-// optional and defaults to 0.0.0.0 or [::]. This seed is used to make
-// an outgoing TCP connection.
+// optional and defaults to all local addresses. IPv6 addresses must
+// be enclosed in brackets and may include a zone (for example
+// [::1]:4444 or [fe80::1%eth0]:4444). This seed is used to make an
+// outgoing TCP connection. The pf option restricts the connection to
+// IPv4 (ip4) or IPv6 (ip6), which can also be done by using the TCP4
+// or TCP6 seed. If a hostname resolves to several addresses, they are
+// all logged. Connections use the fallback of the Go dialer (as in
+// RFC 6555, not the full RFC 8305): addresses of the first family
+// returned are tried first, and if none has connected after 250ms,
+// the other family is tried in parallel. Within each family, the
+// addresses are tried in order, and the next one is tried if one
+// fails. The hostname is resolved again on every reconnect, so DNS
+// changes are picked up. The bind option takes a local address to
+// connect from, which is useful on multi-homed hosts. It follows the
+// same rules as listener addresses, and a bare IP will use any
+// available port. Binding a port below 1024 requires privileges. The
+// frame option prefixes each datagram with its length (as a 16 or 32
+// bit big-endian integer), so that datagrams keep their boundaries
+// when tunneled over the stream. The far end must use the same frame
+// option, and frames over 64KiB are rejected as invalid. This allows
+// UDP traffic (such as DNS or WireGuard) to be forwarded through TCP
+// or TLS-only networks, by pairing a UDP seed with a framed stream
+// seed on each end. The connect-timeout option limits how long each
+// connection attempt can take. By default, a failed connection is
+// retried every second, forever. The retry option limits the number
+// of retries (0 fails immediately), after which the error is
+// returned. The backoff option determines the delay between retries.
+// Exponential backoff (exp) doubles the delay after each failure,
+// with jitter, up to max (default 30s).
 //
-// TCP-LISTEN:addr[,echo,fork]
+// TCP-LISTEN:addr[,echo,fork,frame=(len16|len32),pf=(ip4|ip6),
+// access control,connection limits,socket options]
 //
 // Aliases: TCP-L
 //
 // This seed takes an address of the form [IP:]PORT. The IP is
-// optional and defaults to 0.0.0.0 or [::]. This seed is used to
-// listen on the provided TCP address. The echo option causes the TCP
-// listener to echo the response back to the client. The fork option
-// causes the TCP listener to accept multiple connections in parallel.
+// optional and defaults to all local addresses (both IPv4 and IPv6,
+// when available). This seed is used to listen on the provided TCP
+// address. The echo option causes the TCP listener to echo the
+// response back to the client. The fork option causes the TCP
+// listener to accept multiple connections in parallel (see Forking
+// below). The frame and pf options behave the same as for the TCP
+// seed. The TCP4-LISTEN and TCP6-LISTEN seeds only listen on IPv4 or
+// IPv6.
 //
-// TLS:addr[,ca=PATH,cert=PATH,key=PATH,verify]
+// TLS:addr[,alpn=LIST,backoff=(exp|fixed),bind=IP[:PORT],ca=PATH,
+// cert=PATH,ciphers=LIST,connect-timeout=DURATION,curves=LIST,
+// frame=(len16|len32),key=PATH,keylog=PATH,max=DURATION,maxver=VER,
+// minver=VER,pf=(ip4|ip6),reload,resume,retry=NUM,verify,
+// socket options]
 //
 // This seed takes an address of the form [IP:]PORT. The IP is
-// optional and defaults to 0.0.0.0 or [::]. This seed is used to make
-// an outgoing TLS connection. The ca, cert, and key options take a
-// filepath (DER or PEM formatted). The verify option determines if
+// optional and defaults to all local addresses. This seed is used to
+// make an outgoing TLS connection. The ca, cert, and key options take
+// a filepath (DER or PEM formatted). The verify option determines if
 // the server-side CA should be verified. The cert and key options
 // must be used together. If verify is specified, a ca must also be
-// specified.
+// specified. The minver and maxver options take a TLS version (1.0,
+// 1.1, 1.2, or 1.3). The ciphers and curves options take a
+// colon-separated list of names known to Go (for example
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 or X25519:P-256). Go does not
+// allow configuring TLS 1.3 cipher suites, so ciphers only applies to
+// TLS 1.2 and earlier. The keylog option takes a filepath where TLS
+// secrets will be appended in NSS key log format, for use with tools
+// like Wireshark. If keylog is not specified, the SSLKEYLOGFILE
+// environment variable is honored. Anyone with this file can decrypt
+// the traffic, so it is restricted to owner-only permissions. The
+// reload option causes the ca, cert, and key files to be re-read
+// whenever they change on disk. New connections will use the new
+// files, while existing connections are unaffected. Sending SIGHUP to
+// sak will also force a reload. The alpn option takes a
+// colon-separated list of protocols to offer (for example
+// h2:http/1.1). Details of each handshake are logged at debug level.
+// The resume option caches session tickets so that reconnects can
+// resume the previous session rather than doing a full handshake. The
+// backoff, bind, connect-timeout, frame, max, pf, and retry options
+// behave the same as for the TCP seed, as does hostname resolution.
+//
+// TLS-INFO:addr[,json,TLS options]
 //
-// TLS-LISTEN:addr[,ca=PATH,cert=PATH,echo,fork,key=PATH,verify]
+// This seed takes an address of the form [IP:]PORT. This seed is
+// used to make an outgoing TLS connection, report the details of the
+// handshake, and then exit. The details include the version, cipher
+// suite, ALPN protocol, whether or not the session was resumed, and
+// the peer certificate subject, issuer, SANs, and SHA-256
+// fingerprint. The json option causes the details to be formatted as
+// JSON. All options supported by the TLS seed are also supported. A
+// failed connection is not retried, unless the retry option is
+// provided.
+//
+// TLS-LISTEN:addr[,allow-cn=LIST,allow-ou=LIST,allow-san=LIST,
+// alpn=LIST,ca=PATH,cert=PATH,ciphers=LIST,crl=PATH,curves=LIST,echo,
+// fork,frame=(len16|len32),key=PATH,keylog=PATH,maxver=VER,
+// minver=VER,pf=(ip4|ip6),reload,ticket-rotate=DURATION,
+// tickets=(on|off),verify,access control,connection limits,
+// socket options]
 //
 // Aliases: TLS-L
 //
 // This seed takes an address of the form [IP:]PORT. The IP is
-// optional and defaults to 0.0.0.0 or [::]. This seed is used to
-// listen on the provided TCP address. The ca, cert, and key options
-// take a filepath (DER or PEM formatted). The echo option causes the
-// TLS listener to echo the response back to the client. The fork
-// option causes the TLS listener to accept multiple connections in
-// parallel. The verify option determines if the client-side
-// certificate should be verified. The cert and key options are
-// mandatory. If verify is specified, a ca must also be specified.
+// optional and defaults to all local addresses (both IPv4 and IPv6,
+// when available). This seed is used to listen on the provided TCP
+// address. The ca, cert, and key options take a filepath (DER or PEM
+// formatted). The echo option causes the TLS listener to echo the
+// response back to the client. The fork option causes the TLS
+// listener to accept multiple connections in parallel (see Forking
+// below). The verify option determines if the client-side certificate
+// should be verified. The cert and key options are mandatory. If
+// verify is specified, a ca must also be specified. The alpn,
+// ciphers, curves, frame, keylog, maxver, minver, pf, and reload
+// options behave the same as for the TLS seed. Reloading certs does
+// not drop the listener. The allow-cn, allow-ou, and allow-san
+// options take a colon-separated list of glob patterns (for example
+// allow-cn=web*:db01). Verified clients are only accepted if their
+// cert matches at least one pattern for each of the provided options.
+// The crl option takes a filepath to a certificate revocation list
+// (DER or PEM formatted), signed by the ca, and rejects any client
+// whose cert has been revoked. Once the crl is past its next update,
+// all clients are rejected until it is replaced (see reload). These
+// options require verify. Rejected clients are logged with the
+// reason. The tickets option determines whether or not session
+// tickets are issued to clients for resumption (default on). The
+// ticket-rotate option takes a duration (for example 1h) after which
+// a new session ticket key is generated. Tickets issued with the
+// previous key are still accepted until the next rotation. The number
+// of handshakes, and how many of them were resumed, are included in
+// the stats that sak reports at debug level.
 //
-// UDP:addr
+// UDP:addr[,backoff=(exp|fixed),bind=IP[:PORT],
+// connect-timeout=DURATION,max=DURATION,pf=(ip4|ip6),retry=NUM,
+// socket options]
 //
 // This seed takes an address of the form [IP:]PORT. The IP is
-// optional and defaults to 0.0.0.0 or [::]. This seed is used to make
-// an outgoing UDP connection.
+// optional and defaults to all local addresses. This seed is used to
+// make an outgoing UDP connection. The backoff, bind,
+// connect-timeout, max, pf, and retry options behave the same as for
+// the TCP seed, and the UDP4 and UDP6 seeds are also available. When
+// paired with another datagram seed (such as UDP-LISTEN), each
+// datagram is relayed whole, so message boundaries are preserved and
+// large datagrams are not split.
 //
-// UDP-LISTEN:addr[,echo]
+// UDP-BCAST:addr[,socket options]
+//
+// This seed takes an address of the form [IP:]PORT. The IP is
+// optional and defaults to 255.255.255.255. This seed is used to
+// receive broadcast datagrams sent to the provided port, and to
+// broadcast datagrams to the provided address. Datagrams that this
+// seed broadcasts are not read back.
+//
+// UDP-LISTEN:addr[,echo,fork,pf=(ip4|ip6),timeout=DURATION,
+// access control,socket options]
 //
 // Aliases: UDP-L
 //
 // This seed takes an address of the form [IP:]PORT. The IP is
-// optional and defaults to 0.0.0.0 or [::]. This seed is used to
-// listen on the provided UDP address. The echo option causes the UDP
-// listener to echo the response back to the client.
+// optional and defaults to all local addresses (both IPv4 and IPv6,
+// when available). This seed is used to listen on the provided UDP
+// address. The pf option behaves the same as for the TCP seed, and
+// the UDP4-LISTEN and UDP6-LISTEN seeds are also available. The echo
+// option causes the UDP listener to echo the response back to the
+// client. Each remote address is tracked as its own session, which
+// expires after being idle for the provided timeout (default 30s).
+// When paired, each session is paired with its own new instance of
+// the other NUt (for example its own UDP socket to a backend), so
+// that replies are mapped back to the correct client like a NAT
+// table, even without fork (see Forking below). This allows several
+// clients to share the listener (such as when forwarding DNS or
+// syslog). The fork option only changes how sessions are limited
+// (see Limits below). When the listener is read directly, replies are
+// sent to the client that sent the most recent datagram. Sessions are
+// counted in the stats that sak reports at debug level.
+//
+// UDP-MCAST:addr[,iface=NAME,loop,ttl=NUM,socket options]
+//
+// This seed takes an address of the form GROUP:PORT, where GROUP is
+// an IPv4 or IPv6 multicast address. This seed is used to join the
+// multicast group, receive datagrams sent to it, and send datagrams
+// to it. The iface option takes the name of the network interface to
+// use (for example eth0 or lo), otherwise the system default is used.
+// The ttl option sets the number of hops sent datagrams can travel
+// (default 1). The loop option causes sent datagrams to also be
+// delivered to other listeners on the local system, though this seed
+// ignores its own. The ttl option takes the place of the ttl socket
+// option.
+//
+// Filters:
+//
+// FILTER|...|seed or seed,filter=FILTER:...
+//
+// Filters can be stacked on any seed to transform the data flowing
+// through it, without changing the seed itself. They are listed from
+// the far side of a Pair inward, so for hex|gzip|tcp:host:80, written
+// data is hex encoded and then compressed before it is sent, while
+// received data is decompressed and then hex decoded. The filter
+// option takes a colon-separated list, and is the same as prefixing
+// the seed. The base64, base64url, hex, and urlencode filters encode
+// written data and decode read data, ignoring whitespace. Partial
+// input is kept until the next chunk arrives, and is flushed when the
+// NUt goes down. Encoded output can be wrapped into lines with a
+// width (for example base64=76). The encode=CODEC and decode=CODEC
+// filters are the same, except that decode works in reverse, so that
+// encoded data can be decoded before it is sent. They can also be
+// given as options, along with a wrap=WIDTH option (for example
+// tcp:host:80,encode=base64,wrap=76). The gzip filter compresses
+// written data and decompresses read data, flushing after each write
+// so that interactive traffic is not held up. The trace filter logs
+// the data read and written to stderr, without changing it, as
+// escaped text (trace or trace=text) or as a hexdump (trace=hex). The
+// record filter records the session (see Recording below). Each fork
+// session has its own filters, and a listener without fork starts
+// over with fresh filters for each client. Custom filters can be
+// added with RegisterFilter().
+//
+// Recording:
+//
+// record=PATH|seed
+//
+// The record filter stores both directions of a session in a text
+// file, which the REPLAY seed can play back. The first line is a
+// "# nutsak recording v1" header. Each line after that is a chunk of
+// the form SECONDS SIDE DATA, where SECONDS is the time since the
+// session started (with microsecond precision), SIDE is server for
+// data read from the wrapped NUt or client for data written to it,
+// and DATA is the base64 encoded chunk. Blank lines and lines
+// starting with # are ignored. The recording is truncated when the
+// NUt first comes up, and is written as the session runs, so it can
+// be read while the session is still open. A recording holds a
+// single session, so Pair returns an error if either side is
+// recorded and the listener pairs each client on its own (see
+// Forking below). The --record flag of sak wraps the last seed
+// provided, or the seed chosen with --record-seed. With only one
+// seed, that is the first seed, which suits a client, such as
+// "sak --record PATH tcp:HOST:PORT". For a listener, use
+// --record-seed=2, so that its clients are recorded as the client
+// side.
+//
+// Access control:
+//
+// acl=PATH,allow=LIST,deny=LIST
+//
+// These options are supported by the TCP-LISTEN, TLS-LISTEN, and
+// UDP-LISTEN seeds. The allow and deny options take a
+// comma-separated list of IPs and CIDRs (for example
+// allow=10.0.0.0/8,192.168.1.5). The acl option takes a filepath
+// with one rule per line, such as "allow 10.0.0.0/8" or
+// "deny 10.0.0.5, 10.0.0.6", and anything after a # is ignored.
+// Rules from all three options are combined. Peers are checked as
+// soon as a connection is accepted, or a datagram is received. A peer
+// that matches any deny rule is rejected. If there are allow rules, a
+// peer must also match one of them. Rejected connections are closed,
+// datagrams are dropped, and both are logged with the reason. The
+// number of denied peers is included in the stats that sak reports
+// at debug level.
+//
+// Connection limits:
+//
+// accept-rate=NUM/UNIT,max-conns=NUM,max-conns-per-ip=NUM
+//
+// These options are supported by the TCP-LISTEN and TLS-LISTEN seeds,
+// and protect the services behind a forking listener from connection
+// floods. The max-conns option limits how many connections can be
+// open at once. At the limit, the listener stops accepting, and new
+// connections wait in the backlog until one closes. The
+// max-conns-per-ip option limits how many connections each client IP
+// can have open at once, and extra connections are closed
+// immediately. The accept-rate option limits how quickly connections
+// are accepted (for example 10/s or 100/m), and the listener pauses
+// between accepts to stay under the limit. The number of accepted,
+// rejected, and throttled connections are included in the stats that
+// sak reports at debug level.
+//
+// Socket options:
+//
+// bind-device=NAME,keepalive=DURATION,linger=DURATION,mark=NUM,
+// nodelay=(on|off),rcvbuf=BYTES,reuseaddr,reuseport,sndbuf=BYTES,
+// tos=NUM,ttl=NUM
+//
+// These options are supported by all TCP, TLS, and UDP seeds, and are
+// applied when each socket is created. The bind-device option
+// restricts the socket to the provided network interface (Linux and
+// macOS only). The keepalive option takes the idle time before TCP
+// keepalive probes are sent (0 disables them). The linger option
+// takes how long Close() waits for unsent data, rounded up to whole
+// seconds (0 resets the connection instead). The mark option sets
+// SO_MARK for policy routing and firewall rules (Linux only, requires
+// CAP_NET_ADMIN). The nodelay option sets TCP_NODELAY (on by default,
+// so nodelay=off restores Nagle's algorithm). The rcvbuf and sndbuf
+// options set the kernel buffer sizes. The reuseaddr and reuseport
+// options allow the address or port to be bound by several sockets
+// (reuseport is Linux and macOS only). The tos option sets the IPv4
+// type of service or IPv6 traffic class (for example 0x10). The ttl
+// option sets the IPv4 TTL or IPv6 hop limit. The keepalive, linger,
+// and nodelay options only apply to TCP and TLS. An option that the
+// platform or privileges do not allow will cause the seed to fail
+// with an error naming the option.
+//
+// Limits:
+//
+// idle-timeout=DURATION,max-duration=DURATION
+//
+// These options are supported by all seeds. A Pair with no traffic in
+// either direction for the idle timeout, or open for longer than the
+// max duration, is torn down with Down() and the reason is logged. If
+// both NUts have a limit, the shorter one is used. NUts without
+// limits use IdleTimeout and MaxDuration (the -T and -t flags of
+// sak). Each fork session of a listener is limited on its own, and
+// the listener keeps accepting. A listener without fork is part of
+// the Pair itself, so reaching a limit stops the listener too. The
+// sessions of a UDP-LISTEN without fork share its limits, so traffic
+// from any client keeps them all open.
+//
+// Forking:
+//
+// A listener with the fork option pairs each client with its own new
+// NUt, created from the other seed, so that clients never see each
+// other's data. A UDP-LISTEN does so with or without fork. FILE and
+// STDIO seeds are the exception, as they can't be opened once per
+// client (a file in write mode would be truncated each time). They
+// are opened once instead, and shared by every client until the
+// listener goes down. Each write from a client is passed through
+// whole, and whatever is read (such as from stdin) is sent to every
+// connected client. A file is only read once, by the clients
+// connected at the time.
 package nutsak
 
 import (
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/mjwhitta/errors"
 )
 
-// Pair will connect two NUts together using Stream().
+// Pair will connect two NUts together using Stream(). If either NUt
+// is a Forker, each of its sessions is paired with a new NUt created
+// from the seed of the other. Pairs that are idle, or open for too
+// long, are torn down (see IdleTimeout and MaxDuration).
 func Pair(a NUt, b NUt) error {
+	var last *atomic.Int64 = &atomic.Int64{}
+
+	if f, ok := a.(Forker); ok && (f.Sessions() != nil) {
+		return pairSessions(f, b, nil)
+	}
+
+	if f, ok := b.(Forker); ok && (f.Sessions() != nil) {
+		return pairSessions(f, a, nil)
+	}
+
+	// Listeners without fork are limited as a whole
+	if s, ok := a.(splitter); ok && s.split() {
+		return pairSessions(s, b, last)
+	}
+
+	if s, ok := b.(splitter); ok && s.split() {
+		return pairSessions(s, a, last)
+	}
+
+	return pair(a, b, last)
+}
+
+// pair will connect two NUts together, until either goes down or the
+// Pair is torn down for being idle, or open for too long.
+func pair(a NUt, b NUt, last *atomic.Int64) error {
+	var done chan struct{} = make(chan struct{})
 	//nolint:mnd // 2 goroutines
 	var wait chan struct{} = make(chan struct{}, 2)
 
@@ -113,9 +449,14 @@ func Pair(a NUt, b NUt) error {
 		return e //nolint:wrapcheck // Not external to repo
 	}
 
+	last.Store(time.Now().UnixNano())
+
+	// Tear down idle or long-lived tunnels
+	go watchdog(a, b, last, done)
+
 	// Stream a to b
 	go func() {
-		stream(a, b)
+		stream(a, b, last)
 		time.Sleep(time.Millisecond)
 
 		_ = b.Down()
@@ -125,7 +466,7 @@ func Pair(a NUt, b NUt) error {
 
 	// Stream b to a
 	go func() {
-		stream(b, a)
+		stream(b, a, last)
 		time.Sleep(time.Millisecond)
 
 		_ = a.Down()
@@ -135,6 +476,88 @@ func Pair(a NUt, b NUt) error {
 
 	<-wait
 	<-wait
+	close(done)
+
+	return nil
+}
+
+// pairSessions will pair each session of the provided Forker with a
+// new NUt created from the seed of the template. A template that
+// can't be created more than once (such as stdio) is brought up
+// instead, and shared by every session. Either way, the template is
+// taken down once the Forker is done and every session has ended.
+// Sessions are limited on their own, unless they share the provided
+// activity, in which case reaching a limit stops the Forker too.
+func pairSessions(f Forker, template NUt, last *atomic.Int64) error {
+	var done chan struct{} = make(chan struct{})
+	var hub *sharedHub
+	var seed string = seedOf(template)
+	var wg sync.WaitGroup
+
+	defer func() {
+		close(done)
+
+		if hub != nil {
+			hub.close()
+		}
+
+		_ = template.Down()
+	}()
+
+	// A recording holds one session, so sessions can't share it
+	if isRecorded(f) || isRecorded(template) {
+		return errors.New("record is not supported with sessions")
+	}
+
+	if e := f.Up(); e != nil {
+		return e //nolint:wrapcheck // Not external to repo
+	}
+
+	if isShared(template) {
+		if e := template.Up(); e != nil {
+			_ = f.Down()
+			return e //nolint:wrapcheck // Not external to repo
+		}
+
+		hub = newSharedHub(template)
+	}
+
+	if last != nil {
+		last.Store(time.Now().UnixNano())
+
+		go watchdog(f, template, last, done)
+	}
+
+	for session := range f.Sessions() {
+		wg.Add(1)
+
+		go func(session NUt) {
+			var e error
+			var peer NUt
+			var shared *atomic.Int64 = last
+
+			defer wg.Done()
+
+			if shared == nil {
+				shared = &atomic.Int64{}
+			}
+
+			if hub != nil {
+				e = pair(session, hub.view(), shared)
+			} else if peer, e = NewNUt(seed); e == nil {
+				e = pair(session, peer, shared)
+			}
+
+			if e != nil {
+				e = errors.Newf("failed to pair %s: %w", session, e)
+				logErr(1, "%s", e.Error())
+
+				_ = session.Down()
+			}
+		}(session)
+	}
+
+	wg.Wait()
 
 	return nil
 }
@@ -150,7 +573,7 @@ func Stream(a NUt, b NUt) error {
 		return e //nolint:wrapcheck // Not external to repo
 	}
 
-	stream(a, b)
+	stream(a, b, &atomic.Int64{})
 
 	return nil
 }
@@ -0,0 +1,467 @@
+package nutsak
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mjwhitta/errors"
+)
+
+// pcapMaxPayload is the most data that will fit in a single captured
+// packet, after the largest IP and TCP headers.
+const pcapMaxPayload int = 65535 - 40 - 20
+
+// TCP flags used by captured segments.
+const (
+	tcpFlagSYN byte = 0x02
+	tcpFlagPSH byte = 0x08
+	tcpFlagACK byte = 0x10
+)
+
+// endpointer is a NUt that knows the addresses of its connection.
+type endpointer interface {
+	endpoints() (net.Addr, net.Addr)
+}
+
+// connAddrs are the local and remote addresses of the most recent
+// connection of a NUt, so that captures can use real endpoints.
+type connAddrs struct {
+	addrs atomic.Pointer[[2]net.Addr]
+}
+
+// endpoints will return the local and remote addresses, either of
+// which can be nil if unknown.
+func (c *connAddrs) endpoints() (net.Addr, net.Addr) {
+	if a := c.addrs.Load(); a != nil {
+		return a[0], a[1]
+	}
+
+	return nil, nil
+}
+
+// set will store the addresses of the provided connection.
+func (c *connAddrs) set(conn net.Conn) {
+	c.store(conn.LocalAddr(), conn.RemoteAddr())
+}
+
+// store will store the provided addresses.
+func (c *connAddrs) store(local net.Addr, remote net.Addr) {
+	c.addrs.Store(&[2]net.Addr{local, remote})
+}
+
+// PcapWriter will write the data streamed between NUts to a pcap
+// file, wrapped in synthesized IP and TCP or UDP headers, so that
+// tools like Wireshark can dissect the tunneled protocol. The real
+// endpoint addresses are used, where known, and loopback otherwise.
+// It is safe for concurrent use.
+type PcapWriter struct {
+	flows map[string][2]NUt
+	id    uint16
+	lock  *sync.Mutex
+	seqs  map[string]uint32
+	w     io.Writer
+}
+
+// NewPcapWriter will return a pointer to a PcapWriter that writes to
+// the provided writer. The pcap file header is written immediately.
+func NewPcapWriter(w io.Writer) (*PcapWriter, error) {
+	var hdr []byte = make([]byte, 24) //nolint:mnd // Header length
+
+	//nolint:mnd // Magic, version 2.4, snaplen, LINKTYPE_RAW
+	{
+		binary.LittleEndian.PutUint32(hdr[0:], 0xa1b2c3d4)
+		binary.LittleEndian.PutUint16(hdr[4:], 2)
+		binary.LittleEndian.PutUint16(hdr[6:], 4)
+		binary.LittleEndian.PutUint32(hdr[16:], 65535)
+		binary.LittleEndian.PutUint32(hdr[20:], 101)
+	}
+
+	if _, e := w.Write(hdr); e != nil {
+		return nil, errors.Newf("failed to write pcap header: %w", e)
+	}
+
+	return &PcapWriter{
+		flows: map[string][2]NUt{},
+		lock:  &sync.Mutex{},
+		seqs:  map[string]uint32{},
+		w:     w,
+	}, nil
+}
+
+// handshake will capture a TCP handshake for the provided flow, if
+// it hasn't been seen before. The NUts are kept, so that the flow can
+// be forgotten once their session ends.
+func (pw *PcapWriter) handshake(
+	src netip.AddrPort,
+	dst netip.AddrPort,
+	from NUt,
+	to NUt,
+) {
+	if _, ok := pw.seqs[src.String()+">"+dst.String()]; ok {
+		return
+	}
+
+	// Don't grow forever on long-running forking listeners
+	pw.prune()
+
+	pw.flows[src.String()+">"+dst.String()] = [2]NUt{from, to}
+	pw.seqs[src.String()+">"+dst.String()] = 0
+	pw.seqs[dst.String()+">"+src.String()] = 0
+
+	pw.writeSegment(src, dst, tcpFlagSYN, nil)
+	pw.writeSegment(dst, src, tcpFlagSYN|tcpFlagACK, nil)
+	pw.writeSegment(src, dst, tcpFlagACK, nil)
+}
+
+// prune will forget the flows of sessions that have ended, which is
+// when either of their NUts has gone down.
+func (pw *PcapWriter) prune() {
+	for fwd, nuts := range pw.flows {
+		if nuts[0].IsUp() && nuts[1].IsUp() {
+			continue
+		}
+
+		src, dst, _ := strings.Cut(fwd, ">")
+
+		delete(pw.flows, fwd)
+		delete(pw.seqs, fwd)
+		delete(pw.seqs, dst+">"+src)
+	}
+}
+
+// Trace will capture the provided chunk as flowing from one NUt to
+// the other. It can be assigned to the Trace hook. The chunk is sent
+// as UDP if either NUt is a PacketNUt, and as TCP otherwise. The
+// first chunk of each TCP flow is preceded by a handshake, with the
+// sender as the client.
+func (pw *PcapWriter) Trace(from NUt, to NUt, p []byte) {
+	var dst netip.AddrPort
+	var proto byte = 6 //nolint:mnd // TCP
+	var src netip.AddrPort
+
+	src, dst = pcapEndpoints(from, to)
+
+	if _, ok := from.(PacketNUt); ok {
+		proto = 17 //nolint:mnd // UDP
+	} else if _, ok := to.(PacketNUt); ok {
+		proto = 17 //nolint:mnd // UDP
+	}
+
+	pw.lock.Lock()
+	defer pw.lock.Unlock()
+
+	if proto == 17 { //nolint:mnd // UDP
+		for len(p) > 0 {
+			n := min(len(p), pcapMaxPayload)
+			pw.writePacket(src, dst, proto, pcapUDP(src, dst, p[:n]))
+			p = p[n:]
+		}
+
+		return
+	}
+
+	pw.handshake(src, dst, from, to)
+
+	for len(p) > 0 {
+		n := min(len(p), pcapMaxPayload)
+		pw.writeSegment(src, dst, tcpFlagPSH|tcpFlagACK, p[:n])
+		p = p[n:]
+	}
+}
+
+// writePacket will wrap the provided transport segment in an IP
+// header and write it as a pcap record.
+func (pw *PcapWriter) writePacket(
+	src netip.AddrPort,
+	dst netip.AddrPort,
+	proto byte,
+	seg []byte,
+) {
+	var hdr []byte = make([]byte, 16) //nolint:mnd // Record header
+	var now time.Time = time.Now()
+	var pkt []byte
+
+	pw.id++
+	pkt = pcapIP(src.Addr(), dst.Addr(), proto, pw.id, seg)
+
+	//nolint:gosec,mnd // Record header fields, lengths are capped
+	{
+		binary.LittleEndian.PutUint32(hdr[0:], uint32(now.Unix()))
+		binary.LittleEndian.PutUint32(
+			hdr[4:],
+			uint32(now.Nanosecond()/1000),
+		)
+		binary.LittleEndian.PutUint32(hdr[8:], uint32(len(pkt)))
+		binary.LittleEndian.PutUint32(hdr[12:], uint32(len(pkt)))
+	}
+
+	_, _ = pw.w.Write(append(hdr, pkt...))
+}
+
+// writeSegment will capture a TCP segment with the provided flags and
+// payload, and advance the sequence number of the flow.
+func (pw *PcapWriter) writeSegment(
+	src netip.AddrPort,
+	dst netip.AddrPort,
+	flags byte,
+	p []byte,
+) {
+	var ack uint32
+	var fwd string = src.String() + ">" + dst.String()
+	var rev string = dst.String() + ">" + src.String()
+	var seq uint32 = pw.seqs[fwd]
+
+	if flags&tcpFlagACK != 0 {
+		ack = pw.seqs[rev]
+	}
+
+	pw.writePacket(
+		src,
+		dst,
+		6, //nolint:mnd // TCP
+		pcapTCP(src, dst, seq, ack, flags, p),
+	)
+
+	//nolint:gosec // Length is capped
+	pw.seqs[fwd] = seq + uint32(len(p))
+
+	// SYN uses a sequence number
+	if flags&tcpFlagSYN != 0 {
+		pw.seqs[fwd]++
+	}
+}
+
+// pcapAddrPort will return the provided address as an AddrPort, or
+// false if it is not an IP address.
+func pcapAddrPort(a net.Addr) (netip.AddrPort, bool) {
+	var ap netip.AddrPort
+	var e error
+
+	if a == nil {
+		return ap, false
+	}
+
+	if ap, e = netip.ParseAddrPort(a.String()); e != nil {
+		return ap, false
+	}
+
+	return netip.AddrPortFrom(ap.Addr().WithZone(""), ap.Port()), true
+}
+
+// pcapChecksum will return the internet checksum of the provided
+// data, continuing from the provided sum.
+func pcapChecksum(sum uint32, b []byte) uint16 {
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8 //nolint:mnd // Pad byte
+	}
+
+	//nolint:mnd // Fold carries
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+
+	return ^uint16(sum) //nolint:gosec // Folded to 16 bits
+}
+
+// pcapEndpoints will return the source and destination of a chunk
+// streamed from one NUt to the other. Data read from a NUt came from
+// its remote peer, and data written to a NUt goes to its remote peer.
+// A NUt without a peer (such as stdio) is treated as local to the
+// other NUt.
+func pcapEndpoints(
+	from NUt,
+	to NUt,
+) (netip.AddrPort, netip.AddrPort) {
+	var dst netip.AddrPort
+	var dstOK bool
+	var fromLocal net.Addr
+	var fromRemote net.Addr
+	var src netip.AddrPort
+	var srcOK bool
+	var toLocal net.Addr
+	var toRemote net.Addr
+
+	if ep, ok := from.(endpointer); ok {
+		fromLocal, fromRemote = ep.endpoints()
+	}
+
+	if ep, ok := to.(endpointer); ok {
+		toLocal, toRemote = ep.endpoints()
+	}
+
+	src, srcOK = pcapAddrPort(fromRemote)
+	if !srcOK {
+		src, srcOK = pcapAddrPort(toLocal)
+	}
+
+	dst, dstOK = pcapAddrPort(toRemote)
+	if !dstOK {
+		dst, dstOK = pcapAddrPort(fromLocal)
+	}
+
+	// Unknown endpoints are loopback, in the family of the other side
+	switch {
+	case !srcOK && !dstOK:
+		src = netip.AddrPortFrom(pcapLoopback(netip.Addr{}), 0)
+		dst = src
+	case !srcOK:
+		src = netip.AddrPortFrom(pcapLoopback(dst.Addr()), 0)
+	case !dstOK:
+		dst = netip.AddrPortFrom(pcapLoopback(src.Addr()), 0)
+	}
+
+	// Both sides of an IP header must be the same family
+	if src.Addr().Is4() != dst.Addr().Is4() {
+		src = netip.AddrPortFrom(pcapTo16(src.Addr()), src.Port())
+		dst = netip.AddrPortFrom(pcapTo16(dst.Addr()), dst.Port())
+	}
+
+	return src, dst
+}
+
+// pcapIP will return the provided transport segment with an IPv4 or
+// IPv6 header.
+//
+//nolint:mnd // Header fields
+func pcapIP(
+	src netip.Addr,
+	dst netip.Addr,
+	proto byte,
+	id uint16,
+	seg []byte,
+) []byte {
+	var hdr []byte
+
+	if src.Is4() {
+		hdr = make([]byte, 20)
+		hdr[0] = 0x45
+		//nolint:gosec // Length is capped
+		binary.BigEndian.PutUint16(hdr[2:], uint16(20+len(seg)))
+		binary.BigEndian.PutUint16(hdr[4:], id)
+		hdr[6] = 0x40 // Don't fragment
+		hdr[8] = 64
+		hdr[9] = proto
+		copy(hdr[12:], src.AsSlice())
+		copy(hdr[16:], dst.AsSlice())
+		binary.BigEndian.PutUint16(hdr[10:], pcapChecksum(0, hdr))
+
+		return append(hdr, seg...)
+	}
+
+	hdr = make([]byte, 40)
+	hdr[0] = 0x60
+	//nolint:gosec // Length is capped
+	binary.BigEndian.PutUint16(hdr[4:], uint16(len(seg)))
+	hdr[6] = proto
+	hdr[7] = 64
+	copy(hdr[8:], src.AsSlice())
+	copy(hdr[24:], dst.AsSlice())
+
+	return append(hdr, seg...)
+}
+
+// pcapLoopback will return the loopback address in the family of the
+// provided address, or IPv4 if it is invalid.
+func pcapLoopback(like netip.Addr) netip.Addr {
+	if like.Is6() {
+		return netip.IPv6Loopback()
+	}
+
+	return netip.AddrFrom4([4]byte{127, 0, 0, 1}) //nolint:mnd // IP
+}
+
+// pcapPseudo will return the checksum sum of the IP pseudo-header for
+// the provided segment.
+func pcapPseudo(
+	src netip.AddrPort,
+	dst netip.AddrPort,
+	proto byte,
+	length int,
+) uint32 {
+	var b []byte
+
+	b = append(b, src.Addr().AsSlice()...)
+	b = append(b, dst.Addr().AsSlice()...)
+	b = append(b, 0, proto)
+	//nolint:gosec // Length is capped
+	b = binary.BigEndian.AppendUint16(b, uint16(length))
+
+	return uint32(^pcapChecksum(0, b))
+}
+
+// pcapTCP will return a TCP segment with the provided fields.
+//
+//nolint:mnd // Header fields
+func pcapTCP(
+	src netip.AddrPort,
+	dst netip.AddrPort,
+	seq uint32,
+	ack uint32,
+	flags byte,
+	p []byte,
+) []byte {
+	var seg []byte = make([]byte, 20, 20+len(p))
+
+	binary.BigEndian.PutUint16(seg[0:], src.Port())
+	binary.BigEndian.PutUint16(seg[2:], dst.Port())
+	binary.BigEndian.PutUint32(seg[4:], seq)
+	binary.BigEndian.PutUint32(seg[8:], ack)
+	seg[12] = 0x50 // 5 words, no options
+	seg[13] = flags
+	binary.BigEndian.PutUint16(seg[14:], 0xffff)
+
+	seg = append(seg, p...)
+
+	binary.BigEndian.PutUint16(
+		seg[16:],
+		pcapChecksum(pcapPseudo(src, dst, 6, len(seg)), seg),
+	)
+
+	return seg
+}
+
+// pcapTo16 will return the provided address as IPv6, mapping IPv4
+// addresses.
+func pcapTo16(a netip.Addr) netip.Addr {
+	return netip.AddrFrom16(a.As16())
+}
+
+// pcapUDP will return a UDP datagram with the provided payload.
+//
+//nolint:mnd // Header fields
+func pcapUDP(
+	src netip.AddrPort,
+	dst netip.AddrPort,
+	p []byte,
+) []byte {
+	var seg []byte = make([]byte, 8, 8+len(p))
+	var sum uint16
+
+	binary.BigEndian.PutUint16(seg[0:], src.Port())
+	binary.BigEndian.PutUint16(seg[2:], dst.Port())
+	//nolint:gosec // Length is capped
+	binary.BigEndian.PutUint16(seg[4:], uint16(8+len(p)))
+
+	seg = append(seg, p...)
+
+	sum = pcapChecksum(pcapPseudo(src, dst, 17, len(seg)), seg)
+
+	// Zero means no checksum, so UDP sends all ones instead
+	if sum == 0 {
+		sum = 0xffff
+	}
+
+	binary.BigEndian.PutUint16(seg[6:], sum)
+
+	return seg
+}
@@ -0,0 +1,247 @@
+package nutsak
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mjwhitta/errors"
+)
+
+// recordingHeader is the first line of every recording.
+const recordingHeader string = "# nutsak recording v1"
+
+// recordEvent is a single chunk of a recording.
+type recordEvent struct {
+	at   time.Duration
+	data []byte
+	side string
+}
+
+// recorder appends both directions of a session to a recording. The
+// file is opened for each chunk, like the TLS key log, so that it can
+// be read while the session is still running.
+type recorder struct {
+	fn    string
+	lock  *sync.Mutex
+	start time.Time
+}
+
+// begin will start the recording, truncating any previous one, the
+// first time it is called.
+func (r *recorder) begin() {
+	var e error
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.start.IsZero() {
+		return
+	}
+
+	r.start = time.Now()
+
+	//nolint:mnd // u=rw,go=-
+	e = os.WriteFile(r.fn, []byte(recordingHeader+"\n"), 0o600)
+	if e != nil {
+		logErr(1, "failed to write %s: %s", r.fn, e.Error())
+	}
+}
+
+// log will append the provided chunk to the recording.
+func (r *recorder) log(side string, p []byte) {
+	var e error
+	var f *os.File
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	//nolint:mnd // u=rw,go=-
+	f, e = os.OpenFile(r.fn, os.O_APPEND|os.O_WRONLY, 0o600)
+	if e != nil {
+		logErr(1, "failed to open %s: %s", r.fn, e.Error())
+		return
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	_, e = fmt.Fprintf(
+		f,
+		"%.6f %s %s\n",
+		time.Since(r.start).Seconds(),
+		side,
+		base64.StdEncoding.EncodeToString(p),
+	)
+	if e != nil {
+		logErr(1, "failed to write %s: %s", r.fn, e.Error())
+	}
+}
+
+// recordFilter records the data read from the NUt as the server side
+// of a session, and the data written to it as the client side,
+// without changing either.
+type recordFilter struct {
+	rec *recorder
+}
+
+func newRecordFilter(arg string) (Filter, error) {
+	if arg == "" {
+		return nil, errors.New("no record filename provided")
+	}
+
+	return recordFilter{
+		rec: &recorder{fn: arg, lock: &sync.Mutex{}},
+	}, nil
+}
+
+// Reader will record data read from the provided reader.
+func (f recordFilter) Reader(r io.Reader) io.Reader {
+	f.rec.begin()
+
+	return recordReader{Reader: r, rec: f.rec}
+}
+
+// String will return the name of the filter, with its filename.
+func (f recordFilter) String() string {
+	return "record=" + f.rec.fn
+}
+
+// Writer will record data written to the provided writer.
+func (f recordFilter) Writer(w io.Writer) io.WriteCloser {
+	f.rec.begin()
+
+	return nopWriteCloser{recordWriter{Writer: w, rec: f.rec}}
+}
+
+type recordReader struct {
+	io.Reader
+
+	rec *recorder
+}
+
+// Read will read from the underlying reader and record what was
+// read.
+func (r recordReader) Read(p []byte) (int, error) {
+	var e error
+	var n int
+
+	if n, e = r.Reader.Read(p); n > 0 {
+		r.rec.log("server", p[:n])
+	}
+
+	return n, e //nolint:wrapcheck // Could be io.EOF
+}
+
+type recordWriter struct {
+	io.Writer
+
+	rec *recorder
+}
+
+// Write will write to the underlying writer and record what was
+// written.
+func (w recordWriter) Write(p []byte) (int, error) {
+	var e error
+	var n int
+
+	if n, e = w.Writer.Write(p); n > 0 {
+		w.rec.log("client", p[:n])
+	}
+
+	return n, e //nolint:wrapcheck // Not external to repo
+}
+
+// isRecorded will return whether or not the provided NUt has a record
+// filter.
+func isRecorded(nut NUt) bool {
+	if f, ok := nut.(*FilteredNUt); ok {
+		for _, filter := range f.filters {
+			if _, ok := filter.(recordFilter); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// readRecording will return the events of the provided recording.
+func readRecording(fn string) ([]recordEvent, error) {
+	var data []byte
+	var e error
+	var events []recordEvent
+	var f *os.File
+	var fields []string
+	var line string
+	var lineno int
+	var s *bufio.Scanner
+	var secs float64
+
+	if f, e = os.Open(fn); e != nil {
+		return nil, errors.Newf("failed to open %s: %w", fn, e)
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	s = bufio.NewScanner(f)
+	s.Buffer(nil, 4*maxDatagram) //nolint:mnd // Base64 of big chunks
+
+	for s.Scan() {
+		lineno++
+
+		line = strings.TrimSpace(s.Text())
+		if (line == "") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		//nolint:mnd // Time, side, and data
+		if fields = strings.Fields(line); len(fields) != 3 {
+			return nil, errors.Newf("%s:%d: bad event", fn, lineno)
+		}
+
+		if secs, e = strconv.ParseFloat(fields[0], 64); e != nil {
+			return nil, errors.Newf("%s:%d: %w", fn, lineno, e)
+		}
+
+		switch fields[1] {
+		case "client", "server":
+		default:
+			return nil, errors.Newf(
+				"%s:%d: unknown side %s",
+				fn,
+				lineno,
+				fields[1],
+			)
+		}
+
+		data, e = base64.StdEncoding.DecodeString(fields[2])
+		if e != nil {
+			return nil, errors.Newf("%s:%d: %w", fn, lineno, e)
+		}
+
+		events = append(
+			events,
+			recordEvent{
+				at:   time.Duration(secs * float64(time.Second)),
+				data: data,
+				side: fields[1],
+			},
+		)
+	}
+
+	if e = s.Err(); e != nil {
+		return nil, errors.Newf("failed to read %s: %w", fn, e)
+	}
+
+	return events, nil
+}
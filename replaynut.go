@@ -0,0 +1,273 @@
+package nutsak
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mjwhitta/errors"
+)
+
+// ReplayNUt is a network utility that plays back one side of a
+// recorded session, with the original timing.
+type ReplayNUt struct {
+	*baseNUt
+
+	addr    string
+	done    chan struct{}
+	events  []recordEvent
+	heard   time.Time
+	next    int
+	pending []byte
+	ref     time.Time
+	refAt   time.Duration
+	side    string
+	speed   float64
+	state   *sync.Mutex
+	wake    *sync.Cond
+	written int
+}
+
+// NewReplayNUt will return a pointer to a replay network utility
+// instance with the provided seed.
+func NewReplayNUt(seed string) (NUt, error) {
+	var e error
+	var nut *ReplayNUt = &ReplayNUt{
+		side:  "server",
+		speed: 1,
+		state: &sync.Mutex{},
+	}
+	var ok bool
+
+	// Inherit
+	nut.baseNUt = super(seed)
+	nut.wake = sync.NewCond(nut.state)
+
+	switch nut.Type() {
+	case "replay":
+	default:
+		return nil, errors.Newf("unknown replay type %s", nut.Type())
+	}
+
+	for k, v := range nut.config {
+		switch k {
+		case "addr":
+			nut.addr = v
+		case "side":
+			switch v {
+			case "client", "server":
+				nut.side = v
+			default:
+				e = errors.Newf("unknown %s side %s", nut.Type(), v)
+				return nil, e
+			}
+		case "speed":
+			nut.speed, e = strconv.ParseFloat(
+				strings.TrimSuffix(strings.ToLower(v), "x"),
+				64,
+			)
+			if e != nil {
+				return nil, errors.Newf("invalid %s %s: %w", k, v, e)
+			} else if nut.speed <= 0 {
+				return nil, errors.Newf("invalid %s %s", k, v)
+			}
+		default:
+			if ok, e = nut.parseLimit(k, v); e != nil {
+				return nil, e
+			} else if !ok {
+				e = errors.Newf("unknown %s option %s", nut.Type(), k)
+				return nil, e
+			}
+		}
+	}
+
+	if nut.addr == "" {
+		return nil, errors.Newf("no %s name provided", nut.Type())
+	}
+
+	return nut, nil
+}
+
+// Down will stop the network utility. In the case of replay, it will
+// stop playing back the recording.
+func (nut *ReplayNUt) Down() error {
+	nut.lock.Lock()
+	defer nut.lock.Unlock()
+
+	// Check if already down
+	if !nut.up.Load() {
+		return nil
+	}
+
+	nut.state.Lock()
+	nut.up.Store(false)
+	close(nut.done)
+	nut.wake.Broadcast()
+	nut.state.Unlock()
+
+	return nil
+}
+
+// KeepAlive will return whether or not the network utility should be
+// left running upon EOF. In the case of replay, EOF means the
+// recording is over.
+func (nut *ReplayNUt) KeepAlive() bool {
+	return false
+}
+
+// Read will return the next chunk of the replayed side, once the
+// peer has sent everything that the other side sent before it in the
+// recording, and the recorded delay has passed.
+//
+//nolint:mnd // Log levels
+func (nut *ReplayNUt) Read(p []byte) (int, error) {
+	var delay time.Duration
+	var done chan struct{}
+	var ev recordEvent
+	var n int
+
+	nut.state.Lock()
+	defer nut.state.Unlock()
+
+	for len(nut.pending) == 0 {
+		if !nut.up.Load() || (nut.next >= len(nut.events)) {
+			logSubInfo(2, "%s read: end of recording", nut.String())
+			return 0, io.EOF
+		}
+
+		if ev = nut.events[nut.next]; ev.side != nut.side {
+			nut.next++
+			continue
+		}
+
+		if !nut.waitForPeer() {
+			return 0, io.EOF
+		}
+
+		// Keep the recorded gap since the last thing that happened
+		if nut.heard.After(nut.ref) {
+			nut.ref = nut.heard
+			nut.refAt = nut.priorPeerEvent()
+		}
+
+		delay = time.Duration(float64(ev.at-nut.refAt) / nut.speed)
+		delay -= time.Since(nut.ref)
+		done = nut.done
+
+		if delay > 0 {
+			nut.state.Unlock()
+
+			select {
+			case <-done:
+			case <-time.After(delay):
+			}
+
+			nut.state.Lock()
+
+			if !nut.up.Load() {
+				return 0, io.EOF
+			}
+		}
+
+		nut.next++
+		nut.pending = ev.data
+		nut.ref = time.Now()
+		nut.refAt = ev.at
+	}
+
+	n = copy(p, nut.pending)
+	nut.pending = nut.pending[n:]
+	logSubInfo(2, "%s read: %d bytes", nut.String(), n)
+
+	return n, nil
+}
+
+// priorPeerEvent will return the time of the last event of the peer
+// side before the next event. The caller must hold state.
+func (nut *ReplayNUt) priorPeerEvent() time.Duration {
+	for i := nut.next - 1; i >= 0; i-- {
+		if nut.events[i].side != nut.side {
+			return nut.events[i].at
+		}
+	}
+
+	return 0
+}
+
+// Up will start the network utility. In the case of replay, it will
+// read the recording and start the clock.
+func (nut *ReplayNUt) Up() error {
+	var e error
+	var events []recordEvent
+
+	nut.lock.Lock()
+	defer nut.lock.Unlock()
+
+	// Check if already up
+	if nut.up.Load() {
+		return nil
+	}
+
+	if events, e = readRecording(nut.addr); e != nil {
+		return e
+	}
+
+	nut.state.Lock()
+	nut.done = make(chan struct{})
+	nut.events = events
+	nut.heard = time.Time{}
+	nut.next = 0
+	nut.pending = nil
+	nut.ref = time.Now()
+	nut.refAt = 0
+	nut.up.Store(true)
+	nut.written = 0
+	nut.state.Unlock()
+
+	logGood(1, "replaying %s side of %s", nut.side, nut.addr)
+
+	return nil
+}
+
+// waitForPeer will block until the peer has sent at least as much as
+// the other side had sent before the next event, in the recording.
+// It returns false if the NUt went down. The caller must hold state.
+func (nut *ReplayNUt) waitForPeer() bool {
+	var want int
+
+	for _, ev := range nut.events[:nut.next] {
+		if ev.side != nut.side {
+			want += len(ev.data)
+		}
+	}
+
+	for nut.up.Load() && (nut.written < want) {
+		nut.wake.Wait()
+	}
+
+	return nut.up.Load()
+}
+
+// Write will accept data from the peer, which paces the replay. The
+// data itself is discarded.
+//
+//nolint:mnd // Log levels
+func (nut *ReplayNUt) Write(p []byte) (int, error) {
+	nut.state.Lock()
+	defer nut.state.Unlock()
+
+	if !nut.up.Load() {
+		logSubInfo(2, "%s write: not up", nut.String())
+		return 0, io.EOF
+	}
+
+	nut.heard = time.Now()
+	nut.written += len(p)
+	nut.wake.Broadcast()
+
+	logSubInfo(2, "%s write: %d bytes", nut.String(), len(p))
+
+	return len(p), nil
+}
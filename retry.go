@@ -0,0 +1,148 @@
+package nutsak
+
+import (
+	"context"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/mjwhitta/errors"
+)
+
+// retryOpts control how client NUts connect, and how often they
+// retry when a connection fails.
+type retryOpts struct {
+	backoff string
+	max     time.Duration
+	retries int
+	timeout time.Duration
+}
+
+func newRetryOpts() *retryOpts {
+	return &retryOpts{
+		backoff: "fixed",
+		max:     30 * time.Second, //nolint:mnd // Default max backoff
+		retries: -1,               // Forever
+	}
+}
+
+// delay will return how long to wait before the provided (zero
+// indexed) retry. Exponential backoff has jitter, so that many
+// clients don't reconnect in lockstep.
+func (r *retryOpts) delay(attempt int) time.Duration {
+	var d time.Duration = time.Second
+
+	if r.backoff == "exp" {
+		// Stop shifting well before overflow
+		for i := 0; (i < attempt) && (d < r.max); i++ {
+			d *= 2
+		}
+	}
+
+	d = min(d, r.max)
+
+	if (r.backoff == "exp") && (d > 1) {
+		d = d/2 + rand.N(d/2) //nolint:gosec // Jitter, not crypto
+	}
+
+	return d
+}
+
+// dial will call the provided dial function until it succeeds, the
+// retries run out, or done is closed. The context passed to dial is
+// canceled when done is closed, so that Down doesn't wait on a slow
+// attempt. Failed attempts are logged, and the last error is
+// returned. A nil done channel retries until the retries run out.
+func (r *retryOpts) dial(
+	done <-chan struct{},
+	dial func(ctx context.Context) error,
+) error {
+	var cancel context.CancelFunc
+	var ctx context.Context
+	var e error
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			cancel()
+		}
+	}()
+
+	for attempt := 0; ; attempt++ {
+		if e = dial(ctx); e == nil {
+			return nil
+		}
+
+		e = errors.Newf("connect failed: %w", e)
+
+		if (r.retries >= 0) && (attempt >= r.retries) {
+			return e
+		}
+
+		select {
+		case <-done:
+			return e
+		default:
+		}
+
+		logErr(1, "%s", e.Error())
+
+		select {
+		case <-done:
+			return e
+		case <-time.After(r.delay(attempt)):
+		}
+	}
+}
+
+// parse will parse the provided option, if it is a retry option. It
+// returns whether or not the option was consumed. Retry options are
+// not consumed for listeners.
+func (r *retryOpts) parse(
+	k string,
+	v string,
+	client bool,
+) (bool, error) {
+	var d time.Duration
+	var e error
+
+	if !client {
+		return false, nil
+	}
+
+	switch k {
+	case "backoff":
+		switch v {
+		case "exp", "fixed":
+			r.backoff = v
+		default:
+			return true, errors.Newf("invalid %s %s", k, v)
+		}
+	case "connect-timeout", "max":
+		if d, e = time.ParseDuration(v); e != nil {
+			return true, errors.Newf("invalid %s %s: %w", k, v, e)
+		} else if d <= 0 {
+			return true, errors.Newf("invalid %s %s", k, v)
+		}
+
+		if k == "max" {
+			r.max = d
+		} else {
+			r.timeout = d
+		}
+	case "retry":
+		if r.retries, e = strconv.Atoi(v); e != nil {
+			return true, errors.Newf("invalid %s %s: %w", k, v, e)
+		} else if r.retries < 0 {
+			return true, errors.Newf("invalid %s %s", k, v)
+		}
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
@@ -0,0 +1,235 @@
+package nutsak
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mjwhitta/errors"
+)
+
+// sharedHub lets every fork session of a listener be paired with the
+// same NUt, for NUts that can't be created once per session (such as
+// stdio, or a file that would be truncated each time). Whatever the
+// NUt reads is sent to every session, and writes from each session
+// are passed through whole.
+type sharedHub struct {
+	done  chan struct{}
+	lock  *sync.Mutex
+	nut   NUt
+	once  sync.Once
+	start sync.Once
+	views map[*sharedNUt]struct{}
+	wlock *sync.Mutex
+}
+
+// sharedNUt is the view of a sharedHub for a single fork session.
+// Taking it down only detaches the session.
+type sharedNUt struct {
+	done chan struct{}
+	hub  *sharedHub
+	in   chan []byte
+	once sync.Once
+	rest []byte
+}
+
+func newSharedHub(nut NUt) *sharedHub {
+	var hub *sharedHub = &sharedHub{
+		done:  make(chan struct{}),
+		lock:  &sync.Mutex{},
+		nut:   nut,
+		views: map[*sharedNUt]struct{}{},
+		wlock: &sync.Mutex{},
+	}
+
+	return hub
+}
+
+// isShared will return whether or not the provided NUt must be shared
+// by fork sessions.
+func isShared(nut NUt) bool {
+	if s, ok := nut.(sharer); ok {
+		return s.shared()
+	}
+
+	return false
+}
+
+// close will end every session, such as once the listener is done
+// with the shared NUt.
+func (hub *sharedHub) close() {
+	hub.once.Do(
+		func() {
+			close(hub.done)
+		},
+	)
+}
+
+// run will read from the shared NUt until it is done, and queue each
+// chunk for every session. A session that falls too far behind misses
+// chunks, rather than stalling the others.
+//
+//nolint:mnd // Log levels
+func (hub *sharedHub) run() {
+	var b []byte = make([]byte, maxDatagram)
+	var e error
+	var n int
+
+	for {
+		n, e = hub.nut.Read(b)
+
+		if n > 0 {
+			hub.lock.Lock()
+
+			for view := range hub.views {
+				select {
+				case view.in <- append([]byte{}, b[:n]...):
+				default:
+					logSubInfo(2, "%s queue full: dropped", hub.nut)
+				}
+			}
+
+			hub.lock.Unlock()
+		} else if e == nil {
+			// Nothing will ever be read (such as in write mode)
+			return
+		}
+
+		if e != nil {
+			if !hub.nut.KeepAlive() {
+				// Same as a Pair, which ends once one side is done
+				hub.close()
+				return
+			}
+
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// view will return a new NUt for a single fork session.
+func (hub *sharedHub) view() *sharedNUt {
+	var view *sharedNUt = &sharedNUt{
+		done: make(chan struct{}),
+		hub:  hub,
+		in:   make(chan []byte, maxPending),
+	}
+
+	hub.lock.Lock()
+	hub.views[view] = struct{}{}
+	hub.lock.Unlock()
+
+	// Nothing is read until there is a session to send it to
+	hub.start.Do(
+		func() {
+			go hub.run()
+		},
+	)
+
+	return view
+}
+
+// Close is an alias for Down().
+func (nut *sharedNUt) Close() error {
+	return nut.Down()
+}
+
+// Down will detach the session from the shared NUt, which stays up
+// for the other sessions.
+func (nut *sharedNUt) Down() error {
+	nut.once.Do(
+		func() {
+			nut.hub.lock.Lock()
+			delete(nut.hub.views, nut)
+			nut.hub.lock.Unlock()
+
+			close(nut.done)
+		},
+	)
+
+	return nil
+}
+
+// IsUp will return whether or not the session is still attached to
+// the shared NUt, and the shared NUt is still up.
+func (nut *sharedNUt) IsUp() bool {
+	return !isClosed(nut.done) && !isClosed(nut.hub.done)
+}
+
+// KeepAlive will return whether or not the network utility should be
+// left running upon EOF. In the case of a shared NUt, it should
+// return true, if it is also up.
+func (nut *sharedNUt) KeepAlive() bool {
+	return nut.IsUp()
+}
+
+// limits will return the limits of the shared NUt, if any.
+func (nut *sharedNUt) limits() (time.Duration, time.Duration) {
+	if l, ok := nut.hub.nut.(limiter); ok {
+		return l.limits()
+	}
+
+	return 0, 0
+}
+
+// Open is an alias for Up().
+func (nut *sharedNUt) Open() error {
+	return nut.Up()
+}
+
+// Read will read the next chunk that the shared NUt read, after this
+// session was attached.
+func (nut *sharedNUt) Read(p []byte) (int, error) {
+	var n int
+
+	if len(nut.rest) == 0 {
+		select {
+		case nut.rest = <-nut.in:
+		case <-nut.done:
+			return 0, io.EOF
+		case <-nut.hub.done:
+			return 0, io.EOF
+		}
+	}
+
+	n = copy(p, nut.rest)
+	nut.rest = nut.rest[n:]
+
+	return n, nil
+}
+
+// String will return the seed of the shared NUt.
+func (nut *sharedNUt) String() string {
+	return nut.hub.nut.String()
+}
+
+// Type will return the type of the shared NUt.
+func (nut *sharedNUt) Type() string {
+	return nut.hub.nut.Type()
+}
+
+// Up will start the network utility. In the case of a shared NUt, it
+// is already up, so it will do nothing, unless the session was
+// already detached.
+func (nut *sharedNUt) Up() error {
+	if !nut.IsUp() {
+		return errors.Newf("%s is no longer shared", nut.String())
+	}
+
+	return nil
+}
+
+// Write will write to the shared NUt. Writes from different sessions
+// are never interleaved.
+func (nut *sharedNUt) Write(p []byte) (int, error) {
+	var w io.Writer = nut.hub.nut
+
+	if !nut.IsUp() {
+		return 0, io.EOF
+	}
+
+	nut.hub.wlock.Lock()
+	defer nut.hub.wlock.Unlock()
+
+	return w.Write(p) //nolint:wrapcheck // Not external to repo
+}
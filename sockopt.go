@@ -0,0 +1,241 @@
+//go:build unix || windows
+
+package nutsak
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/mjwhitta/errors"
+)
+
+// ifaceIPv4 will return the first IPv4 address of the provided
+// interface, which is how IPv4 multicast options select it.
+func ifaceIPv4(ifi *net.Interface) ([4]byte, error) {
+	var addrs []net.Addr
+	var e error
+	var ip [4]byte
+
+	if addrs, e = ifi.Addrs(); e != nil {
+		e = errors.Newf("failed to get %s addresses: %w", ifi.Name, e)
+		return ip, e
+	}
+
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok {
+			if ipnet.IP.To4() != nil {
+				copy(ip[:], ipnet.IP.To4())
+				return ip, nil
+			}
+		}
+	}
+
+	return ip, errors.Newf("no IPv4 address on %s", ifi.Name)
+}
+
+// joinGroup will join the provided multicast group on the provided
+// interface, or the system default if nil.
+func joinGroup(
+	rc syscall.RawConn,
+	ifi *net.Interface,
+	group net.IP,
+) error {
+	var e error
+	var eOpt error
+	var mreq4 syscall.IPMreq
+	var mreq6 syscall.IPv6Mreq
+
+	if group.To4() != nil {
+		copy(mreq4.Multiaddr[:], group.To4())
+
+		if ifi != nil {
+			if mreq4.Interface, e = ifaceIPv4(ifi); e != nil {
+				return e
+			}
+		}
+	} else {
+		copy(mreq6.Multiaddr[:], group.To16())
+
+		if ifi != nil {
+			//nolint:gosec // Interface indexes are never negative
+			mreq6.Interface = uint32(ifi.Index)
+		}
+	}
+
+	e = rc.Control(
+		func(fd uintptr) {
+			if group.To4() != nil {
+				eOpt = setsockoptIPMreq(
+					fd,
+					syscall.IPPROTO_IP,
+					syscall.IP_ADD_MEMBERSHIP,
+					&mreq4,
+				)
+			} else {
+				eOpt = setsockoptIPv6Mreq(
+					fd,
+					syscall.IPPROTO_IPV6,
+					syscall.IPV6_JOIN_GROUP,
+					&mreq6,
+				)
+			}
+		},
+	)
+	if e != nil {
+		return errors.Newf("failed to access socket: %w", e)
+	}
+
+	if eOpt != nil {
+		return errors.Newf("failed to join %s: %w", group, eOpt)
+	}
+
+	return nil
+}
+
+// setBroadcast will allow sending datagrams to a broadcast address.
+func setBroadcast(rc syscall.RawConn) error {
+	return setsockopt(rc, syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1)
+}
+
+// setMulticast will set the interface, hop limit, and loopback of
+// outgoing multicast datagrams. A nil interface leaves the system
+// default.
+func setMulticast(
+	rc syscall.RawConn,
+	ifi *net.Interface,
+	ttl int,
+	loop bool,
+	v6 bool,
+) error {
+	var e error
+	var lvl int = syscall.IPPROTO_IP
+	var optLoop int = syscall.IP_MULTICAST_LOOP
+	var optTTL int = syscall.IP_MULTICAST_TTL
+	var v int
+
+	if loop {
+		v = 1
+	}
+
+	if v6 {
+		lvl = syscall.IPPROTO_IPV6
+		optLoop = syscall.IPV6_MULTICAST_LOOP
+		optTTL = syscall.IPV6_MULTICAST_HOPS
+	}
+
+	if ifi != nil {
+		if e = setMulticastIf(rc, ifi, v6); e != nil {
+			return e
+		}
+	}
+
+	if e = setsockopt(rc, lvl, optTTL, ttl); e != nil {
+		return e
+	}
+
+	return setsockopt(rc, lvl, optLoop, v)
+}
+
+// setMulticastIf will set the interface used to send multicast
+// datagrams. IPv4 selects it by address, while IPv6 uses its index.
+func setMulticastIf(
+	rc syscall.RawConn,
+	ifi *net.Interface,
+	v6 bool,
+) error {
+	var e error
+	var eOpt error
+	var ip [4]byte
+
+	if v6 {
+		return setsockopt(
+			rc,
+			syscall.IPPROTO_IPV6,
+			syscall.IPV6_MULTICAST_IF,
+			ifi.Index,
+		)
+	}
+
+	if ip, e = ifaceIPv4(ifi); e != nil {
+		return e
+	}
+
+	e = rc.Control(
+		func(fd uintptr) {
+			eOpt = setsockoptInet4(
+				fd,
+				syscall.IPPROTO_IP,
+				syscall.IP_MULTICAST_IF,
+				ip,
+			)
+		},
+	)
+	if e != nil {
+		return errors.Newf("failed to access socket: %w", e)
+	}
+
+	return sockoptErr(eOpt)
+}
+
+// setRcvBuf will set the receive buffer size.
+func setRcvBuf(rc syscall.RawConn, n int) error {
+	return setsockopt(rc, syscall.SOL_SOCKET, syscall.SO_RCVBUF, n)
+}
+
+// setReuseAddr will allow binding an address that is still in use.
+func setReuseAddr(rc syscall.RawConn) error {
+	return setsockopt(rc, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+}
+
+// setSndBuf will set the send buffer size.
+func setSndBuf(rc syscall.RawConn, n int) error {
+	return setsockopt(rc, syscall.SOL_SOCKET, syscall.SO_SNDBUF, n)
+}
+
+// setsockopt will set an integer socket option on the provided raw
+// connection.
+func setsockopt(rc syscall.RawConn, lvl int, opt int, v int) error {
+	var e error
+	var eOpt error
+
+	e = rc.Control(
+		func(fd uintptr) {
+			eOpt = setsockoptInt(fd, lvl, opt, v)
+		},
+	)
+	if e != nil {
+		return errors.Newf("failed to access socket: %w", e)
+	}
+
+	return sockoptErr(eOpt)
+}
+
+// setTTL will set the hop limit of outgoing unicast packets.
+func setTTL(rc syscall.RawConn, ttl int, v6 bool) error {
+	if v6 {
+		return setsockopt(
+			rc,
+			syscall.IPPROTO_IPV6,
+			syscall.IPV6_UNICAST_HOPS,
+			ttl,
+		)
+	}
+
+	return setsockopt(rc, syscall.IPPROTO_IP, syscall.IP_TTL, ttl)
+}
+
+// sockoptErr will wrap the provided setsockopt error, if any, noting
+// when it is due to missing privileges.
+func sockoptErr(e error) error {
+	switch e {
+	case nil:
+		return nil
+	case syscall.EACCES, syscall.EPERM:
+		return errors.Newf(
+			"failed to set socket option (needs privileges): %w",
+			e,
+		)
+	}
+
+	return errors.Newf("failed to set socket option: %w", e)
+}
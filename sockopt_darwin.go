@@ -0,0 +1,47 @@
+//go:build darwin
+
+package nutsak
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/mjwhitta/errors"
+)
+
+// setBindDevice will restrict the provided raw connection to the
+// named network interface.
+func setBindDevice(rc syscall.RawConn, dev string, v6 bool) error {
+	var e error
+	var ifi *net.Interface
+
+	if ifi, e = net.InterfaceByName(dev); e != nil {
+		return errors.Newf("unknown interface %s: %w", dev, e)
+	}
+
+	if v6 {
+		return setsockopt(
+			rc,
+			syscall.IPPROTO_IPV6,
+			syscall.IPV6_BOUND_IF,
+			ifi.Index,
+		)
+	}
+
+	return setsockopt(
+		rc,
+		syscall.IPPROTO_IP,
+		syscall.IP_BOUND_IF,
+		ifi.Index,
+	)
+}
+
+// setMark is not supported on macOS.
+func setMark(_ syscall.RawConn, _ int) error {
+	return errUnsupported()
+}
+
+// setReusePort will allow multiple sockets to bind the same port.
+func setReusePort(rc syscall.RawConn) error {
+	return setsockopt(rc, syscall.SOL_SOCKET, syscall.SO_REUSEPORT, 1)
+}
@@ -0,0 +1,47 @@
+//go:build linux
+
+package nutsak
+
+import (
+	"syscall"
+
+	"github.com/mjwhitta/errors"
+)
+
+// soReusePort is missing from the syscall package on Linux.
+const soReusePort int = 0xf
+
+// setBindDevice will restrict the provided raw connection to the
+// named network interface. This requires CAP_NET_RAW on older
+// kernels.
+func setBindDevice(rc syscall.RawConn, dev string, _ bool) error {
+	var e error
+	var eOpt error
+
+	e = rc.Control(
+		func(fd uintptr) {
+			eOpt = syscall.SetsockoptString(
+				int(fd),
+				syscall.SOL_SOCKET,
+				syscall.SO_BINDTODEVICE,
+				dev,
+			)
+		},
+	)
+	if e != nil {
+		return errors.Newf("failed to access socket: %w", e)
+	}
+
+	return sockoptErr(eOpt)
+}
+
+// setMark will set the firewall mark (SO_MARK) on the provided raw
+// connection. This requires CAP_NET_ADMIN.
+func setMark(rc syscall.RawConn, mark int) error {
+	return setsockopt(rc, syscall.SOL_SOCKET, syscall.SO_MARK, mark)
+}
+
+// setReusePort will allow multiple sockets to bind the same port.
+func setReusePort(rc syscall.RawConn) error {
+	return setsockopt(rc, syscall.SOL_SOCKET, soReusePort, 1)
+}
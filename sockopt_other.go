@@ -0,0 +1,20 @@
+//go:build unix && !darwin && !linux
+
+package nutsak
+
+import "syscall"
+
+// setBindDevice is not supported on this platform.
+func setBindDevice(_ syscall.RawConn, _ string, _ bool) error {
+	return errUnsupported()
+}
+
+// setMark is not supported on this platform.
+func setMark(_ syscall.RawConn, _ int) error {
+	return errUnsupported()
+}
+
+// setReusePort is not supported on this platform.
+func setReusePort(_ syscall.RawConn) error {
+	return errUnsupported()
+}
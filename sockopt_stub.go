@@ -0,0 +1,69 @@
+//go:build !unix && !windows
+
+package nutsak
+
+import (
+	"net"
+	"syscall"
+)
+
+// joinGroup is not supported on this platform.
+func joinGroup(_ syscall.RawConn, _ *net.Interface, _ net.IP) error {
+	return errUnsupported()
+}
+
+// setBindDevice is not supported on this platform.
+func setBindDevice(_ syscall.RawConn, _ string, _ bool) error {
+	return errUnsupported()
+}
+
+// setBroadcast is not supported on this platform.
+func setBroadcast(_ syscall.RawConn) error {
+	return errUnsupported()
+}
+
+// setMark is not supported on this platform.
+func setMark(_ syscall.RawConn, _ int) error {
+	return errUnsupported()
+}
+
+// setMulticast is not supported on this platform.
+func setMulticast(
+	_ syscall.RawConn,
+	_ *net.Interface,
+	_ int,
+	_ bool,
+	_ bool,
+) error {
+	return errUnsupported()
+}
+
+// setRcvBuf is not supported on this platform.
+func setRcvBuf(_ syscall.RawConn, _ int) error {
+	return errUnsupported()
+}
+
+// setReuseAddr is not supported on this platform.
+func setReuseAddr(_ syscall.RawConn) error {
+	return errUnsupported()
+}
+
+// setReusePort is not supported on this platform.
+func setReusePort(_ syscall.RawConn) error {
+	return errUnsupported()
+}
+
+// setSndBuf is not supported on this platform.
+func setSndBuf(_ syscall.RawConn, _ int) error {
+	return errUnsupported()
+}
+
+// setTOS is not supported on this platform.
+func setTOS(_ syscall.RawConn, _ int, _ bool) error {
+	return errUnsupported()
+}
+
+// setTTL is not supported on this platform.
+func setTTL(_ syscall.RawConn, _ int, _ bool) error {
+	return errUnsupported()
+}
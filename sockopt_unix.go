@@ -0,0 +1,54 @@
+//go:build unix
+
+package nutsak
+
+import "syscall"
+
+// setsockoptInet4 will set an IPv4 address socket option on the
+// provided file descriptor.
+func setsockoptInet4(fd uintptr, lvl int, opt int, v [4]byte) error {
+	return syscall.SetsockoptInet4Addr(int(fd), lvl, opt, v)
+}
+
+// setsockoptIPMreq will set an IPv4 multicast group socket option
+// on the provided file descriptor.
+func setsockoptIPMreq(
+	fd uintptr,
+	lvl int,
+	opt int,
+	mreq *syscall.IPMreq,
+) error {
+	return syscall.SetsockoptIPMreq(int(fd), lvl, opt, mreq)
+}
+
+// setsockoptIPv6Mreq will set an IPv6 multicast group socket option
+// on the provided file descriptor.
+func setsockoptIPv6Mreq(
+	fd uintptr,
+	lvl int,
+	opt int,
+	mreq *syscall.IPv6Mreq,
+) error {
+	return syscall.SetsockoptIPv6Mreq(int(fd), lvl, opt, mreq)
+}
+
+// setsockoptInt will set an integer socket option on the provided
+// file descriptor.
+func setsockoptInt(fd uintptr, lvl int, opt int, v int) error {
+	return syscall.SetsockoptInt(int(fd), lvl, opt, v)
+}
+
+// setTOS will set the type of service (IPv4) or traffic class (IPv6)
+// on the provided raw connection.
+func setTOS(rc syscall.RawConn, tos int, v6 bool) error {
+	if v6 {
+		return setsockopt(
+			rc,
+			syscall.IPPROTO_IPV6,
+			syscall.IPV6_TCLASS,
+			tos,
+		)
+	}
+
+	return setsockopt(rc, syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+}
@@ -0,0 +1,83 @@
+//go:build windows
+
+package nutsak
+
+import "syscall"
+
+// ipv6TClass is missing from the syscall package on Windows.
+const ipv6TClass int = 39
+
+// setBindDevice is not supported on Windows.
+func setBindDevice(_ syscall.RawConn, _ string, _ bool) error {
+	return errUnsupported()
+}
+
+// setMark is not supported on Windows.
+func setMark(_ syscall.RawConn, _ int) error {
+	return errUnsupported()
+}
+
+// setReusePort is not supported on Windows.
+func setReusePort(_ syscall.RawConn) error {
+	return errUnsupported()
+}
+
+// setsockoptInet4 will set an IPv4 address socket option on the
+// provided socket handle.
+func setsockoptInet4(fd uintptr, lvl int, opt int, v [4]byte) error {
+	return syscall.SetsockoptInet4Addr(
+		syscall.Handle(fd),
+		lvl,
+		opt,
+		v,
+	)
+}
+
+// setsockoptIPMreq will set an IPv4 multicast group socket option
+// on the provided socket handle.
+func setsockoptIPMreq(
+	fd uintptr,
+	lvl int,
+	opt int,
+	mreq *syscall.IPMreq,
+) error {
+	return syscall.SetsockoptIPMreq(
+		syscall.Handle(fd),
+		lvl,
+		opt,
+		mreq,
+	)
+}
+
+// setsockoptIPv6Mreq will set an IPv6 multicast group socket option
+// on the provided socket handle.
+func setsockoptIPv6Mreq(
+	fd uintptr,
+	lvl int,
+	opt int,
+	mreq *syscall.IPv6Mreq,
+) error {
+	return syscall.SetsockoptIPv6Mreq(
+		syscall.Handle(fd),
+		lvl,
+		opt,
+		mreq,
+	)
+}
+
+// setsockoptInt will set an integer socket option on the provided
+// socket handle.
+func setsockoptInt(fd uintptr, lvl int, opt int, v int) error {
+	return syscall.SetsockoptInt(syscall.Handle(fd), lvl, opt, v)
+}
+
+// setTOS will set the type of service (IPv4) or traffic class (IPv6)
+// on the provided raw connection. Windows may silently ignore this
+// without the appropriate QoS policy.
+func setTOS(rc syscall.RawConn, tos int, v6 bool) error {
+	if v6 {
+		return setsockopt(rc, syscall.IPPROTO_IPV6, ipv6TClass, tos)
+	}
+
+	return setsockopt(rc, syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+}
@@ -0,0 +1,251 @@
+package nutsak
+
+import (
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mjwhitta/errors"
+)
+
+// sockOpts are the socket options shared by all network NUts. They
+// are applied to new sockets from a net.Dialer or net.ListenConfig
+// Control hook, before any connect or bind.
+type sockOpts struct {
+	bindDevice string
+	keepalive  time.Duration
+	linger     int
+	mark       int
+	noDelay    int
+	rcvbuf     int
+	reuseaddr  bool
+	reuseport  bool
+	sndbuf     int
+	tos        int
+	ttl        int
+}
+
+func newSockOpts() *sockOpts {
+	return &sockOpts{linger: -1, mark: -1, noDelay: -1, tos: -1}
+}
+
+// control will apply any socket options to the provided raw
+// connection. Errors name the option, so that unsupported platforms
+// or missing privileges are clear.
+func (o *sockOpts) control(
+	network string,
+	_ string,
+	rc syscall.RawConn,
+) error {
+	var e error
+	var v6 bool = strings.HasSuffix(network, "6")
+
+	if o.bindDevice != "" {
+		if e = setBindDevice(rc, o.bindDevice, v6); e != nil {
+			return errors.Newf("bind-device %s: %w", o.bindDevice, e)
+		}
+	}
+
+	if o.mark >= 0 {
+		if e = setMark(rc, o.mark); e != nil {
+			return errors.Newf("mark %d: %w", o.mark, e)
+		}
+	}
+
+	if o.rcvbuf > 0 {
+		if e = setRcvBuf(rc, o.rcvbuf); e != nil {
+			return errors.Newf("rcvbuf %d: %w", o.rcvbuf, e)
+		}
+	}
+
+	if o.reuseaddr {
+		if e = setReuseAddr(rc); e != nil {
+			return errors.Newf("reuseaddr: %w", e)
+		}
+	}
+
+	if o.reuseport {
+		if e = setReusePort(rc); e != nil {
+			return errors.Newf("reuseport: %w", e)
+		}
+	}
+
+	if o.sndbuf > 0 {
+		if e = setSndBuf(rc, o.sndbuf); e != nil {
+			return errors.Newf("sndbuf %d: %w", o.sndbuf, e)
+		}
+	}
+
+	if o.tos >= 0 {
+		if e = setTOS(rc, o.tos, v6); e != nil {
+			return errors.Newf("tos %d: %w", o.tos, e)
+		}
+	}
+
+	if o.ttl > 0 {
+		if e = setTTL(rc, o.ttl, v6); e != nil {
+			return errors.Newf("ttl %d: %w", o.ttl, e)
+		}
+	}
+
+	return nil
+}
+
+// dialer will return a dialer that applies the socket options,
+// bound to the provided local address. The caller must pass an
+// untyped nil to leave the dialer unbound. When a name resolves to
+// both IPv6 and IPv4 addresses, the dialer starts on the other family
+// if the first hasn't connected within the fallback delay. The delay
+// is the Connection Attempt Delay recommended by RFC 8305.
+//
+//nolint:mnd // RFC 8305 delay
+func (o *sockOpts) dialer(local net.Addr) *net.Dialer {
+	return &net.Dialer{
+		Control:       o.control,
+		FallbackDelay: 250 * time.Millisecond,
+		KeepAlive:     o.keepalive,
+		LocalAddr:     local,
+	}
+}
+
+// errUnsupported will return an error for socket options that are
+// not available on the current platform.
+func errUnsupported() error {
+	return errors.Newf("not supported on %s", runtime.GOOS)
+}
+
+// listenConfig will return a listen config that applies the socket
+// options.
+func (o *sockOpts) listenConfig() *net.ListenConfig {
+	return &net.ListenConfig{
+		Control:   o.control,
+		KeepAlive: o.keepalive,
+	}
+}
+
+// parse will parse the provided option, if it is a socket option. It
+// returns whether or not the option was consumed. Stream only options
+// are not consumed for datagram sockets.
+//
+//nolint:mnd // Byte sized values
+func (o *sockOpts) parse(
+	k string,
+	v string,
+	stream bool,
+) (bool, error) {
+	var d time.Duration
+	var e error
+	var n int64
+
+	switch k {
+	case "bind-device":
+		if v == "" {
+			return true, errors.Newf("invalid %s %s", k, v)
+		}
+
+		o.bindDevice = v
+	case "keepalive", "linger":
+		if !stream {
+			return false, nil
+		}
+
+		if d, e = time.ParseDuration(v); e != nil {
+			return true, errors.Newf("invalid %s %s: %w", k, v, e)
+		} else if d < 0 {
+			return true, errors.Newf("invalid %s %s", k, v)
+		}
+
+		if k == "linger" {
+			// Round up, as truncating to 0 would reset connections
+			o.linger = int((d + time.Second - 1) / time.Second)
+		} else if o.keepalive = d; d == 0 {
+			o.keepalive = -1 // Disabled
+		}
+	case "mark":
+		if n, e = strconv.ParseInt(v, 0, 64); e != nil {
+			return true, errors.Newf("invalid %s %s: %w", k, v, e)
+		} else if (n < 0) || (n > 0xffffffff) {
+			return true, errors.Newf("invalid %s %s", k, v)
+		}
+
+		o.mark = int(n)
+	case "nodelay":
+		if !stream {
+			return false, nil
+		}
+
+		switch v {
+		case "", "on":
+			o.noDelay = 1
+		case "off":
+			o.noDelay = 0
+		default:
+			return true, errors.Newf("invalid %s %s", k, v)
+		}
+	case "rcvbuf", "sndbuf":
+		if n, e = strconv.ParseInt(v, 0, 32); e != nil {
+			return true, errors.Newf("invalid %s %s: %w", k, v, e)
+		} else if n <= 0 {
+			return true, errors.Newf("invalid %s %s", k, v)
+		}
+
+		if k == "rcvbuf" {
+			o.rcvbuf = int(n)
+		} else {
+			o.sndbuf = int(n)
+		}
+	case "reuseaddr":
+		o.reuseaddr = true
+	case "reuseport":
+		o.reuseport = true
+	case "tos":
+		if n, e = strconv.ParseInt(v, 0, 64); e != nil {
+			return true, errors.Newf("invalid %s %s: %w", k, v, e)
+		} else if (n < 0) || (n > 255) {
+			return true, errors.Newf("invalid %s %s", k, v)
+		}
+
+		o.tos = int(n)
+	case "ttl":
+		if n, e = strconv.ParseInt(v, 0, 64); e != nil {
+			return true, errors.Newf("invalid %s %s: %w", k, v, e)
+		} else if (n < 1) || (n > 255) {
+			return true, errors.Newf("invalid %s %s", k, v)
+		}
+
+		o.ttl = int(n)
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// tune will apply any socket options that Go would otherwise
+// override once a TCP connection is established.
+func (o *sockOpts) tune(c net.Conn) error {
+	var e error
+	var ok bool
+	var tc *net.TCPConn
+
+	if tc, ok = c.(*net.TCPConn); !ok {
+		return nil
+	}
+
+	if o.linger >= 0 {
+		if e = tc.SetLinger(o.linger); e != nil {
+			return errors.Newf("linger %d: %w", o.linger, e)
+		}
+	}
+
+	if o.noDelay >= 0 {
+		if e = tc.SetNoDelay(o.noDelay == 1); e != nil {
+			return errors.Newf("nodelay: %w", e)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package nutsak
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/mjwhitta/errors"
+)
+
+// postgresSSLRequest is the magic request code a Postgres client
+// sends to ask the server to upgrade to TLS.
+const postgresSSLRequest uint32 = 80877103
+
+// StartTLSNUt is a TLS network utility that speaks a plaintext
+// protocol far enough to upgrade the connection to TLS.
+type StartTLSNUt struct {
+	*TLSNUt
+}
+
+// NewStartTLSNUt will return a pointer to a STARTTLS network utility
+// instance with the provided seed.
+func NewStartTLSNUt(seed string) (NUt, error) {
+	var e error
+	var nut *StartTLSNUt = &StartTLSNUt{TLSNUt: newTLSNUt(seed)}
+
+	switch nut.Type() {
+	case "starttls-ftp":
+		nut.starttls = starttlsFTP
+	case "starttls-imap":
+		nut.starttls = starttlsIMAP
+	case "starttls-postgres":
+		nut.starttls = starttlsPostgres
+	case "starttls-smtp":
+		nut.starttls = starttlsSMTP
+	default:
+		e = errors.Newf("unknown starttls type %s", nut.Type())
+		return nil, e
+	}
+
+	nut.mode = modeClient
+
+	if e = nut.parseConfig(); e != nil {
+		return nil, e
+	}
+
+	return nut, nil
+}
+
+// readReply will read a (possibly multi-line) FTP or SMTP reply and
+// ensure it has the expected status code.
+func readReply(r *bufio.Reader, code string) error {
+	var e error
+	var line string
+
+	for {
+		if line, e = r.ReadString('\n'); e != nil {
+			return errors.Newf("failed to read reply: %w", e)
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+
+		//nolint:mnd // 3 digit code followed by separator
+		if (len(line) < 4) || (line[3] != '-') {
+			break
+		}
+	}
+
+	if !strings.HasPrefix(line, code) {
+		return errors.Newf("unexpected reply: %s", line)
+	}
+
+	return nil
+}
+
+// sendCmd will send a command and then read the reply.
+func sendCmd(
+	c net.Conn,
+	r *bufio.Reader,
+	cmd string,
+	code string,
+) error {
+	if _, e := io.WriteString(c, cmd+"\r\n"); e != nil {
+		return errors.Newf("failed to send %s: %w", cmd, e)
+	}
+
+	return readReply(r, code)
+}
+
+func starttlsFTP(c net.Conn) error {
+	var r *bufio.Reader = bufio.NewReader(c)
+
+	if e := readReply(r, "220"); e != nil {
+		return e
+	}
+
+	if e := sendCmd(c, r, "AUTH TLS", "234"); e != nil {
+		return e
+	}
+
+	return unbuffered(r)
+}
+
+func starttlsIMAP(c net.Conn) error {
+	var e error
+	var line string
+	var r *bufio.Reader = bufio.NewReader(c)
+
+	if line, e = r.ReadString('\n'); e != nil {
+		return errors.Newf("failed to read greeting: %w", e)
+	} else if !strings.HasPrefix(line, "* OK") {
+		return errors.Newf("unexpected greeting: %s", line)
+	}
+
+	if _, e = io.WriteString(c, "a001 STARTTLS\r\n"); e != nil {
+		return errors.Newf("failed to send STARTTLS: %w", e)
+	}
+
+	// Skip any untagged responses
+	for {
+		if line, e = r.ReadString('\n'); e != nil {
+			return errors.Newf("failed to read reply: %w", e)
+		}
+
+		if strings.HasPrefix(line, "a001 ") {
+			break
+		}
+	}
+
+	if !strings.HasPrefix(line, "a001 OK") {
+		line = strings.TrimRight(line, "\r\n")
+		return errors.Newf("unexpected reply: %s", line)
+	}
+
+	return unbuffered(r)
+}
+
+func starttlsPostgres(c net.Conn) error {
+	var b []byte = make([]byte, 8) //nolint:mnd // Length + code
+
+	binary.BigEndian.PutUint32(b[0:4], uint32(len(b)))
+	binary.BigEndian.PutUint32(b[4:8], postgresSSLRequest)
+
+	if _, e := c.Write(b); e != nil {
+		return errors.Newf("failed to send SSLRequest: %w", e)
+	}
+
+	if _, e := io.ReadFull(c, b[0:1]); e != nil {
+		return errors.Newf("failed to read reply: %w", e)
+	}
+
+	if b[0] != 'S' {
+		return errors.New("server refused SSL")
+	}
+
+	return nil
+}
+
+func starttlsSMTP(c net.Conn) error {
+	var r *bufio.Reader = bufio.NewReader(c)
+
+	if e := readReply(r, "220"); e != nil {
+		return e
+	}
+
+	if e := sendCmd(c, r, "EHLO localhost", "250"); e != nil {
+		return e
+	}
+
+	if e := sendCmd(c, r, "STARTTLS", "220"); e != nil {
+		return e
+	}
+
+	return unbuffered(r)
+}
+
+// unbuffered will ensure the server didn't send anything after
+// agreeing to upgrade, as it would otherwise be lost.
+func unbuffered(r *bufio.Reader) error {
+	if r.Buffered() > 0 {
+		return errors.New("unexpected data before TLS handshake")
+	}
+
+	return nil
+}
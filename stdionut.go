@@ -17,6 +17,7 @@ type StdioNUt struct {
 func NewStdioNUt(seed string) (NUt, error) {
 	var e error
 	var nut *StdioNUt = &StdioNUt{super(seed)}
+	var ok bool
 
 	switch nut.Type() {
 	case "-":
@@ -27,10 +28,12 @@ func NewStdioNUt(seed string) (NUt, error) {
 		return nil, e
 	}
 
-	for k := range nut.config {
+	for k, v := range nut.config {
 		if k == "addr" {
 			continue
-		} else {
+		} else if ok, e = nut.parseLimit(k, v); e != nil {
+			return nil, e
+		} else if !ok {
 			e = errors.Newf("unknown %s option %s", nut.Type(), k)
 			return nil, e
 		}
@@ -51,11 +54,11 @@ func (nut *StdioNUt) Down() error {
 	defer nut.lock.Unlock()
 
 	// Check if already down
-	if !nut.up {
+	if !nut.up.Load() {
 		return nil
 	}
 
-	nut.up = false
+	nut.up.Store(false)
 	_ = nut.baseNUt.Down()
 
 	return nil
@@ -65,7 +68,7 @@ func (nut *StdioNUt) Down() error {
 // left running upon EOF. In the case of stdio, it should always
 // return true, if it is also up.
 func (nut *StdioNUt) KeepAlive() bool {
-	return nut.up
+	return nut.up.Load()
 }
 
 // Read will read from stdin.
@@ -75,7 +78,7 @@ func (nut *StdioNUt) Read(p []byte) (int, error) {
 	var e error
 	var n int
 
-	if !nut.up {
+	if !nut.up.Load() {
 		logSubInfo(2, "%s read: not up", nut.String())
 		return 0, io.EOF
 	}
@@ -83,13 +86,19 @@ func (nut *StdioNUt) Read(p []byte) (int, error) {
 	n, e = nut.prIn.Read(p)
 	logSubInfo(2, "%s read: %d bytes", nut.String(), n)
 
-	if !nut.up {
+	if !nut.up.Load() {
 		e = nil
 	}
 
 	return n, e
 }
 
+// shared will return whether or not fork sessions must share the
+// network utility. In the case of stdio, there is only one.
+func (nut *StdioNUt) shared() bool {
+	return true
+}
+
 // Up will start the network utility. In the case of stdio, it will do
 // nothing.
 func (nut *StdioNUt) Up() error {
@@ -97,7 +106,7 @@ func (nut *StdioNUt) Up() error {
 	defer nut.lock.Unlock()
 
 	// Check if already up
-	if nut.up {
+	if nut.up.Load() {
 		return nil
 	}
 
@@ -110,7 +119,7 @@ func (nut *StdioNUt) Up() error {
 		_, _ = io.Copy(os.Stdout, nut.prOut)
 	}()
 
-	nut.up = true
+	nut.up.Store(true)
 
 	logGood(1, "opened stdio")
 
@@ -124,7 +133,7 @@ func (nut *StdioNUt) Write(p []byte) (int, error) {
 	var e error
 	var n int
 
-	if !nut.up {
+	if !nut.up.Load() {
 		logSubInfo(2, "%s write: not up", nut.String())
 		return 0, io.EOF
 	}
@@ -132,7 +141,7 @@ func (nut *StdioNUt) Write(p []byte) (int, error) {
 	n, e = nut.pwOut.Write(p)
 	logSubInfo(2, "%s write: %d bytes", nut.String(), n)
 
-	if !nut.up {
+	if !nut.up.Load() {
 		e = nil
 	}
 
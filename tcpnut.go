@@ -1,9 +1,12 @@
 package nutsak
 
 import (
+	"context"
 	"io"
 	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mjwhitta/errors"
@@ -13,30 +16,52 @@ import (
 type TCPNUt struct {
 	*baseNUt
 
+	acl        *aclRules
 	addr       string
+	addrs      *connAddrs
+	bind       string
 	conn       *net.TCPConn
-	connecting bool
+	connecting *atomic.Bool
+	conns      *connLimits
+	done       chan struct{}
 	echo       bool
 	fork       bool
+	forks      chan NUt
 	list       *net.TCPListener
 	mode       int
+	network    string
+	retry      *retryOpts
+	served     *atomic.Uint64
+	sock       *sockOpts
 }
 
 // NewTCPNUt will return a pointer to a TCP network utility instance
 // with the provided seed.
 func NewTCPNUt(seed string) (NUt, error) {
 	var e error
-	var nut *TCPNUt = &TCPNUt{}
+	var nut *TCPNUt = &TCPNUt{
+		acl:        newACLRules(),
+		addrs:      &connAddrs{},
+		connecting: &atomic.Bool{},
+		conns:      newConnLimits(),
+		retry:      newRetryOpts(),
+		served:     &atomic.Uint64{},
+		sock:       newSockOpts(),
+	}
+	var ok bool
 
 	// Inherit
 	nut.baseNUt = super(seed)
 
 	switch nut.Type() {
-	case "tcp":
+	case "tcp", "tcp4", "tcp6":
 		nut.mode = modeClient
-	case "tcp-l", "tcp-listen":
+		nut.network = nut.Type()
+	case "tcp-l", "tcp-listen", "tcp4-l", "tcp4-listen", "tcp6-l",
+		"tcp6-listen":
 		nut.mode = modeServer
-		nut.theType = "tcp-listen"
+		nut.network, _, _ = strings.Cut(nut.Type(), "-")
+		nut.theType = nut.network + "-listen"
 	default:
 		return nil, errors.Newf("unknown tcp type %s", nut.Type())
 	}
@@ -45,9 +70,20 @@ func NewTCPNUt(seed string) (NUt, error) {
 	for k, v := range nut.config {
 		switch k {
 		case "addr":
-			nut.addr = v
-			if !strings.Contains(nut.addr, ":") {
-				nut.addr = "0.0.0.0:" + nut.addr
+			if nut.addr, e = normalizeAddr(v); e != nil {
+				return nil, e
+			}
+		case "bind":
+			if nut.mode == modeServer {
+				return nil, errors.Newf(
+					"unknown %s option %s",
+					nut.Type(),
+					k,
+				)
+			}
+
+			if nut.bind, e = parseBind(v); e != nil {
+				return nil, e
 			}
 		case "echo":
 			if nut.mode == modeClient {
@@ -69,60 +105,164 @@ func NewTCPNUt(seed string) (NUt, error) {
 			}
 
 			nut.fork = true
+		case "pf":
+			nut.network, e = parseFamily(nut.network, v)
+			if e != nil {
+				return nil, e
+			}
 		default:
-			e = errors.Newf("unknown %s option %s", nut.Type(), k)
-			return nil, e
+			ok, e = nut.retry.parse(k, v, nut.mode == modeClient)
+			if !ok && (e == nil) {
+				ok, e = nut.conns.parse(k, v, nut.mode == modeServer)
+			}
+
+			if !ok && (e == nil) {
+				ok, e = nut.acl.parse(k, v, nut.mode == modeServer)
+			}
+
+			if !ok && (e == nil) {
+				ok, e = nut.sock.parse(k, v, true)
+			}
+
+			if !ok && (e == nil) {
+				ok, e = nut.parseLimit(k, v)
+			}
+
+			if e != nil {
+				return nil, e
+			} else if !ok {
+				e = errors.Newf("unknown %s option %s", nut.Type(), k)
+				return nil, e
+			}
 		}
 	}
 
-	if nut.addr == "" {
+	if nut.config["addr"] == "" {
 		return nil, errors.Newf("no %s addr provided", nut.Type())
 	}
 
 	return nut, nil
 }
 
-func (nut *TCPNUt) connect(addr string) error {
-	var a *net.TCPAddr
+// connect will connect to the provided address in the background,
+// reconnecting until done is closed. The returned channel receives
+// the result of the first connection.
+// clients will return how many clients the listener has served
+// without fork.
+func (nut *TCPNUt) clients() uint64 {
+	return nut.served.Load()
+}
+
+func (nut *TCPNUt) connect(
+	addr string,
+	done chan struct{},
+) (chan error, error) {
+	var d *net.Dialer = nut.sock.dialer(nil)
+	var dial func(ctx context.Context) error
 	var e error
+	var local *net.TCPAddr
+	var ready chan error = make(chan error, 1)
 
-	if a, e = net.ResolveTCPAddr("tcp", addr); e != nil {
-		return errors.Newf("failed to resolve %s: %w", addr, e)
+	logResolved(nut.network, addr)
+
+	// Fail early if the address can't be resolved at all
+	if _, e = net.ResolveTCPAddr(nut.network, addr); e != nil {
+		return nil, errors.Newf("failed to resolve %s: %w", addr, e)
+	}
+
+	if nut.bind != "" {
+		local, e = net.ResolveTCPAddr(nut.network, nut.bind)
+		if e != nil {
+			e = errors.Newf("failed to resolve %s: %w", nut.bind, e)
+			return nil, e
+		}
+
+		d = nut.sock.dialer(local)
+	}
+
+	d.Timeout = nut.retry.timeout
+
+	dial = func(ctx context.Context) error {
+		var c net.Conn
+		var e error
+
+		// Dial by name, so every reconnect re-resolves, and the
+		// dialer falls back to the other family, or to the next
+		// record, on failure
+		if c, e = d.DialContext(ctx, nut.network, addr); e != nil {
+			return e //nolint:wrapcheck // Wrapped by caller
+		}
+
+		if c.RemoteAddr().String() != addr {
+			logSubInfo(1, "Connected to %s", c.RemoteAddr())
+		}
+
+		if e = nut.sock.tune(c); e != nil {
+			_ = c.Close()
+			return e
+		}
+
+		nut.lock.Lock()
+		defer nut.lock.Unlock()
+
+		// Down may have been called while dialing
+		if isClosed(done) {
+			_ = c.Close()
+			return errors.New("canceled")
+		}
+
+		nut.conn = c.(*net.TCPConn) //nolint:forcetypeassert // TCP
+		nut.addrs.set(c)
+
+		return nil
 	}
 
 	go func() {
+		var c *net.TCPConn
+		var connected bool
 		//nolint:mnd // 2 goroutines
 		var up chan struct{} = make(chan struct{}, 2)
 		//nolint:mnd // 2 goroutines
 		var wait chan struct{} = make(chan struct{}, 2)
 
-		for nut.up {
-			if nut.conn, e = net.DialTCP("tcp", nil, a); e != nil {
-				if nut.up {
-					e = errors.Newf("connect failed: %w", e)
+		for nut.up.Load() {
+			if e := nut.retry.dial(done, dial); e != nil {
+				if !connected {
+					ready <- e
+				} else if nut.up.Load() {
+					// Out of retries, so give up on reconnecting
 					logErr(1, "%s", e.Error())
+					_ = nut.Down()
 				}
 
-				time.Sleep(time.Second)
+				return
+			}
 
-				continue
+			if !connected {
+				connected = true
+				ready <- nil
 			}
 
-			go func() {
+			// Set by dial, under the lock that Down takes
+			nut.lock.RLock()
+			c = nut.conn
+			nut.lock.RUnlock()
+
+			go func(c *net.TCPConn) {
 				up <- struct{}{}
 
-				_, _ = io.Copy(nut.pwIn, nut.conn)
+				_, _ = io.Copy(nut.pwIn, c)
 
 				wait <- struct{}{}
-			}()
+			}(c)
 
-			go func() {
+			go func(c *net.TCPConn) {
 				up <- struct{}{}
 
-				_, _ = io.Copy(nut.conn, nut.prOut)
+				_, _ = io.Copy(c, nut.prOut)
 
 				wait <- struct{}{}
-			}()
+			}(c)
 
 			// Wait for up
 			<-up
@@ -130,7 +270,7 @@ func (nut *TCPNUt) connect(addr string) error {
 			time.Sleep(time.Millisecond)
 
 			// Officially up and running
-			nut.connecting = false
+			nut.connecting.Store(false)
 
 			// Block
 			<-wait
@@ -138,7 +278,7 @@ func (nut *TCPNUt) connect(addr string) error {
 		}
 	}()
 
-	return nil
+	return ready, nil
 }
 
 // Down will stop the network utility. In the case of TCP, it will
@@ -150,13 +290,14 @@ func (nut *TCPNUt) Down() error {
 	defer nut.lock.Unlock()
 
 	// Check if already down
-	if !nut.up {
+	if !nut.up.Load() {
 		return nil
 	}
 
 	// Down before closing connection/listener and pipes
-	nut.connecting = false
-	nut.up = false
+	nut.connecting.Store(false)
+	nut.up.Store(false)
+	close(nut.done)
 
 	// Close connection/listener
 	switch nut.mode {
@@ -180,12 +321,18 @@ func (nut *TCPNUt) Down() error {
 	return e
 }
 
+// endpoints will return the local and remote addresses of the most
+// recent connection.
+func (nut *TCPNUt) endpoints() (net.Addr, net.Addr) {
+	return nut.addrs.endpoints()
+}
+
 // KeepAlive will return whether or not the network utility should be
 // left running upon EOF. In the case of TCP, it is dependent upon
 // mode.
 func (nut *TCPNUt) KeepAlive() bool {
 	if nut.mode == modeServer {
-		return nut.up
+		return nut.up.Load()
 	}
 
 	return false
@@ -194,31 +341,69 @@ func (nut *TCPNUt) KeepAlive() bool {
 func (nut *TCPNUt) listen(addr string) error {
 	var a *net.TCPAddr
 	var c *net.TCPConn
+	var done chan struct{} = nut.done
 	var e error
-
-	if a, e = net.ResolveTCPAddr("tcp", addr); e != nil {
+	var forks chan NUt
+	var l net.Listener
+	var list *net.TCPListener
+	var ok bool
+	var reason string
+	var release func()
+	var slots chan struct{}
+	var wg sync.WaitGroup
+
+	logResolved(nut.network, addr)
+
+	if a, e = net.ResolveTCPAddr(nut.network, addr); e != nil {
 		return errors.Newf("failed to resolve %s: %w", addr, e)
 	}
 
-	if nut.list, e = net.ListenTCP("tcp", a); e != nil {
+	l, e = nut.sock.listenConfig().Listen(
+		context.Background(),
+		nut.network,
+		a.String(),
+	)
+	if e != nil {
 		return errors.Newf("failed to listen on %s: %w", addr, e)
 	}
 
+	list = l.(*net.TCPListener) //nolint:forcetypeassert // TCP
+	nut.list = list
+	nut.conns.reset()
+
+	if nut.fork {
+		forks = make(chan NUt)
+		nut.forks = forks
+	}
+
 	go func() {
+		var throttled func() = func() {
+			nut.count("throttled", 1)
+		}
 		//nolint:mnd // 2 goroutines
 		var up chan struct{} = make(chan struct{}, 2)
-		var wait chan struct{}
+		//nolint:mnd // 2 goroutines
+		var wait chan struct{} = make(chan struct{}, 2)
 
-		if nut.fork {
-			wait = make(chan struct{}, 1)
-		} else {
-			//nolint:mnd // 2 goroutines
-			wait = make(chan struct{}, 2)
+		// No more sessions once the listener is down
+		if forks != nil {
+			defer func() {
+				wg.Wait()
+				close(forks)
+			}()
 		}
 
 		for {
-			if c, e = nut.list.AcceptTCP(); e != nil {
-				if nut.up {
+			slots = nut.conns.wait(throttled)
+
+			if c, e = list.AcceptTCP(); e != nil {
+				nut.conns.free(slots)
+
+				if isClosed(done) {
+					return
+				}
+
+				if nut.up.Load() {
 					e = errors.Newf("connection failed: %w", e)
 					logErr(1, "%s", e.Error())
 				}
@@ -228,23 +413,87 @@ func (nut *TCPNUt) listen(addr string) error {
 				continue
 			}
 
+			if reason = nut.acl.check(c.RemoteAddr()); reason != "" {
+				nut.conns.free(slots)
+				nut.count("denied", 1)
+				logWarn(
+					1,
+					"Rejected connection from %s: %s",
+					c.RemoteAddr().String(),
+					reason,
+				)
+				_ = c.Close()
+
+				continue
+			}
+
+			nut.conns.pace(throttled)
+
+			if release, ok = nut.conns.admit(c, slots); !ok {
+				nut.count("rejected", 1)
+				logWarn(
+					1,
+					"Rejected connection from %s: max-conns-per-ip",
+					c.RemoteAddr().String(),
+				)
+				_ = c.Close()
+
+				continue
+			}
+
+			nut.count("accepted", 1)
+
+			if e = nut.sock.tune(c); e != nil {
+				logErr(1, "%s", e.Error())
+			}
+
 			logGood(1, "Connection from %s", c.RemoteAddr().String())
+			nut.addrs.set(c)
+
+			// Each forked connection is its own session
+			if forks != nil {
+				wg.Add(1)
+
+				go func(c *net.TCPConn, release func()) {
+					defer wg.Done()
+
+					forkSession(
+						newTCPSession(
+							"tcp-session",
+							nut,
+							c,
+							nut.echo,
+							release,
+						),
+						forks,
+						done,
+					)
+				}(c, release)
+
+				continue
+			}
 
-			go func() {
+			// Anything kept for the previous client starts over
+			nut.served.Add(1)
+
+			go func(c *net.TCPConn, release func()) {
 				up <- struct{}{}
 
 				_, _ = io.Copy(nut.pwIn, c)
 
+				// Free the slot once the client stops sending
+				release()
+
 				wait <- struct{}{}
-			}()
+			}(c, release)
 
-			go func() {
+			go func(c *net.TCPConn) {
 				up <- struct{}{}
 
 				_, _ = io.Copy(c, nut.prOut)
 
 				wait <- struct{}{}
-			}()
+			}(c)
 
 			// Wait for up
 			<-up
@@ -252,13 +501,10 @@ func (nut *TCPNUt) listen(addr string) error {
 			time.Sleep(time.Millisecond)
 
 			// Officially up and running
-			nut.connecting = false
+			nut.connecting.Store(false)
 
 			// Block
-			if !nut.fork {
-				<-wait
-			}
-
+			<-wait
 			<-wait
 		}
 	}()
@@ -266,22 +512,27 @@ func (nut *TCPNUt) listen(addr string) error {
 	return nil
 }
 
-// Read will read from the current TCP connection.
+// Read will read from the current TCP connection. In fork mode, each
+// session is read separately, so it will return EOF.
 //
 //nolint:dupl, mnd // TLS is TCP (so yeah), Log levels
 func (nut *TCPNUt) Read(p []byte) (int, error) {
 	var e error
 	var n int
 
-	if nut.connecting {
+	if nut.fork {
+		return 0, io.EOF
+	}
+
+	if nut.connecting.Load() {
 		logSubInfo(2, "%s read: still connecting", nut.String())
 	}
 
-	for nut.connecting {
+	for nut.connecting.Load() {
 		time.Sleep(time.Millisecond)
 	}
 
-	if !nut.up {
+	if !nut.up.Load() {
 		logSubInfo(2, "%s read: not up", nut.String())
 		return 0, io.EOF
 	}
@@ -289,7 +540,7 @@ func (nut *TCPNUt) Read(p []byte) (int, error) {
 	if n, e = nut.prIn.Read(p); e != nil {
 		logSubInfo(2, "%s read: %d bytes", nut.String(), n)
 
-		if !nut.up || (nut.mode == modeServer) {
+		if !nut.up.Load() || (nut.mode == modeServer) {
 			e = nil
 		}
 
@@ -307,55 +558,104 @@ func (nut *TCPNUt) Read(p []byte) (int, error) {
 	return n, nil
 }
 
+// Sessions will return a channel that receives a new NUt for each
+// client connection, or nil if not in fork mode. Each time the
+// listener comes up, it creates a new channel, which is closed when
+// it goes down. Until then, the returned channel is already closed.
+func (nut *TCPNUt) Sessions() <-chan NUt {
+	var none chan NUt
+
+	if !nut.fork {
+		return nil
+	}
+
+	nut.lock.RLock()
+	defer nut.lock.RUnlock()
+
+	if nut.forks == nil {
+		none = make(chan NUt)
+		close(none)
+
+		return none
+	}
+
+	return nut.forks
+}
+
 // Up will start the network utility. In the case of TCP, it will
-// either connect or listen, depending on the mode.
+// either connect or listen, depending on the mode. Clients wait for
+// the first connection, so failures reach the caller, but Down can
+// still cancel it.
 func (nut *TCPNUt) Up() error {
+	var done chan struct{} = make(chan struct{})
 	var e error
+	var ready chan error
 
 	nut.lock.Lock()
-	defer nut.lock.Unlock()
 
 	// Check if already up
-	if nut.up {
+	if nut.up.Load() {
+		nut.lock.Unlock()
 		return nil
 	}
 
 	// Up after pipes created
 	_ = nut.baseNUt.Up()
-	nut.connecting = true
-	nut.up = true
+	nut.connecting.Store(true)
+	nut.done = done
+	nut.up.Store(true)
 
 	// Create connection/listener
 	switch nut.mode {
 	case modeClient:
-		e = nut.connect(nut.addr)
+		ready, e = nut.connect(nut.addr, done)
 	case modeServer:
 		e = nut.listen(nut.addr)
 	}
 
+	// Don't hold the lock while connecting, or Down would block
+	nut.lock.Unlock()
+
+	if (e == nil) && (ready != nil) {
+		e = <-ready
+	}
+
 	if e != nil {
-		nut.up = false
+		nut.lock.Lock()
+		defer nut.lock.Unlock()
+
+		// Unless Down already stopped this attempt
+		if !isClosed(done) {
+			nut.connecting.Store(false)
+			nut.up.Store(false)
+			close(done)
+		}
 	}
 
 	return e
 }
 
-// Write will write to the current TCP connection.
+// Write will write to the current TCP connection. In fork mode, each
+// session is written separately, so it will return EOF.
 //
 //nolint:mnd // Log levels
 func (nut *TCPNUt) Write(p []byte) (int, error) {
 	var e error
 	var n int
 
-	if nut.connecting {
+	if nut.fork {
+		return 0, io.EOF
+	}
+
+	if nut.connecting.Load() {
 		logSubInfo(2, "%s write: still connecting", nut.String())
 	}
 
-	for nut.connecting {
+	for nut.connecting.Load() {
 		time.Sleep(time.Millisecond)
 	}
 
-	if !nut.up {
+	if !nut.up.Load() {
 		logSubInfo(2, "%s write: not up", nut.String())
 		return 0, io.EOF
 	}
@@ -363,7 +663,7 @@ func (nut *TCPNUt) Write(p []byte) (int, error) {
 	n, e = nut.pwOut.Write(p)
 	logSubInfo(2, "%s write: %d bytes", nut.String(), n)
 
-	if !nut.up {
+	if !nut.up.Load() {
 		e = nil
 	}
 
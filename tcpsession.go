@@ -0,0 +1,172 @@
+package nutsak
+
+import (
+	"io"
+	"net"
+
+	"github.com/mjwhitta/errors"
+)
+
+// tcpSession is a single connection accepted by a forking TCP or TLS
+// listener. It is a NUt that can be paired on its own, so that each
+// client gets its own peer, rather than sharing the listener's pipes.
+type tcpSession struct {
+	*baseNUt
+
+	conn    net.Conn
+	done    chan struct{}
+	echo    bool
+	release func()
+}
+
+func newTCPSession(
+	theType string,
+	parent limiter,
+	c net.Conn,
+	echo bool,
+	release func(),
+) *tcpSession {
+	var nut *tcpSession = &tcpSession{
+		baseNUt: super(theType + ":" + c.RemoteAddr().String()),
+		conn:    c,
+		done:    make(chan struct{}),
+		echo:    echo,
+		release: release,
+	}
+
+	// Each session is its own tunnel, with the limits of the listener
+	nut.idleTimeout, nut.maxDuration = parent.limits()
+
+	return nut
+}
+
+// forkSession will send the provided session to be paired, then tear
+// it down if the listener goes down first.
+func forkSession(s *tcpSession, forks chan NUt, done chan struct{}) {
+	select {
+	case forks <- s:
+	case <-done:
+		_ = s.Down()
+		return
+	}
+
+	select {
+	case <-done:
+		_ = s.Down()
+	case <-s.done:
+	}
+}
+
+// Down will stop the network utility. In the case of a TCP session,
+// it will close the connection. A session can be torn down (such as
+// when its listener goes down) before it is ever brought up.
+func (nut *tcpSession) Down() error {
+	var e error
+
+	nut.lock.Lock()
+	defer nut.lock.Unlock()
+
+	nut.up.Store(false)
+
+	// Check if already down
+	if isClosed(nut.done) {
+		return nil
+	}
+
+	close(nut.done)
+
+	if e = nut.conn.Close(); e != nil {
+		e = errors.Newf("failed to close connection: %w", e)
+	}
+
+	// Free the slot for another client
+	nut.release()
+
+	return e
+}
+
+// endpoints will return the local and remote addresses of the
+// session.
+func (nut *tcpSession) endpoints() (net.Addr, net.Addr) {
+	return nut.conn.LocalAddr(), nut.conn.RemoteAddr()
+}
+
+// KeepAlive will return whether or not the network utility should be
+// left running upon EOF. In the case of a TCP session, it should
+// always return false, as the client is gone.
+func (nut *tcpSession) KeepAlive() bool {
+	return false
+}
+
+// Read will read from the session's connection.
+//
+//nolint:mnd // Log levels
+func (nut *tcpSession) Read(p []byte) (int, error) {
+	var e error
+	var n int
+
+	if !nut.up.Load() {
+		logSubInfo(2, "%s read: not up", nut.String())
+		return 0, io.EOF
+	}
+
+	n, e = nut.conn.Read(p)
+	logSubInfo(2, "%s read: %d bytes", nut.String(), n)
+
+	if e != nil {
+		// Free the slot once the client stops sending
+		nut.release()
+
+		return n, e //nolint:wrapcheck // Could be io.EOF
+	}
+
+	if nut.echo {
+		if _, e = nut.Write(p[:n]); e != nil {
+			return n, e
+		}
+	}
+
+	return n, nil
+}
+
+// Up will start the network utility. In the case of a TCP session,
+// the connection is already established, so it will do nothing,
+// unless the session was already torn down.
+func (nut *tcpSession) Up() error {
+	nut.lock.Lock()
+	defer nut.lock.Unlock()
+
+	if isClosed(nut.done) {
+		return errors.Newf("%s session has ended", nut.String())
+	}
+
+	nut.up.Store(true)
+
+	return nil
+}
+
+// Write will write to the session's connection.
+//
+//nolint:mnd // Log levels
+func (nut *tcpSession) Write(p []byte) (int, error) {
+	var e error
+	var n int
+
+	if !nut.up.Load() {
+		logSubInfo(2, "%s write: not up", nut.String())
+		return 0, io.EOF
+	}
+
+	n, e = nut.conn.Write(p)
+	logSubInfo(2, "%s write: %d bytes", nut.String(), n)
+
+	if e != nil {
+		if !nut.up.Load() {
+			return n, nil
+		}
+
+		return n, errors.Newf("failed to write: %w", e)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,241 @@
+package nutsak
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mjwhitta/errors"
+)
+
+// TLSInfo is a summary of a completed TLS handshake.
+type TLSInfo struct {
+	ALPN        string   `json:"alpn,omitempty"`
+	Cipher      string   `json:"cipher"`
+	Fingerprint string   `json:"fingerprint,omitempty"`
+	Issuer      string   `json:"issuer,omitempty"`
+	Remote      string   `json:"remote"`
+	Resumed     bool     `json:"resumed"`
+	SANs        []string `json:"sans,omitempty"`
+	Subject     string   `json:"subject,omitempty"`
+	Version     string   `json:"version"`
+}
+
+// NewTLSInfo will return a pointer to a TLSInfo instance describing
+// the provided connection state.
+func NewTLSInfo(remote string, state tls.ConnectionState) *TLSInfo {
+	var hash [sha256.Size]byte
+	var info *TLSInfo = &TLSInfo{
+		ALPN:    state.NegotiatedProtocol,
+		Cipher:  tls.CipherSuiteName(state.CipherSuite),
+		Remote:  remote,
+		Resumed: state.DidResume,
+		Version: tls.VersionName(state.Version),
+	}
+	var peer *x509.Certificate
+
+	if len(state.PeerCertificates) == 0 {
+		return info
+	}
+
+	peer = state.PeerCertificates[0]
+	hash = sha256.Sum256(peer.Raw)
+
+	info.Fingerprint = strings.ToUpper(hex.EncodeToString(hash[:]))
+	info.Issuer = peer.Issuer.String()
+	info.Subject = peer.Subject.String()
+
+	info.SANs = append(info.SANs, peer.DNSNames...)
+	info.SANs = append(info.SANs, peer.EmailAddresses...)
+
+	for _, ip := range peer.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+
+	for _, uri := range peer.URIs {
+		info.SANs = append(info.SANs, uri.String())
+	}
+
+	return info
+}
+
+// String will return a human-readable representation of the
+// TLSInfo.
+func (info *TLSInfo) String() string {
+	var lines [][2]string = [][2]string{
+		{"Remote", info.Remote},
+		{"Version", info.Version},
+		{"Cipher", info.Cipher},
+		{"ALPN", info.ALPN},
+		{"Resumed", strconv.FormatBool(info.Resumed)},
+		{"Subject", info.Subject},
+		{"Issuer", info.Issuer},
+		{"SANs", strings.Join(info.SANs, ", ")},
+		{"Fingerprint", info.Fingerprint},
+	}
+	var sb strings.Builder
+
+	for _, line := range lines {
+		if line[1] == "" {
+			continue
+		}
+
+		sb.WriteString(line[0] + ": " + line[1] + "\n")
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// TLSInfoNUt is a TLS network utility that will connect, report the
+// handshake details, and then disconnect.
+type TLSInfoNUt struct {
+	*TLSNUt
+
+	asJSON bool
+	info   *bytes.Reader
+}
+
+// NewTLSInfoNUt will return a pointer to a TLS info network utility
+// instance with the provided seed.
+func NewTLSInfoNUt(seed string) (NUt, error) {
+	var e error
+	var nut *TLSInfoNUt = &TLSInfoNUt{TLSNUt: newTLSNUt(seed)}
+
+	// Report failures immediately, unless asked to retry
+	nut.retry.retries = 0
+
+	switch nut.Type() {
+	case "tls-info":
+		nut.mode = modeClient
+	default:
+		e = errors.Newf("unknown tls-info type %s", nut.Type())
+		return nil, e
+	}
+
+	_, nut.asJSON = nut.config["json"]
+
+	if e = nut.parseConfig("json"); e != nil {
+		return nil, e
+	}
+
+	return nut, nil
+}
+
+// Down will stop the network utility. In the case of TLS info, the
+// connection is already closed, so it will do nothing.
+func (nut *TLSInfoNUt) Down() error {
+	nut.lock.Lock()
+	defer nut.lock.Unlock()
+
+	nut.up.Store(false)
+
+	return nil
+}
+
+// KeepAlive will return whether or not the network utility should be
+// left running upon EOF. In the case of TLS info, it should always
+// return false.
+func (nut *TLSInfoNUt) KeepAlive() bool {
+	return false
+}
+
+// Read will read the handshake details.
+//
+//nolint:mnd // Log levels
+func (nut *TLSInfoNUt) Read(p []byte) (int, error) {
+	var e error
+	var n int
+
+	if !nut.up.Load() || (nut.info == nil) {
+		logSubInfo(2, "%s read: not up", nut.String())
+		return 0, io.EOF
+	}
+
+	n, e = nut.info.Read(p)
+	logSubInfo(2, "%s read: %d bytes", nut.String(), n)
+
+	return n, e //nolint:wrapcheck // Only ever io.EOF
+}
+
+// Up will start the network utility. In the case of TLS info, it
+// will connect, record the handshake details, and disconnect.
+func (nut *TLSInfoNUt) Up() error {
+	var b []byte
+	var c *tls.Conn
+	var d *net.Dialer
+	var e error
+	var info *TLSInfo
+	var timeout time.Duration = handshakeTimeout
+
+	nut.lock.Lock()
+	defer nut.lock.Unlock()
+
+	// Check if already up
+	if nut.up.Load() {
+		return nil
+	}
+
+	logResolved(nut.network, nut.addr)
+
+	if nut.retry.timeout > 0 {
+		timeout = nut.retry.timeout
+	}
+
+	if d, e = nut.dialer(timeout); e != nil {
+		return e
+	}
+
+	e = nut.retry.dial(
+		nil,
+		func(_ context.Context) error {
+			var e error
+
+			c, e = tls.DialWithDialer(
+				d,
+				nut.network,
+				nut.addr,
+				nut.tlscfg.Load(),
+			)
+
+			return e //nolint:wrapcheck // Wrapped by caller
+		},
+	)
+	if e != nil {
+		return e
+	}
+
+	defer func() {
+		_ = c.Close()
+	}()
+
+	nut.handshook(c)
+	info = NewTLSInfo(c.RemoteAddr().String(), c.ConnectionState())
+
+	if nut.asJSON {
+		if b, e = json.MarshalIndent(info, "", "  "); e != nil {
+			return errors.Newf("failed to marshal info: %w", e)
+		}
+	} else {
+		b = []byte(info.String())
+	}
+
+	nut.info = bytes.NewReader(append(b, '\n'))
+	nut.up.Store(true)
+
+	return nil
+}
+
+// Write will discard the provided data, as there is no connection to
+// write to.
+func (nut *TLSInfoNUt) Write(p []byte) (int, error) {
+	return len(p), nil
+}
@@ -1,32 +1,72 @@
 package nutsak
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"io"
 	"net"
+	"os"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mjwhitta/errors"
+	"github.com/mjwhitta/pathname"
 )
 
+// handshakeTimeout is how long a TLS listener will wait for a client
+// to complete a handshake.
+const handshakeTimeout time.Duration = 10 * time.Second
+
 // TLSNUt is a TLS network utility.
 type TLSNUt struct {
 	*baseNUt
 
+	acl        *aclRules
 	addr       string
+	addrs      *connAddrs
+	allow      map[string][]string
+	alpn       []string
+	bind       string
 	ca         *x509.Certificate
 	cert       *x509.Certificate
+	ciphers    []uint16
 	conn       *tls.Conn
-	connecting bool
+	connecting *atomic.Bool
+	conns      *connLimits
+	crl        *x509.RevocationList
+	curves     []tls.CurveID
+	done       chan struct{}
 	echo       bool
 	fork       bool
+	forks      chan NUt
 	key        *rsa.PrivateKey
+	keylog     string
 	list       net.Listener
+	listcfg    *tls.Config
+	maxVer     uint16
+	minVer     uint16
 	mode       int
-	tlscfg     *tls.Config
+	network    string
+	noTickets  bool
+	reload     bool
+	resume     tls.ClientSessionCache
+	retry      *retryOpts
+	rotate     time.Duration
+	served     *atomic.Uint64
+	sock       *sockOpts
+	stamps     map[string]time.Time
+	starttls   func(c net.Conn) error
+	state      *atomic.Pointer[tls.ConnectionState]
+	tickets    [][32]byte
+	tlscfg     *atomic.Pointer[tls.Config]
+	tlsFiles   map[string]string
+	tlsLock    *sync.Mutex
 	verify     bool
 }
 
@@ -34,10 +74,7 @@ type TLSNUt struct {
 // with the provided seed.
 func NewTLSNUt(seed string) (NUt, error) {
 	var e error
-	var nut *TLSNUt = &TLSNUt{}
-
-	// Inherit
-	nut.baseNUt = super(seed)
+	var nut *TLSNUt = newTLSNUt(seed)
 
 	switch nut.Type() {
 	case "tls":
@@ -50,69 +87,213 @@ func NewTLSNUt(seed string) (NUt, error) {
 		return nil, e
 	}
 
-	for k, v := range nut.config {
-		if k == "addr" {
-			nut.addr = v
+	if e = nut.parseConfig(); e != nil {
+		return nil, e
+	}
 
-			if !strings.Contains(nut.addr, ":") {
-				nut.addr = "0.0.0.0:" + nut.addr
-			}
-		} else if e = nut.parseOpts(k, v); e != nil {
-			return nil, e
+	return nut, nil
+}
+
+func newTLSNUt(seed string) *TLSNUt {
+	var nut *TLSNUt = &TLSNUt{
+		acl:        newACLRules(),
+		addrs:      &connAddrs{},
+		allow:      map[string][]string{},
+		connecting: &atomic.Bool{},
+		conns:      newConnLimits(),
+		network:    "tcp",
+		retry:      newRetryOpts(),
+		served:     &atomic.Uint64{},
+		sock:       newSockOpts(),
+		stamps:     map[string]time.Time{},
+		state:      &atomic.Pointer[tls.ConnectionState]{},
+		tlscfg:     &atomic.Pointer[tls.Config]{},
+		tlsFiles:   map[string]string{},
+		tlsLock:    &sync.Mutex{},
+	}
+
+	// Inherit
+	nut.baseNUt = super(seed)
+
+	return nut
+}
+
+func (nut *TLSNUt) authorizer(
+	crl *x509.RevocationList,
+) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		var peer *x509.Certificate
+		var sans []string
+
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("no client cert provided")
+		}
+
+		peer = state.PeerCertificates[0]
+
+		// A stale CRL may be missing recent revocations
+		if (crl != nil) && isExpired(crl) {
+			return errors.Newf(
+				"crl expired at %s",
+				crl.NextUpdate.Format(time.RFC3339),
+			)
 		}
+
+		if isRevoked(crl, peer) {
+			return errors.Newf("client %s is revoked", peer.Subject)
+		}
+
+		pats, ok := nut.allow["allow-cn"]
+		if ok && !matchAny(pats, peer.Subject.CommonName) {
+			return errors.Newf(
+				"client CN %s is not allowed",
+				peer.Subject.CommonName,
+			)
+		}
+
+		pats, ok = nut.allow["allow-ou"]
+		if ok && !matchAny(pats, peer.Subject.OrganizationalUnit...) {
+			return errors.Newf(
+				"client OU %s is not allowed",
+				strings.Join(peer.Subject.OrganizationalUnit, ", "),
+			)
+		}
+
+		sans = NewTLSInfo("", state).SANs
+
+		pats, ok = nut.allow["allow-san"]
+		if ok && !matchAny(pats, sans...) {
+			return errors.Newf(
+				"client SAN %s is not allowed",
+				strings.Join(sans, ", "),
+			)
+		}
+
+		return nil
 	}
+}
+
+// clients will return how many clients the listener has served
+// without fork.
+func (nut *TLSNUt) clients() uint64 {
+	return nut.served.Load()
+}
 
-	if nut.addr == "" {
-		return nil, errors.Newf("no %s addr provided", nut.Type())
+func (nut *TLSNUt) configForClient(
+	_ *tls.ClientHelloInfo,
+) (*tls.Config, error) {
+	if nut.reload {
+		nut.reloadIfChanged()
 	}
 
-	if e = nut.setupTLSConfig(); e != nil {
-		return nil, e
+	return nut.tlscfg.Load(), nil
+}
+
+// ConnectionState will return the state of the most recent TLS
+// handshake and whether or not a handshake has happened yet.
+func (nut *TLSNUt) ConnectionState() (tls.ConnectionState, bool) {
+	if state := nut.state.Load(); state != nil {
+		return *state, true
 	}
 
-	return nut, nil
+	return tls.ConnectionState{}, false
 }
 
-func (nut *TLSNUt) connect(addr string) error {
-	if _, e := net.ResolveTCPAddr("tcp", addr); e != nil {
-		return errors.Newf("failed to resolve %s: %w", addr, e)
+// connect will connect to the provided address in the background,
+// reconnecting until done is closed. The returned channel receives
+// the result of the first connection.
+func (nut *TLSNUt) connect(
+	addr string,
+	done chan struct{},
+) (chan error, error) {
+	var dial func(ctx context.Context) error
+	var ready chan error = make(chan error, 1)
+
+	logResolved(nut.network, addr)
+
+	if _, e := net.ResolveTCPAddr(nut.network, addr); e != nil {
+		return nil, errors.Newf("failed to resolve %s: %w", addr, e)
 	}
 
-	go func() {
+	dial = func(ctx context.Context) error {
+		var c *tls.Conn
 		var e error
+
+		if nut.reload {
+			nut.reloadIfChanged()
+		}
+
+		if c, e = nut.dial(ctx, addr); e != nil {
+			return e
+		}
+
+		nut.lock.Lock()
+		defer nut.lock.Unlock()
+
+		// Down may have been called while dialing
+		if isClosed(done) {
+			_ = c.Close()
+			return errors.New("canceled")
+		}
+
+		nut.conn = c
+		nut.addrs.set(c)
+
+		if c.RemoteAddr().String() != addr {
+			logSubInfo(1, "Connected to %s", c.RemoteAddr())
+		}
+
+		return nil
+	}
+
+	go func() {
+		var c *tls.Conn
+		var connected bool
 		//nolint:mnd // 2 goroutines
 		var up chan struct{} = make(chan struct{}, 2)
 		//nolint:mnd // 2 goroutines
 		var wait chan struct{} = make(chan struct{}, 2)
 
-		for nut.up {
-			nut.conn, e = tls.Dial("tcp", addr, nut.tlscfg)
-			if e != nil {
-				if nut.up {
-					e = errors.Newf("connect failed: %w", e)
+		for nut.up.Load() {
+			if e := nut.retry.dial(done, dial); e != nil {
+				if !connected {
+					ready <- e
+				} else if nut.up.Load() {
+					// Out of retries, so give up on reconnecting
 					logErr(1, "%s", e.Error())
+					_ = nut.Down()
 				}
 
-				time.Sleep(time.Second)
+				return
+			}
 
-				continue
+			if !connected {
+				connected = true
+				ready <- nil
 			}
 
-			go func() {
+			// Set by dial, under the lock that Down takes
+			nut.lock.RLock()
+			c = nut.conn
+			nut.lock.RUnlock()
+
+			nut.handshook(c)
+
+			go func(c *tls.Conn) {
 				up <- struct{}{}
 
-				_, _ = io.Copy(nut.pwIn, nut.conn)
+				_, _ = io.Copy(nut.pwIn, c)
 
 				wait <- struct{}{}
-			}()
+			}(c)
 
-			go func() {
+			go func(c *tls.Conn) {
 				up <- struct{}{}
 
-				_, _ = io.Copy(nut.conn, nut.prOut)
+				_, _ = io.Copy(c, nut.prOut)
 
 				wait <- struct{}{}
-			}()
+			}(c)
 
 			// Wait for up
 			<-up
@@ -120,7 +301,7 @@ func (nut *TLSNUt) connect(addr string) error {
 			time.Sleep(time.Millisecond)
 
 			// Officially up and running
-			nut.connecting = false
+			nut.connecting.Store(false)
 
 			// Block
 			<-wait
@@ -128,7 +309,101 @@ func (nut *TLSNUt) connect(addr string) error {
 		}
 	}()
 
-	return nil
+	return ready, nil
+}
+
+func (nut *TLSNUt) dial(
+	ctx context.Context,
+	addr string,
+) (*tls.Conn, error) {
+	var c net.Conn
+	var cfg *tls.Config = nut.tlscfg.Load()
+	var d *net.Dialer
+	var e error
+	var tc *tls.Conn
+
+	if d, e = nut.dialer(nut.retry.timeout); e != nil {
+		return nil, e
+	}
+
+	if nut.starttls == nil {
+		c, e = (&tls.Dialer{Config: cfg, NetDialer: d}).DialContext(
+			ctx,
+			nut.network,
+			addr,
+		)
+		if e != nil {
+			return nil, e //nolint:wrapcheck // Wrapped by caller
+		}
+
+		tc = c.(*tls.Conn) //nolint:forcetypeassert // Always TLS
+
+		if e = nut.sock.tune(tc.NetConn()); e != nil {
+			_ = tc.Close()
+			return nil, e
+		}
+
+		return tc, nil
+	}
+
+	if c, e = d.DialContext(ctx, nut.network, addr); e != nil {
+		return nil, e //nolint:wrapcheck // Wrapped by caller
+	}
+
+	if e = nut.sock.tune(c); e != nil {
+		_ = c.Close()
+		return nil, e
+	}
+
+	// Speak plaintext until the server agrees to upgrade
+	_ = c.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	if e = nut.starttls(c); e != nil {
+		_ = c.Close()
+		return nil, errors.Newf("starttls failed: %w", e)
+	}
+
+	// tls.Dial() would normally set the server name from addr
+	if cfg.ServerName == "" {
+		cfg = cfg.Clone()
+		cfg.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+
+	tc = tls.Client(c, cfg)
+
+	if e = tc.HandshakeContext(ctx); e != nil {
+		_ = c.Close()
+		return nil, e //nolint:wrapcheck // Wrapped by caller
+	}
+
+	_ = c.SetDeadline(time.Time{})
+
+	return tc, nil
+}
+
+// dialer will return a dialer with the provided timeout and socket
+// options, bound to the local address from the bind option, if any.
+func (nut *TLSNUt) dialer(
+	timeout time.Duration,
+) (*net.Dialer, error) {
+	var a *net.TCPAddr
+	var d *net.Dialer = nut.sock.dialer(nil)
+	var e error
+
+	d.Timeout = timeout
+
+	if nut.bind == "" {
+		return d, nil
+	}
+
+	if a, e = net.ResolveTCPAddr(nut.network, nut.bind); e != nil {
+		e = errors.Newf("failed to resolve %s: %w", nut.bind, e)
+		return nil, e
+	}
+
+	d.LocalAddr = a
+
+	return d, nil
 }
 
 // Down will stop the network utility. In the case of TLS, it will
@@ -140,13 +415,14 @@ func (nut *TLSNUt) Down() error {
 	defer nut.lock.Unlock()
 
 	// Check if already down
-	if !nut.up {
+	if !nut.up.Load() {
 		return nil
 	}
 
 	// Down before closing connection/listener and pipes
-	nut.connecting = false
-	nut.up = false
+	nut.connecting.Store(false)
+	nut.up.Store(false)
+	close(nut.done)
 
 	// Close connection/listener
 	switch nut.mode {
@@ -170,12 +446,77 @@ func (nut *TLSNUt) Down() error {
 	return e
 }
 
+// endpoints will return the local and remote addresses of the most
+// recent connection.
+func (nut *TLSNUt) endpoints() (net.Addr, net.Addr) {
+	return nut.addrs.endpoints()
+}
+
+// handshake will complete the handshake with a newly accepted client,
+// then record the connection details.
+func (nut *TLSNUt) handshake(c net.Conn) (*tls.Conn, error) {
+	var e error
+	var ok bool
+	var tc *tls.Conn
+
+	if tc, ok = c.(*tls.Conn); !ok {
+		return nil, errors.New("connection is not TLS")
+	}
+
+	// Don't let a stalled client block forever
+	_ = tc.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	if e = tc.Handshake(); e != nil {
+		return nil, errors.Newf(
+			"handshake with %s failed: %w",
+			c.RemoteAddr().String(),
+			e,
+		)
+	}
+
+	_ = tc.SetDeadline(time.Time{})
+
+	if e = nut.sock.tune(tc.NetConn()); e != nil {
+		logErr(1, "%s", e.Error())
+	}
+
+	nut.handshook(tc)
+	nut.addrs.set(tc)
+
+	return tc, nil
+}
+
+func (nut *TLSNUt) handshook(c *tls.Conn) {
+	var info *TLSInfo
+	var state tls.ConnectionState = c.ConnectionState()
+
+	nut.state.Store(&state)
+	nut.count("handshakes", 1)
+
+	if state.DidResume {
+		nut.count("resumed", 1)
+	}
+
+	info = NewTLSInfo(c.RemoteAddr().String(), state)
+	logGood(
+		1,
+		"%s negotiated %s with %s",
+		info.Remote,
+		info.Version,
+		info.Cipher,
+	)
+
+	for _, line := range strings.Split(info.String(), "\n") {
+		logSubInfo(1, "%s", line)
+	}
+}
+
 // KeepAlive will return whether or not the network utility should be
 // left running upon EOF. In the case of TLS, it is dependent upon
 // mode.
 func (nut *TLSNUt) KeepAlive() bool {
 	if nut.mode == modeServer {
-		return nut.up
+		return nut.up.Load()
 	}
 
 	return false
@@ -184,35 +525,102 @@ func (nut *TLSNUt) KeepAlive() bool {
 func (nut *TLSNUt) listen(addr string) error {
 	var a *net.TCPAddr
 	var c net.Conn
+	var done chan struct{} = nut.done
 	var e error
-	var l *net.TCPListener
-
-	if a, e = net.ResolveTCPAddr("tcp", addr); e != nil {
+	var forks chan NUt
+	var l net.Listener
+	var list net.Listener
+	var ok bool
+	var reason string
+	var release func()
+	var slots chan struct{}
+	var tc *tls.Conn
+	var wg sync.WaitGroup
+
+	logResolved(nut.network, addr)
+
+	if a, e = net.ResolveTCPAddr(nut.network, addr); e != nil {
 		return errors.Newf("failed to resolve %s: %w", addr, e)
 	}
 
-	if l, e = net.ListenTCP("tcp", a); e != nil {
+	l, e = nut.sock.listenConfig().Listen(
+		context.Background(),
+		nut.network,
+		a.String(),
+	)
+	if e != nil {
 		return errors.Newf("failed to listen on %s: %w", addr, e)
 	}
 
-	// Wrap with TLS
-	nut.list = tls.NewListener(l, nut.tlscfg)
+	// Wrap with TLS, looking up the current config for each client so
+	// that reloaded certs are used for new handshakes. Session ticket
+	// keys live here, so they survive reloads.
+	nut.listcfg = &tls.Config{
+		GetConfigForClient:     nut.configForClient,
+		SessionTicketsDisabled: nut.noTickets,
+	}
+	list = tls.NewListener(l, nut.listcfg)
+	nut.list = list
+	nut.conns.reset()
+
+	if nut.fork {
+		forks = make(chan NUt)
+		nut.forks = forks
+	}
+
+	if (nut.rotate > 0) && !nut.noTickets {
+		if e = nut.rotateTickets(); e != nil {
+			_ = nut.list.Close()
+			return e
+		}
+
+		go func(done chan struct{}) {
+			var t *time.Ticker = time.NewTicker(nut.rotate)
+
+			defer t.Stop()
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-t.C:
+				}
+
+				if e := nut.rotateTickets(); e != nil {
+					logErr(1, "%s", e.Error())
+				}
+			}
+		}(done)
+	}
 
 	go func() {
+		var throttled func() = func() {
+			nut.count("throttled", 1)
+		}
 		//nolint:mnd // 2 goroutines
 		var up chan struct{} = make(chan struct{}, 2)
-		var wait chan struct{}
+		//nolint:mnd // 2 goroutines
+		var wait chan struct{} = make(chan struct{}, 2)
 
-		if nut.fork {
-			wait = make(chan struct{}, 1)
-		} else {
-			//nolint:mnd // 2 goroutines
-			wait = make(chan struct{}, 2)
+		// No more sessions once the listener is down
+		if forks != nil {
+			defer func() {
+				wg.Wait()
+				close(forks)
+			}()
 		}
 
-		for nut.up {
-			if c, e = nut.list.Accept(); e != nil {
-				if nut.up {
+		for {
+			slots = nut.conns.wait(throttled)
+
+			if c, e = list.Accept(); e != nil {
+				nut.conns.free(slots)
+
+				if isClosed(done) {
+					return
+				}
+
+				if nut.up.Load() {
 					e = errors.Newf("connection failed: %w", e)
 					logErr(1, "%s", e.Error())
 				}
@@ -222,23 +630,103 @@ func (nut *TLSNUt) listen(addr string) error {
 				continue
 			}
 
+			if reason = nut.acl.check(c.RemoteAddr()); reason != "" {
+				nut.conns.free(slots)
+				nut.count("denied", 1)
+				logWarn(
+					1,
+					"Rejected connection from %s: %s",
+					c.RemoteAddr().String(),
+					reason,
+				)
+				_ = c.Close()
+
+				continue
+			}
+
+			nut.conns.pace(throttled)
+
+			// Reject before spending time on a handshake
+			if release, ok = nut.conns.admit(c, slots); !ok {
+				nut.count("rejected", 1)
+				logWarn(
+					1,
+					"Rejected connection from %s: max-conns-per-ip",
+					c.RemoteAddr().String(),
+				)
+				_ = c.Close()
+
+				continue
+			}
+
+			nut.count("accepted", 1)
+
 			logGood(1, "Connection from %s", c.RemoteAddr().String())
 
-			go func() {
+			// Each forked connection is its own session, and does its
+			// own handshake, so a stalled client can't block others
+			if forks != nil {
+				wg.Add(1)
+
+				go func(c net.Conn, release func()) {
+					var e error
+					var tc *tls.Conn
+
+					defer wg.Done()
+
+					if tc, e = nut.handshake(c); e != nil {
+						logErr(1, "%s", e.Error())
+						_ = c.Close()
+						release()
+
+						return
+					}
+
+					forkSession(
+						newTCPSession(
+							"tls-session",
+							nut,
+							tc,
+							nut.echo,
+							release,
+						),
+						forks,
+						done,
+					)
+				}(c, release)
+
+				continue
+			}
+
+			if tc, e = nut.handshake(c); e != nil {
+				logErr(1, "%s", e.Error())
+				_ = c.Close()
+				release()
+
+				continue
+			}
+
+			// Anything kept for the previous client starts over
+			nut.served.Add(1)
+
+			go func(c *tls.Conn, release func()) {
 				up <- struct{}{}
 
 				_, _ = io.Copy(nut.pwIn, c)
 
+				// Free the slot once the client stops sending
+				release()
+
 				wait <- struct{}{}
-			}()
+			}(tc, release)
 
-			go func() {
+			go func(c *tls.Conn) {
 				up <- struct{}{}
 
 				_, _ = io.Copy(c, nut.prOut)
 
 				wait <- struct{}{}
-			}()
+			}(tc)
 
 			// Wait for up
 			<-up
@@ -246,13 +734,10 @@ func (nut *TLSNUt) listen(addr string) error {
 			time.Sleep(time.Millisecond)
 
 			// Officially up and running
-			nut.connecting = false
+			nut.connecting.Store(false)
 
 			// Block
-			if !nut.fork {
-				<-wait
-			}
-
+			<-wait
 			<-wait
 		}
 	}()
@@ -260,18 +745,103 @@ func (nut *TLSNUt) listen(addr string) error {
 	return nil
 }
 
+func (nut *TLSNUt) modTimes() map[string]time.Time {
+	var fi os.FileInfo
+	var stamps map[string]time.Time = map[string]time.Time{}
+
+	for _, fn := range nut.tlsFiles {
+		// Hex-encoded values aren't files, so they won't change
+		if fi, _ = os.Stat(pathname.ExpandPath(fn)); fi != nil {
+			stamps[fn] = fi.ModTime()
+		}
+	}
+
+	return stamps
+}
+
+// parseConfig will parse the seed config, skipping any of the
+// provided keys, and then create the TLS config.
+func (nut *TLSNUt) parseConfig(skip ...string) error {
+	var e error
+
+	for k, v := range nut.config {
+		switch {
+		case slices.Contains(skip, k):
+		case k == "addr":
+			if nut.addr, e = normalizeAddr(v); e != nil {
+				return e
+			}
+		default:
+			if e = nut.parseOpts(k, v); e != nil {
+				return e
+			}
+		}
+	}
+
+	if nut.config["addr"] == "" {
+		return errors.Newf("no %s addr provided", nut.Type())
+	}
+
+	if e = nut.setupTLSConfig(); e != nil {
+		return e
+	}
+
+	nut.stamps = nut.modTimes()
+
+	return nil
+}
+
 func (nut *TLSNUt) parseOpts(k string, v string) error {
 	var e error
+	var ok bool
 
 	switch k {
+	case "allow-cn", "allow-ou", "allow-san":
+		if nut.mode == modeClient {
+			return errors.Newf("unknown %s option %s", nut.Type(), k)
+		}
+
+		nut.allow[k] = strings.Split(v, ":")
+	case "alpn":
+		nut.alpn = strings.Split(v, ":")
+	case "bind":
+		if nut.mode != modeClient {
+			return errors.Newf("unknown %s option %s", nut.Type(), k)
+		}
+
+		if nut.bind, e = parseBind(v); e != nil {
+			return e
+		}
 	case "ca":
 		if nut.ca, e = readCert(v); e != nil {
 			return e
 		}
+
+		nut.tlsFiles[k] = v
 	case "cert":
 		if nut.cert, e = readCert(v); e != nil {
 			return e
 		}
+
+		nut.tlsFiles[k] = v
+	case "ciphers":
+		if nut.ciphers, e = parseCiphers(v); e != nil {
+			return e
+		}
+	case "crl":
+		if nut.mode == modeClient {
+			return errors.Newf("unknown %s option %s", nut.Type(), k)
+		}
+
+		if nut.crl, e = readCRL(v); e != nil {
+			return e
+		}
+
+		nut.tlsFiles[k] = v
+	case "curves":
+		if nut.curves, e = parseCurves(v); e != nil {
+			return e
+		}
 	case "echo":
 		if nut.mode == modeClient {
 			return errors.Newf("unknown %s option %s", nut.Type(), k)
@@ -288,31 +858,107 @@ func (nut *TLSNUt) parseOpts(k string, v string) error {
 		if nut.key, e = readKey(v); e != nil {
 			return e
 		}
+
+		nut.tlsFiles[k] = v
+	case "keylog":
+		if v == "" {
+			return errors.Newf("no %s keylog provided", nut.Type())
+		}
+
+		nut.keylog = pathname.ExpandPath(v)
+	case "maxver":
+		if nut.maxVer, e = parseTLSVersion(v); e != nil {
+			return e
+		}
+	case "minver":
+		if nut.minVer, e = parseTLSVersion(v); e != nil {
+			return e
+		}
+	case "pf":
+		if nut.network, e = parseFamily(nut.network, v); e != nil {
+			return e
+		}
+	case "reload":
+		nut.reload = true
+	case "resume":
+		if nut.mode != modeClient {
+			return errors.Newf("unknown %s option %s", nut.Type(), k)
+		}
+
+		nut.resume = tls.NewLRUClientSessionCache(0)
+	case "ticket-rotate":
+		if nut.mode != modeServer {
+			return errors.Newf("unknown %s option %s", nut.Type(), k)
+		}
+
+		if nut.rotate, e = time.ParseDuration(v); e != nil {
+			return errors.Newf("invalid %s %s: %w", k, v, e)
+		} else if nut.rotate <= 0 {
+			return errors.Newf("invalid %s %s", k, v)
+		}
+	case "tickets":
+		if nut.mode != modeServer {
+			return errors.Newf("unknown %s option %s", nut.Type(), k)
+		}
+
+		switch v {
+		case "", "on":
+		case "off":
+			nut.noTickets = true
+		default:
+			return errors.Newf("invalid %s %s", k, v)
+		}
 	case "verify":
 		nut.verify = true
 	default:
-		return errors.Newf("unknown %s option %s", nut.Type(), k)
+		ok, e = nut.retry.parse(k, v, nut.mode == modeClient)
+		if !ok && (e == nil) {
+			ok, e = nut.conns.parse(k, v, nut.mode == modeServer)
+		}
+
+		if !ok && (e == nil) {
+			ok, e = nut.acl.parse(k, v, nut.mode == modeServer)
+		}
+
+		if !ok && (e == nil) {
+			ok, e = nut.sock.parse(k, v, true)
+		}
+
+		if !ok && (e == nil) {
+			ok, e = nut.parseLimit(k, v)
+		}
+
+		if e != nil {
+			return e
+		} else if !ok {
+			return errors.Newf("unknown %s option %s", nut.Type(), k)
+		}
 	}
 
 	return nil
 }
 
-// Read will read from the current TLS connection.
+// Read will read from the current TLS connection. In fork mode, each
+// session is read separately, so it will return EOF.
 //
 //nolint:dupl,mnd // TLS is TCP (so yeah), Log levels
 func (nut *TLSNUt) Read(p []byte) (int, error) {
 	var e error
 	var n int
 
-	if nut.connecting {
+	if nut.fork {
+		return 0, io.EOF
+	}
+
+	if nut.connecting.Load() {
 		logSubInfo(2, "%s read: still connecting", nut.String())
 	}
 
-	for nut.connecting {
+	for nut.connecting.Load() {
 		time.Sleep(time.Millisecond)
 	}
 
-	if !nut.up {
+	if !nut.up.Load() {
 		logSubInfo(2, "%s read: not up", nut.String())
 		return 0, io.EOF
 	}
@@ -320,7 +966,7 @@ func (nut *TLSNUt) Read(p []byte) (int, error) {
 	if n, e = nut.prIn.Read(p); e != nil {
 		logSubInfo(2, "%s read: %d bytes", nut.String(), n)
 
-		if !nut.up || (nut.mode == modeServer) {
+		if !nut.up.Load() || (nut.mode == modeServer) {
 			e = nil
 		}
 
@@ -338,22 +984,173 @@ func (nut *TLSNUt) Read(p []byte) (int, error) {
 	return n, nil
 }
 
+// Reload will re-read the ca, cert, crl, and key files and use them
+// for any new handshakes. Existing connections are unaffected. If any
+// file fails to load, the previous config remains in use.
+func (nut *TLSNUt) Reload() error {
+	var ca *x509.Certificate
+	var cert *x509.Certificate
+	var crl *x509.RevocationList
+	var e error
+	var key *rsa.PrivateKey
+	var oldCA *x509.Certificate
+	var oldCert *x509.Certificate
+	var oldCRL *x509.RevocationList
+	var oldKey *rsa.PrivateKey
+
+	nut.tlsLock.Lock()
+	defer nut.tlsLock.Unlock()
+
+	if fn, ok := nut.tlsFiles["ca"]; ok {
+		if ca, e = readCert(fn); e != nil {
+			return e
+		}
+	}
+
+	if fn, ok := nut.tlsFiles["cert"]; ok {
+		if cert, e = readCert(fn); e != nil {
+			return e
+		}
+	}
+
+	if fn, ok := nut.tlsFiles["crl"]; ok {
+		if crl, e = readCRL(fn); e != nil {
+			return e
+		}
+	}
+
+	if fn, ok := nut.tlsFiles["key"]; ok {
+		if key, e = readKey(fn); e != nil {
+			return e
+		}
+	}
+
+	oldCA, oldCert = nut.ca, nut.cert
+	oldCRL, oldKey = nut.crl, nut.key
+	nut.ca, nut.cert, nut.crl, nut.key = ca, cert, crl, key
+
+	if e = nut.setupTLSConfig(); e != nil {
+		// Restore previous material
+		nut.ca, nut.cert = oldCA, oldCert
+		nut.crl, nut.key = oldCRL, oldKey
+
+		return e
+	}
+
+	nut.stamps = nut.modTimes()
+	logGood(1, "%s reloaded TLS config", nut.String())
+
+	return nil
+}
+
+func (nut *TLSNUt) reloadIfChanged() {
+	var changed bool
+	var stamps map[string]time.Time = nut.modTimes()
+
+	nut.tlsLock.Lock()
+
+	for fn, stamp := range stamps {
+		if !stamp.Equal(nut.stamps[fn]) {
+			changed = true
+			break
+		}
+	}
+
+	nut.tlsLock.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if e := nut.Reload(); e != nil {
+		logErr(1, "%s", errors.Newf("reload failed: %w", e).Error())
+	}
+}
+
+func (nut *TLSNUt) rotateTickets() error {
+	var key [32]byte
+
+	if _, e := rand.Read(key[:]); e != nil {
+		return errors.Newf("failed to generate ticket key: %w", e)
+	}
+
+	nut.tlsLock.Lock()
+	defer nut.tlsLock.Unlock()
+
+	// Keep the previous key so recently issued tickets still work
+	nut.tickets = append([][32]byte{key}, nut.tickets...)
+	if len(nut.tickets) > 2 { //nolint:mnd // Current and previous
+		nut.tickets = nut.tickets[:2]
+	}
+
+	nut.listcfg.SetSessionTicketKeys(nut.tickets)
+	logSubInfo(2, "%s rotated session ticket key", nut.String())
+
+	return nil
+}
+
+// Sessions will return a channel that receives a new NUt for each
+// client connection, or nil if not in fork mode. Each time the
+// listener comes up, it creates a new channel, which is closed when
+// it goes down. Until then, the returned channel is already closed.
+func (nut *TLSNUt) Sessions() <-chan NUt {
+	var none chan NUt
+
+	if !nut.fork {
+		return nil
+	}
+
+	nut.lock.RLock()
+	defer nut.lock.RUnlock()
+
+	if nut.forks == nil {
+		none = make(chan NUt)
+		close(none)
+
+		return none
+	}
+
+	return nut.forks
+}
+
 func (nut *TLSNUt) setupTLSConfig() error {
 	var b [][]byte
+	var cfg *tls.Config
 	var pool *x509.CertPool
 
+	if (nut.maxVer != 0) && (nut.minVer > nut.maxVer) {
+		return errors.New("minver is greater than maxver")
+	}
+
+	// Fallback to the de facto standard env var
+	if nut.keylog == "" {
+		nut.keylog = os.Getenv("SSLKEYLOGFILE")
+	}
+
 	// Create initial config
-	nut.tlscfg = &tls.Config{}
+	cfg = &tls.Config{
+		CipherSuites:     nut.ciphers,
+		CurvePreferences: nut.curves,
+		MaxVersion:       nut.maxVer,
+		MinVersion:       nut.minVer,
+		NextProtos:       nut.alpn,
+	}
+
+	if nut.keylog != "" {
+		secureKeyLog(nut.keylog)
+		cfg.KeyLogWriter = keyLogWriter(nut.keylog)
+	}
 
 	switch nut.mode {
 	case modeClient:
-		nut.tlscfg.InsecureSkipVerify = !nut.verify
+		cfg.ClientSessionCache = nut.resume
+		cfg.InsecureSkipVerify = !nut.verify
 
 		if nut.ca != nil {
 			pool = x509.NewCertPool()
 			pool.AddCert(nut.ca)
 
-			nut.tlscfg.RootCAs = pool
+			cfg.RootCAs = pool
 		}
 
 		if (nut.cert == nil) && (nut.key != nil) {
@@ -362,6 +1159,8 @@ func (nut *TLSNUt) setupTLSConfig() error {
 			return errors.New("no key provided")
 		}
 	case modeServer:
+		cfg.SessionTicketsDisabled = nut.noTickets
+
 		if nut.cert == nil {
 			return errors.New("no cert provided")
 		}
@@ -380,8 +1179,38 @@ func (nut *TLSNUt) setupTLSConfig() error {
 			pool = x509.NewCertPool()
 			pool.AddCert(nut.ca)
 
-			nut.tlscfg.ClientAuth = tls.RequireAndVerifyClientCert
-			nut.tlscfg.ClientCAs = pool
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			cfg.ClientCAs = pool
+		}
+
+		// Authorize clients, but only once they are verified
+		if (len(nut.allow) > 0) || (nut.crl != nil) {
+			if !nut.verify {
+				return errors.New("client authorization needs verify")
+			}
+
+			if nut.crl != nil {
+				if e := nut.crl.CheckSignatureFrom(nut.ca); e != nil {
+					return errors.Newf("invalid crl: %w", e)
+				}
+
+				if isExpired(nut.crl) {
+					logWarn(
+						1,
+						"crl expired at %s, rejecting all clients",
+						nut.crl.NextUpdate.Format(time.RFC3339),
+					)
+				}
+			}
+
+			cfg.VerifyConnection = nut.authorizer(nut.crl)
+		}
+	}
+
+	// Don't pair a rotated cert with a stale key, or vice versa
+	if (nut.cert != nil) && (nut.key != nil) {
+		if e := checkKeyPair(nut.cert, nut.key); e != nil {
+			return e
 		}
 	}
 
@@ -397,8 +1226,8 @@ func (nut *TLSNUt) setupTLSConfig() error {
 
 	// Add TLS cert to config
 	if len(b) > 0 {
-		nut.tlscfg.Certificates = append(
-			nut.tlscfg.Certificates,
+		cfg.Certificates = append(
+			cfg.Certificates,
 			tls.Certificate{
 				Certificate: b,
 				PrivateKey:  nut.key,
@@ -406,58 +1235,95 @@ func (nut *TLSNUt) setupTLSConfig() error {
 		)
 	}
 
+	// Existing connections keep the config they were created with
+	nut.tlscfg.Store(cfg)
+
 	return nil
 }
 
 // Up will start the network utility. In the case of TLS, it will
-// either connect or listen, depending on the mode.
+// either connect or listen, depending on the mode. Clients wait for
+// the first connection, so failures reach the caller, but Down can
+// still cancel it.
 func (nut *TLSNUt) Up() error {
+	var done chan struct{} = make(chan struct{})
 	var e error
+	var ready chan error
 
 	nut.lock.Lock()
-	defer nut.lock.Unlock()
 
 	// Check if already up
-	if nut.up {
+	if nut.up.Load() {
+		nut.lock.Unlock()
 		return nil
 	}
 
+	if nut.keylog != "" {
+		logWarn(
+			1,
+			"%s logging TLS secrets to %s, traffic is decryptable",
+			nut.Type(),
+			nut.keylog,
+		)
+	}
+
 	// Up after pipes created
 	_ = nut.baseNUt.Up()
-	nut.connecting = true
-	nut.up = true
+	nut.connecting.Store(true)
+	nut.done = done
+	nut.up.Store(true)
 
 	// Create connection/listener
 	switch nut.mode {
 	case modeClient:
-		e = nut.connect(nut.addr)
+		ready, e = nut.connect(nut.addr, done)
 	case modeServer:
 		e = nut.listen(nut.addr)
 	}
 
+	// Don't hold the lock while connecting, or Down would block
+	nut.lock.Unlock()
+
+	if (e == nil) && (ready != nil) {
+		e = <-ready
+	}
+
 	if e != nil {
-		nut.up = false
+		nut.lock.Lock()
+		defer nut.lock.Unlock()
+
+		// Unless Down already stopped this attempt
+		if !isClosed(done) {
+			nut.connecting.Store(false)
+			nut.up.Store(false)
+			close(done)
+		}
 	}
 
 	return e
 }
 
-// Write will write to the current TLS connection.
+// Write will write to the current TLS connection. In fork mode, each
+// session is written separately, so it will return EOF.
 //
 //nolint:mnd // Log levels
 func (nut *TLSNUt) Write(p []byte) (int, error) {
 	var e error
 	var n int
 
-	if nut.connecting {
+	if nut.fork {
+		return 0, io.EOF
+	}
+
+	if nut.connecting.Load() {
 		logSubInfo(2, "%s write: still connecting", nut.String())
 	}
 
-	for nut.connecting {
+	for nut.connecting.Load() {
 		time.Sleep(time.Millisecond)
 	}
 
-	if !nut.up {
+	if !nut.up.Load() {
 		logSubInfo(2, "%s write: not up", nut.String())
 		return 0, io.EOF
 	}
@@ -465,7 +1331,7 @@ func (nut *TLSNUt) Write(p []byte) (int, error) {
 	n, e = nut.pwOut.Write(p)
 	logSubInfo(2, "%s write: %d bytes", nut.String(), n)
 
-	if !nut.up {
+	if !nut.up.Load() {
 		e = nil
 	}
 
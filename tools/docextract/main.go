@@ -19,6 +19,7 @@ var (
 func main() {
 	var e error
 	var f *os.File
+	var header bool
 	var keep bool
 	var line string
 	var s *bufio.Scanner
@@ -50,8 +51,19 @@ func main() {
 		if keep {
 			switch {
 			case line == "":
+				header = false
+
 				sb.WriteString("\\n")
-			case aliases.MatchString(line), newType.MatchString(line):
+			case newType.MatchString(line):
+				// Long seed types wrap until the closing bracket
+				header = !strings.HasSuffix(line, "]")
+
+				sb.WriteString(line)
+			case header:
+				header = !strings.HasSuffix(line, "]")
+
+				sb.WriteString(line)
+			case aliases.MatchString(line):
 				sb.WriteString(line)
 			default:
 				sb.WriteString(line + "\\n")
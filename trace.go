@@ -0,0 +1,195 @@
+package nutsak
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mjwhitta/errors"
+)
+
+// Tracer will log every chunk of traffic that it is given, with a
+// timestamp and a label, either as escaped text or as a hexdump. It
+// is safe for concurrent use, so that both directions of a Pair can
+// share one.
+type Tracer struct {
+	hexdump bool
+	lock    *sync.Mutex
+	w       io.Writer
+}
+
+// The trace filter logs to stderr, so all of its instances share
+// these, to keep their output from interleaving
+var (
+	hexTracer  *Tracer = NewTracer(os.Stderr, true)
+	textTracer *Tracer = NewTracer(os.Stderr, false)
+)
+
+// NewTracer will return a pointer to a Tracer that writes to the
+// provided writer. If hexdump is true, chunks are logged as a hexdump
+// with an ASCII column, otherwise they are logged as text with
+// non-printable bytes escaped.
+func NewTracer(w io.Writer, hexdump bool) *Tracer {
+	return &Tracer{hexdump: hexdump, lock: &sync.Mutex{}, w: w}
+}
+
+// Log will log the provided chunk under the provided label.
+func (t *Tracer) Log(label string, p []byte) {
+	var sb strings.Builder
+
+	sb.WriteString(
+		fmt.Sprintf(
+			"%s %s length=%d\n",
+			time.Now().Format("2006/01/02 15:04:05.000000"),
+			label,
+			len(p),
+		),
+	)
+
+	if t.hexdump {
+		sb.WriteString(hex.Dump(p))
+	} else {
+		sb.WriteString(escapeTrace(p))
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	_, _ = io.WriteString(t.w, sb.String())
+}
+
+// Trace will log the provided chunk as flowing from one NUt to the
+// other. It can be assigned to the Trace hook.
+func (t *Tracer) Trace(from NUt, to NUt, p []byte) {
+	t.Log(from.String()+" > "+to.String(), p)
+}
+
+// escapeTrace will return the provided chunk as printable text. Each
+// newline is escaped and also kept, so that line-based protocols
+// remain readable.
+func escapeTrace(p []byte) string {
+	var sb strings.Builder
+
+	for _, c := range p {
+		switch {
+		case c == '\\':
+			sb.WriteString("\\\\")
+		case c == '\n':
+			sb.WriteString("\\n\n")
+		case c == '\r':
+			sb.WriteString("\\r")
+		case c == '\t':
+			sb.WriteString("\\t")
+		case (c < ' ') || (c > '~'):
+			sb.WriteString(fmt.Sprintf("\\x%02x", c))
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	if !strings.HasSuffix(sb.String(), "\n") {
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// traceWriter will pass each successful write to the Trace hook.
+type traceWriter struct {
+	io.Writer
+
+	from NUt
+	to   NUt
+}
+
+// Write will write to the underlying writer and trace what was
+// written.
+func (w traceWriter) Write(p []byte) (int, error) {
+	var e error
+	var n int
+
+	n, e = w.Writer.Write(p)
+
+	if hook := Trace; (hook != nil) && (n > 0) {
+		hook(w.from, w.to, p[:n])
+	}
+
+	return n, e //nolint:wrapcheck // Not external to repo
+}
+
+// traceFilter logs the data read from and written to the NUt, to
+// stderr, without changing it.
+type traceFilter struct {
+	t *Tracer
+}
+
+func newTraceFilter(arg string) (Filter, error) {
+	switch arg {
+	case "", "text":
+		return traceFilter{t: textTracer}, nil
+	case "hex":
+		return traceFilter{t: hexTracer}, nil
+	}
+
+	return nil, errors.Newf("unknown trace argument %s", arg)
+}
+
+// Reader will log data read from the provided reader.
+func (f traceFilter) Reader(r io.Reader) io.Reader {
+	return traceReader{Reader: r, t: f.t}
+}
+
+// String will return the name of the filter, with its mode.
+func (f traceFilter) String() string {
+	if f.t.hexdump {
+		return "trace=hex"
+	}
+
+	return "trace"
+}
+
+// Writer will log data written to the provided writer.
+func (f traceFilter) Writer(w io.Writer) io.WriteCloser {
+	return nopWriteCloser{traceFilterWriter{Writer: w, t: f.t}}
+}
+
+type traceFilterWriter struct {
+	io.Writer
+
+	t *Tracer
+}
+
+// Write will write to the underlying writer and log what was
+// written.
+func (w traceFilterWriter) Write(p []byte) (int, error) {
+	var e error
+	var n int
+
+	if n, e = w.Writer.Write(p); n > 0 {
+		w.t.Log("> write", p[:n])
+	}
+
+	return n, e //nolint:wrapcheck // Not external to repo
+}
+
+type traceReader struct {
+	io.Reader
+
+	t *Tracer
+}
+
+// Read will read from the underlying reader and log what was read.
+func (r traceReader) Read(p []byte) (int, error) {
+	var e error
+	var n int
+
+	if n, e = r.Reader.Read(p); n > 0 {
+		r.t.Log("< read", p[:n])
+	}
+
+	return n, e //nolint:wrapcheck // Could be io.EOF
+}
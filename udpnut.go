@@ -1,41 +1,89 @@
 package nutsak
 
 import (
+	"bytes"
+	"context"
 	"io"
 	"net"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/mjwhitta/errors"
 )
 
+// maxDatagram is the largest datagram that can be read without being
+// truncated.
+const maxDatagram int = 64 * 1024
+
+// maxPending is the maximum number of datagrams that udp-listen will
+// queue for each fork session.
+const maxPending int = 1024
+
 // UDPNUt is a UDP network utility.
 type UDPNUt struct {
 	*baseNUt
 
+	acl      *aclRules
 	addr     string
-	clients  map[string]struct{}
+	addrs    *connAddrs
+	bind     string
 	conn     *net.UDPConn
-	connAddr *net.UDPAddr
 	echo     bool
+	fork     bool
+	forks    chan NUt
+	group    *net.UDPAddr
+	iface    string
+	last     *udpSession
+	loop     bool
 	mode     int
+	network  string
+	retry    *retryOpts
+	self     []net.IP
+	sender   *net.UDPConn
+	sessions map[string]*udpSession
+	sessLock *sync.Mutex
+	sock     *sockOpts
+	splitUp  bool
+	timeout  time.Duration
+	ttl      int
 }
 
 // NewUDPNUt will return a pointer to a UDP network utility instance
 // with the provided seed and mode.
 func NewUDPNUt(seed string) (NUt, error) {
 	var e error
-	var nut *UDPNUt = &UDPNUt{clients: map[string]struct{}{}}
+	var ok bool
+	var nut *UDPNUt = &UDPNUt{
+		acl:      newACLRules(),
+		addrs:    &connAddrs{},
+		sessions: map[string]*udpSession{},
+		retry:    newRetryOpts(),
+		sessLock: &sync.Mutex{},
+		sock:     newSockOpts(),
+		timeout:  30 * time.Second, //nolint:mnd // Default timeout
+		ttl:      1,
+	}
 
 	// Inherit
 	nut.baseNUt = super(seed)
 
 	switch nut.Type() {
-	case "udp":
+	case "udp", "udp4", "udp6":
 		nut.mode = modeClient
-	case "udp-l", "udp-listen":
+		nut.network = nut.Type()
+	case "udp-bcast":
+		nut.mode = modeBroadcast
+	case "udp-l", "udp-listen", "udp4-l", "udp4-listen", "udp6-l",
+		"udp6-listen":
 		nut.mode = modeServer
-		nut.theType = "udp-listen"
+		nut.network, _, _ = strings.Cut(nut.Type(), "-")
+		nut.theType = nut.network + "-listen"
+	case "udp-mcast":
+		nut.mode = modeMulticast
 	default:
 		e = errors.Newf("unknown udp type %s", nut.Type())
 		return nil, e
@@ -44,49 +92,173 @@ func NewUDPNUt(seed string) (NUt, error) {
 	for k, v := range nut.config {
 		switch {
 		case k == "addr":
-			nut.addr = v
-			if !strings.Contains(nut.addr, ":") {
-				nut.addr = "0.0.0.0:" + nut.addr
+			if !strings.Contains(v, ":") {
+				switch nut.mode {
+				case modeBroadcast:
+					v = "255.255.255.255:" + v
+				case modeMulticast:
+					e = errors.Newf("no %s group given", nut.Type())
+					return nil, e
+				}
+			}
+
+			if nut.addr, e = normalizeAddr(v); e != nil {
+				return nil, e
+			}
+		case (k == "bind") && (nut.mode == modeClient):
+			if nut.bind, e = parseBind(v); e != nil {
+				return nil, e
 			}
 		case (k == "echo") && (nut.mode == modeServer):
 			nut.echo = true
+		case (k == "fork") && (nut.mode == modeServer):
+			nut.fork = true
+		case (k == "iface") && (nut.mode == modeMulticast):
+			nut.iface = v
+		case (k == "loop") && (nut.mode == modeMulticast):
+			nut.loop = true
+		case (k == "pf") && (nut.network != ""):
+			nut.network, e = parseFamily(nut.network, v)
+			if e != nil {
+				return nil, e
+			}
+		case (k == "timeout") && (nut.mode == modeServer):
+			if nut.timeout, e = time.ParseDuration(v); e != nil {
+				return nil, errors.Newf("invalid %s %s: %w", k, v, e)
+			} else if nut.timeout <= 0 {
+				return nil, errors.Newf("invalid %s %s", k, v)
+			}
+		case (k == "ttl") && (nut.mode == modeMulticast):
+			if nut.ttl, e = strconv.Atoi(v); e != nil {
+				return nil, errors.Newf("invalid %s %s: %w", k, v, e)
+			} else if (nut.ttl < 0) || (nut.ttl > 255) {
+				return nil, errors.Newf("invalid %s %s", k, v)
+			}
 		default:
-			e = errors.Newf("unknown %s option %s", nut.Type(), k)
-			return nil, e
+			ok, e = nut.retry.parse(k, v, nut.mode == modeClient)
+			if !ok && (e == nil) {
+				ok, e = nut.acl.parse(k, v, nut.mode == modeServer)
+			}
+
+			if !ok && (e == nil) {
+				ok, e = nut.sock.parse(k, v, false)
+			}
+
+			if !ok && (e == nil) {
+				ok, e = nut.parseLimit(k, v)
+			}
+
+			if e != nil {
+				return nil, e
+			} else if !ok {
+				e = errors.Newf("unknown %s option %s", nut.Type(), k)
+				return nil, e
+			}
 		}
 	}
 
-	if nut.addr == "" {
+	if nut.config["addr"] == "" {
 		return nil, errors.Newf("no %s addr provided", nut.Type())
 	}
 
 	return nut, nil
 }
 
-func (nut *UDPNUt) connect(addr string) error {
+// broadcast will listen for broadcast datagrams on the port of the
+// provided address, and send datagrams to the provided address.
+func (nut *UDPNUt) broadcast(addr string) error {
 	var a *net.UDPAddr
+	var c net.PacketConn
 	var e error
+	var lc net.ListenConfig = net.ListenConfig{
+		Control: func(nw string, a string, rc syscall.RawConn) error {
+			if e := nut.sock.control(nw, a, rc); e != nil {
+				return e
+			}
 
-	if a, e = net.ResolveUDPAddr("udp", addr); e != nil {
+			// Allow other broadcast listeners on the same port
+			if e := setReuseAddr(rc); e != nil {
+				return e
+			}
+
+			return setBroadcast(rc)
+		},
+	}
+
+	if a, e = net.ResolveUDPAddr("udp4", addr); e != nil {
 		return errors.Newf("failed to resolve %s: %w", addr, e)
 	}
 
-	for {
-		if nut.conn, e = net.DialUDP("udp", nil, a); e != nil {
-			logErr(
-				1,
-				"%s",
-				errors.Newf("connect failed: %w", e).Error(),
-			)
-			time.Sleep(time.Second)
+	// Remember local addresses, to ignore our own broadcasts
+	if e = nut.findSelf(); e != nil {
+		return e
+	}
 
-			continue
+	c, e = lc.ListenPacket(
+		context.Background(),
+		"udp4",
+		":"+strconv.Itoa(a.Port),
+	)
+	if e != nil {
+		return errors.Newf("failed to listen on %s: %w", addr, e)
+	}
+
+	nut.conn = c.(*net.UDPConn) //nolint:forcetypeassert // Always UDP
+	nut.group = a
+
+	return nil
+}
+
+func (nut *UDPNUt) connect(addr string) error {
+	var a *net.UDPAddr
+	var c net.Conn
+	var d *net.Dialer = nut.sock.dialer(nil)
+	var e error
+	var local *net.UDPAddr
+
+	logResolved(nut.network, addr)
+
+	if a, e = net.ResolveUDPAddr(nut.network, addr); e != nil {
+		return errors.Newf("failed to resolve %s: %w", addr, e)
+	}
+
+	if nut.bind != "" {
+		local, e = net.ResolveUDPAddr(nut.network, nut.bind)
+		if e != nil {
+			e = errors.Newf("failed to resolve %s: %w", nut.bind, e)
+			return e
 		}
 
-		// Don't loop if successful connection
-		break
+		d = nut.sock.dialer(local)
 	}
 
+	d.Timeout = nut.retry.timeout
+
+	// Retrying won't free up the local address
+	if local != nil {
+		if c, e = d.Dial(nut.network, a.String()); e != nil {
+			return errors.Newf("failed to bind %s: %w", nut.bind, e)
+		}
+	} else {
+		// UDP sends nothing to connect, so this never blocks for long
+		e = nut.retry.dial(
+			nil,
+			func(ctx context.Context) error {
+				var e error
+
+				c, e = d.DialContext(ctx, nut.network, a.String())
+
+				return e //nolint:wrapcheck // Wrapped by caller
+			},
+		)
+		if e != nil {
+			return e
+		}
+	}
+
+	nut.conn = c.(*net.UDPConn) //nolint:forcetypeassert // Always UDP
+	nut.addrs.set(c)
+
 	return nil
 }
 
@@ -99,12 +271,12 @@ func (nut *UDPNUt) Down() error {
 	defer nut.lock.Unlock()
 
 	// Check if already down
-	if !nut.up {
+	if !nut.up.Load() {
 		return nil
 	}
 
 	// Down before closing connection
-	nut.up = false
+	nut.up.Store(false)
 
 	// Close connection
 	if nut.conn != nil {
@@ -113,6 +285,239 @@ func (nut *UDPNUt) Down() error {
 		}
 	}
 
+	if nut.sender != nil {
+		_ = nut.sender.Close()
+	}
+
+	// Down any forked sessions
+	nut.sessLock.Lock()
+	for _, session := range nut.sessions {
+		_ = session.Down()
+	}
+	nut.sessLock.Unlock()
+
+	return e
+}
+
+// demux will read datagrams and queue them for the session of the
+// remote address they came from. New sessions are sent to Pair() so
+// that each gets its own peer NUt.
+//
+//nolint:mnd // Log levels
+func (nut *UDPNUt) demux(forks chan NUt) {
+	var a *net.UDPAddr
+	var b []byte = make([]byte, maxDatagram)
+	var e error
+	var isNew bool
+	var n int
+	var session *udpSession
+
+	defer close(forks)
+
+	for {
+		if n, a, e = nut.conn.ReadFromUDP(b); e != nil {
+			if !nut.up.Load() {
+				return
+			}
+
+			logErr(1, "%s", errors.Newf("read failed: %w", e).Error())
+
+			continue
+		}
+
+		logSubInfo(2, "%s read: %d bytes", nut.String(), n)
+
+		if nut.denied(a) {
+			continue
+		}
+
+		if session, isNew = nut.track(a); isNew {
+			forks <- session
+		}
+
+		select {
+		case session.queue <- bytes.Clone(b[:n]):
+		default:
+			logSubInfo(2, "%s read: session queue full", nut.String())
+		}
+	}
+}
+
+// denied will return whether or not datagrams from the provided
+// address should be dropped, logging the reason if so.
+func (nut *UDPNUt) denied(a *net.UDPAddr) bool {
+	var reason string
+
+	if reason = nut.acl.check(a); reason == "" {
+		return false
+	}
+
+	nut.count("denied", 1)
+	logWarn(1, "Dropped datagram from %s: %s", a.String(), reason)
+
+	return true
+}
+
+// endpoints will return the local and remote addresses of the most
+// recent connection.
+func (nut *UDPNUt) endpoints() (net.Addr, net.Addr) {
+	return nut.addrs.endpoints()
+}
+
+// expire will periodically remove sessions that have been idle for
+// longer than the timeout.
+func (nut *UDPNUt) expire() {
+	var t *time.Ticker = time.NewTicker(nut.timeout / 2)
+
+	defer t.Stop()
+
+	for range t.C {
+		if !nut.up.Load() {
+			return
+		}
+
+		nut.sessLock.Lock()
+
+		for k, session := range nut.sessions {
+			if time.Since(session.lastSeen) > nut.timeout {
+				delete(nut.sessions, k)
+				logGood(1, "Session from %s expired", k)
+				_ = session.Down()
+
+				if nut.last == session {
+					nut.last = nil
+				}
+			}
+		}
+
+		nut.sessLock.Unlock()
+	}
+}
+
+// findSelf will remember the local addresses, so that our own
+// broadcast or multicast datagrams can be ignored.
+func (nut *UDPNUt) findSelf() error {
+	var addrs []net.Addr
+	var e error
+
+	if addrs, e = net.InterfaceAddrs(); e != nil {
+		return errors.Newf("failed to get local addresses: %w", e)
+	}
+
+	nut.self = nil
+
+	for _, local := range addrs {
+		if ipnet, ok := local.(*net.IPNet); ok {
+			nut.self = append(nut.self, ipnet.IP)
+		}
+	}
+
+	return nil
+}
+
+// fromSelf will return whether or not the provided address is one of
+// our own, such as when receiving our own broadcasts. Multicast is
+// sent from its own socket, so that other members on the local
+// system, which share the group port, are not mistaken for us.
+func (nut *UDPNUt) fromSelf(a *net.UDPAddr) bool {
+	var port int = nut.group.Port
+
+	if nut.sender != nil {
+		//nolint:forcetypeassert // Always UDP
+		port = nut.sender.LocalAddr().(*net.UDPAddr).Port
+	}
+
+	if a.Port != port {
+		return false
+	}
+
+	return slices.ContainsFunc(nut.self, a.IP.Equal)
+}
+
+// join will join the multicast group at the provided address.
+// Datagrams are sent from a separate socket, on the same interface,
+// so that our own can be told apart when loop is enabled.
+func (nut *UDPNUt) join(addr string) error {
+	var a *net.UDPAddr
+	var c net.PacketConn
+	var e error
+	var ifi *net.Interface
+	var network string = "udp4"
+	var rc syscall.RawConn
+	var v6 bool
+
+	if a, e = net.ResolveUDPAddr("udp", addr); e != nil {
+		return errors.Newf("failed to resolve %s: %w", addr, e)
+	}
+
+	if !a.IP.IsMulticast() {
+		return errors.Newf("%s is not a multicast group", a.IP)
+	}
+
+	if v6 = a.IP.To4() == nil; v6 {
+		network = "udp6"
+	}
+
+	if nut.iface != "" {
+		if ifi, e = net.InterfaceByName(nut.iface); e != nil {
+			e = errors.Newf("unknown interface %s: %w", nut.iface, e)
+			return e
+		}
+	}
+
+	// Remember local addresses, to ignore our own datagrams
+	if e = nut.findSelf(); e != nil {
+		return e
+	}
+
+	// Go binds a multicast address as the wildcard address with a
+	// shared port, after socket options such as bind-device are set
+	c, e = nut.sock.listenConfig().ListenPacket(
+		context.Background(),
+		network,
+		a.String(),
+	)
+	if e != nil {
+		return errors.Newf("failed to listen on %s: %w", addr, e)
+	}
+
+	nut.conn = c.(*net.UDPConn) //nolint:forcetypeassert // Always UDP
+	nut.group = a
+
+	if rc, e = nut.conn.SyscallConn(); e != nil {
+		_ = nut.conn.Close()
+		return errors.Newf("failed to access socket: %w", e)
+	}
+
+	if e = joinGroup(rc, ifi, a.IP); e != nil {
+		_ = nut.conn.Close()
+		return e
+	}
+
+	c, e = nut.sock.listenConfig().ListenPacket(
+		context.Background(),
+		network,
+		":0",
+	)
+	if e != nil {
+		_ = nut.conn.Close()
+		return errors.Newf("failed to create sender: %w", e)
+	}
+
+	//nolint:forcetypeassert // Always UDP
+	nut.sender = c.(*net.UDPConn)
+
+	if rc, e = nut.sender.SyscallConn(); e != nil {
+		e = errors.Newf("failed to access socket: %w", e)
+	} else {
+		e = setMulticast(rc, ifi, nut.ttl, nut.loop, v6)
+	}
+
+	if e != nil {
+		_ = nut.conn.Close()
+		_ = nut.sender.Close()
+	}
+
 	return e
 }
 
@@ -120,33 +525,63 @@ func (nut *UDPNUt) Down() error {
 // left running upon EOF. In the case of UDP, it should always return
 // true, if it is also up.
 func (nut *UDPNUt) KeepAlive() bool {
-	return nut.up
+	return nut.up.Load()
 }
 
 func (nut *UDPNUt) listen(addr string) error {
 	var a *net.UDPAddr
+	var c net.PacketConn
 	var e error
 
-	if a, e = net.ResolveUDPAddr("udp", addr); e != nil {
+	logResolved(nut.network, addr)
+
+	if a, e = net.ResolveUDPAddr(nut.network, addr); e != nil {
 		return errors.Newf("failed to resolve %s: %w", addr, e)
 	}
 
-	if nut.conn, e = net.ListenUDP("udp", a); e != nil {
+	c, e = nut.sock.listenConfig().ListenPacket(
+		context.Background(),
+		nut.network,
+		a.String(),
+	)
+	if e != nil {
 		return errors.Newf("failed to listen on %s: %w", addr, e)
 	}
 
+	nut.conn = c.(*net.UDPConn) //nolint:forcetypeassert // Always UDP
+
+	if nut.fork || nut.splitUp {
+		nut.forks = make(chan NUt)
+		go nut.demux(nut.forks)
+	}
+
+	go nut.expire()
+
 	return nil
 }
 
-// Read will read from the current UDP connection.
+// Read will read from the current UDP connection. In fork mode (or
+// once split by Pair), each session is read separately, so it will
+// return EOF.
+func (nut *UDPNUt) Read(p []byte) (int, error) {
+	var e error
+	var n int
+
+	n, _, e = nut.ReadPacket(p)
+
+	return n, e
+}
+
+// ReadPacket will read a single datagram from the current UDP
+// connection, along with the address it came from.
 //
 //nolint:mnd // Log levels
-func (nut *UDPNUt) Read(p []byte) (int, error) {
+func (nut *UDPNUt) ReadPacket(p []byte) (int, net.Addr, error) {
 	var a *net.UDPAddr
 	var e error
 	var n int
 
-	if !nut.up {
+	if !nut.up.Load() {
 		logSubInfo(2, "%s read: not up", nut.String())
 	}
 
@@ -154,38 +589,141 @@ func (nut *UDPNUt) Read(p []byte) (int, error) {
 		logSubInfo(2, "%s read: no connection", nut.String())
 	}
 
-	if !nut.up || (nut.conn == nil) {
-		return 0, io.EOF
+	if !nut.up.Load() || (nut.conn == nil) {
+		return 0, nil, io.EOF
+	} else if nut.fork || nut.splitUp {
+		return 0, nil, io.EOF
 	}
 
 	if n, a, e = nut.conn.ReadFromUDP(p); e != nil {
 		logSubInfo(2, "%s read: %d bytes", nut.String(), n)
 
-		if !nut.up || (nut.mode == modeServer) {
+		if !nut.up.Load() || (nut.mode == modeServer) {
 			e = nil
 		}
 
-		return n, e
+		return n, nil, e
 	}
 
 	logSubInfo(2, "%s read: %d bytes", nut.String(), n)
 
-	if nut.mode == modeServer {
-		nut.connAddr = a
+	if (nut.group != nil) && nut.fromSelf(a) {
+		logSubInfo(2, "%s read: ignoring own datagram", nut.String())
+		return 0, a, nil
+	}
 
-		if _, ok := nut.clients[a.String()]; !ok {
-			nut.clients[a.String()] = struct{}{}
-			logGood(1, "Connection from %s", a.String())
+	if nut.mode == modeServer {
+		if nut.denied(a) {
+			return 0, a, nil
 		}
 
+		_, _ = nut.track(a)
+		nut.addrs.store(nut.conn.LocalAddr(), a)
+
 		if nut.echo {
-			if _, e = nut.Write(p); e != nil {
-				return n, e
+			if _, e = nut.WritePacket(p[:n], a); e != nil {
+				return n, a, e
 			}
 		}
 	}
 
-	return n, nil
+	return n, a, nil
+}
+
+// route will return the session that should receive the next reply,
+// which is the most recently active one. A datagram doesn't say which
+// request it answers, and guessing misroutes everything after a lost
+// or unanswered request, so Pair splits the listener into sessions to
+// route replies to several clients correctly. This is only used when
+// the listener is read directly.
+func (nut *UDPNUt) route() *udpSession {
+	nut.sessLock.Lock()
+	defer nut.sessLock.Unlock()
+
+	return nut.last
+}
+
+// Sessions will return a channel that receives a new NUt for each
+// client session, or nil if not in fork mode (or split by Pair). Each
+// time the listener comes up, it creates a new channel, which is
+// closed when it goes down. Until then, the returned channel is
+// already closed.
+func (nut *UDPNUt) Sessions() <-chan NUt {
+	var none chan NUt
+
+	if !nut.fork && !nut.splitUp {
+		return nil
+	}
+
+	nut.lock.RLock()
+	defer nut.lock.RUnlock()
+
+	if nut.forks == nil {
+		none = make(chan NUt)
+		close(none)
+
+		return none
+	}
+
+	return nut.forks
+}
+
+// split will give each client of a listener without fork its own
+// session, as Pair can't route replies from a single peer back to the
+// right client. It returns whether or not the listener was split, and
+// must be called before it comes up.
+func (nut *UDPNUt) split() bool {
+	nut.lock.Lock()
+	defer nut.lock.Unlock()
+
+	if (nut.mode != modeServer) || nut.fork || nut.up.Load() {
+		return false
+	}
+
+	nut.splitUp = true
+
+	return true
+}
+
+// track will record a datagram from the provided address, creating a
+// new session if needed. It returns the session and whether or not it
+// is new.
+func (nut *UDPNUt) track(a *net.UDPAddr) (*udpSession, bool) {
+	var ok bool
+	var session *udpSession
+
+	nut.sessLock.Lock()
+	defer nut.sessLock.Unlock()
+
+	session, ok = nut.sessions[a.String()]
+
+	// Replace sessions that were torn down (such as when idle)
+	if ok {
+		select {
+		case <-session.done:
+			ok = false
+		default:
+		}
+	}
+
+	if !ok {
+		session = newUDPSession(nut, a)
+		nut.sessions[a.String()] = session
+		nut.count("sessions", 1)
+
+		logGood(1, "Connection from %s", a.String())
+	}
+
+	session.lastSeen = time.Now()
+
+	// Forked sessions are routed by their own peer
+	if nut.fork || nut.splitUp {
+		return session, !ok
+	}
+
+	nut.last = session
+
+	return session, !ok
 }
 
 // Up will start the network utility. In the case of UDP, it will
@@ -197,12 +735,12 @@ func (nut *UDPNUt) Up() error {
 	defer nut.lock.Unlock()
 
 	// Check if already up
-	if nut.up {
+	if nut.up.Load() {
 		return nil
 	}
 
 	// Up after pipes created
-	nut.up = true
+	nut.up.Store(true)
 
 	// Create connection/listener
 	switch nut.mode {
@@ -210,23 +748,41 @@ func (nut *UDPNUt) Up() error {
 		e = nut.connect(nut.addr)
 	case modeServer:
 		e = nut.listen(nut.addr)
+	case modeBroadcast:
+		e = nut.broadcast(nut.addr)
+	case modeMulticast:
+		e = nut.join(nut.addr)
 	}
 
 	if e != nil {
-		nut.up = false
+		nut.up.Store(false)
 	}
 
 	return e
 }
 
 // Write will write to the current UDP connection.
+func (nut *UDPNUt) Write(p []byte) (int, error) {
+	return nut.WritePacket(p, nil)
+}
+
+// WritePacket will write a single datagram to the current UDP
+// connection. In client mode, the destination is ignored as the
+// connection is already connected. In server mode, a nil destination
+// will route the datagram to the most recently active client, and
+// fail if there is none (such as once its session expired). In
+// broadcast or multicast mode, a nil destination will send the
+// datagram to the broadcast address or group.
 //
 //nolint:mnd // Log levels
-func (nut *UDPNUt) Write(p []byte) (int, error) {
+func (nut *UDPNUt) WritePacket(p []byte, dst net.Addr) (int, error) {
+	var a *net.UDPAddr
 	var e error
 	var n int
+	var ok bool
+	var session *udpSession
 
-	if !nut.up {
+	if !nut.up.Load() {
 		logSubInfo(2, "%s write: not up", nut.String())
 	}
 
@@ -234,7 +790,7 @@ func (nut *UDPNUt) Write(p []byte) (int, error) {
 		logSubInfo(2, "%s write: no connection", nut.String())
 	}
 
-	if !nut.up || (nut.conn == nil) {
+	if !nut.up.Load() || (nut.conn == nil) {
 		return 0, io.EOF
 	}
 
@@ -242,22 +798,34 @@ func (nut *UDPNUt) Write(p []byte) (int, error) {
 		n, e = nut.conn.Write(p)
 		logSubInfo(2, "%s write: %d bytes", nut.String(), n)
 
-		if !nut.up {
+		if !nut.up.Load() {
 			e = nil
 		}
 
 		return n, e
 	}
 
-	if nut.connAddr == nil {
-		logSubInfo(2, "%s write: no client connection", nut.String())
-		return len(p), nil
+	if dst != nil {
+		if a, ok = dst.(*net.UDPAddr); !ok {
+			return 0, errors.Newf("invalid udp addr %s", dst)
+		}
+	} else if nut.group != nil {
+		a = nut.group
+	} else if session = nut.route(); session != nil {
+		a = session.addr
+	} else {
+		return 0, errors.New("no client to reply to")
+	}
+
+	if nut.sender != nil {
+		n, e = nut.sender.WriteToUDP(p, a)
+	} else {
+		n, e = nut.conn.WriteToUDP(p, a)
 	}
 
-	n, e = nut.conn.WriteToUDP(p, nut.connAddr)
 	logSubInfo(2, "%s write: %d bytes", nut.String(), n)
 
-	if !nut.up {
+	if !nut.up.Load() {
 		e = nil
 	}
 
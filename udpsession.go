@@ -0,0 +1,178 @@
+package nutsak
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/mjwhitta/errors"
+)
+
+// udpSession is a logical UDP session with a single remote address.
+// In fork mode, it is also a NUt that can be paired on its own, with
+// datagrams queued by the parent listener.
+type udpSession struct {
+	*baseNUt
+
+	addr     *net.UDPAddr
+	done     chan struct{}
+	lastSeen time.Time
+	parent   *UDPNUt
+	queue    chan []byte
+}
+
+func newUDPSession(parent *UDPNUt, a *net.UDPAddr) *udpSession {
+	var nut *udpSession = &udpSession{
+		baseNUt: super("udp-session:" + a.String()),
+		addr:    a,
+		done:    make(chan struct{}),
+		parent:  parent,
+		queue:   make(chan []byte, maxPending),
+	}
+
+	// Each session is its own tunnel, with the limits of the listener
+	nut.idleTimeout, nut.maxDuration = parent.limits()
+
+	return nut
+}
+
+// Down will stop the network utility. In the case of a UDP session,
+// it will stop reading queued datagrams. A session can be torn down
+// (such as when it expires) before it is ever brought up.
+func (nut *udpSession) Down() error {
+	nut.lock.Lock()
+	defer nut.lock.Unlock()
+
+	nut.up.Store(false)
+
+	// Check if already down
+	select {
+	case <-nut.done:
+	default:
+		close(nut.done)
+	}
+
+	return nil
+}
+
+// endpoints will return the local address of the parent listener
+// and the remote address of the session.
+func (nut *udpSession) endpoints() (net.Addr, net.Addr) {
+	if c := nut.parent.conn; c != nil {
+		return c.LocalAddr(), nut.addr
+	}
+
+	return nil, nut.addr
+}
+
+// KeepAlive will return whether or not the network utility should be
+// left running upon EOF. In the case of a UDP session, it should
+// always return true, if it is also up.
+func (nut *udpSession) KeepAlive() bool {
+	return nut.up.Load()
+}
+
+// Read will read the next datagram queued for this session.
+func (nut *udpSession) Read(p []byte) (int, error) {
+	var e error
+	var n int
+
+	n, _, e = nut.ReadPacket(p)
+
+	return n, e
+}
+
+// ReadPacket will read the next datagram queued for this session,
+// along with the client address it came from.
+//
+//nolint:mnd // Log levels
+func (nut *udpSession) ReadPacket(p []byte) (int, net.Addr, error) {
+	var b []byte
+	var e error
+	var n int
+
+	if !nut.up.Load() {
+		logSubInfo(2, "%s read: not up", nut.String())
+		return 0, nil, io.EOF
+	}
+
+	select {
+	case b = <-nut.queue:
+	case <-nut.done:
+		return 0, nil, io.EOF
+	}
+
+	n = copy(p, b)
+	logSubInfo(2, "%s read: %d bytes", nut.String(), n)
+
+	if nut.parent.echo {
+		if _, e = nut.WritePacket(p[:n], nil); e != nil {
+			return n, nut.addr, e
+		}
+	}
+
+	return n, nut.addr, nil
+}
+
+// Up will start the network utility. In the case of a UDP session,
+// the parent listener is already up, so it will do nothing, unless
+// the session was already torn down.
+func (nut *udpSession) Up() error {
+	nut.lock.Lock()
+	defer nut.lock.Unlock()
+
+	select {
+	case <-nut.done:
+		return errors.Newf("%s session has ended", nut.String())
+	default:
+	}
+
+	nut.up.Store(true)
+
+	return nil
+}
+
+// Write will write to the remote address of the session using the
+// parent listener's connection.
+func (nut *udpSession) Write(p []byte) (int, error) {
+	return nut.WritePacket(p, nil)
+}
+
+// WritePacket will write a single datagram using the parent
+// listener's connection. A nil destination will send the datagram to
+// the remote address of the session.
+//
+//nolint:mnd // Log levels
+func (nut *udpSession) WritePacket(
+	p []byte,
+	dst net.Addr,
+) (int, error) {
+	var a *net.UDPAddr = nut.addr
+	var e error
+	var n int
+	var ok bool
+
+	if !nut.up.Load() || !nut.parent.up.Load() {
+		logSubInfo(2, "%s write: not up", nut.String())
+		return 0, io.EOF
+	}
+
+	if dst != nil {
+		if a, ok = dst.(*net.UDPAddr); !ok {
+			return 0, errors.Newf("invalid udp addr %s", dst)
+		}
+	}
+
+	n, e = nut.parent.conn.WriteToUDP(p, a)
+	logSubInfo(2, "%s write: %d bytes", nut.String(), n)
+
+	if e != nil {
+		if !nut.up.Load() {
+			return n, nil
+		}
+
+		return n, errors.Newf("failed to write: %w", e)
+	}
+
+	return n, nil
+}
@@ -1,18 +1,115 @@
 package nutsak
 
 import (
+	"bytes"
+	"context"
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/hex"
 	"encoding/pem"
 	"io"
+	"net"
+	"net/netip"
 	"os"
+	"path"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/mjwhitta/errors"
 	"github.com/mjwhitta/pathname"
 )
 
+// activityWriter will record the time of each write, so that idle
+// tunnels can be detected.
+type activityWriter struct {
+	io.Writer
+
+	last *atomic.Int64
+}
+
+// Write will write to the underlying writer and record the time.
+func (w activityWriter) Write(p []byte) (int, error) {
+	var e error
+	var n int
+
+	if n, e = w.Writer.Write(p); n > 0 {
+		w.last.Store(time.Now().UnixNano())
+	}
+
+	return n, e //nolint:wrapcheck // Not external to repo
+}
+
+// checkKeyPair will ensure that the provided key belongs to the
+// provided cert, such as when a cert is rotated before its key.
+func checkKeyPair(cert *x509.Certificate, key *rsa.PrivateKey) error {
+	var e error
+
+	_, e = tls.X509KeyPair(
+		pem.EncodeToMemory(
+			&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw},
+		),
+		pem.EncodeToMemory(
+			&pem.Block{
+				Type:  "RSA PRIVATE KEY",
+				Bytes: x509.MarshalPKCS1PrivateKey(key),
+			},
+		),
+	)
+	if e != nil {
+		return errors.Newf("cert and key do not match: %w", e)
+	}
+
+	return nil
+}
+
+// copyPackets will copy whole datagrams from a to b until EOF, so
+// that message boundaries are preserved. Both NUts must be
+// PacketNUts.
+// clientsOf will return how many clients the provided NUt has served
+// without fork, or 0 if it doesn't count them.
+func clientsOf(nut NUt) uint64 {
+	if c, ok := nut.(clienter); ok {
+		return c.clients()
+	}
+
+	return 0
+}
+
+func copyPackets(b NUt, a NUt, last *atomic.Int64) error {
+	var buf []byte = make([]byte, maxDatagram)
+	var e error
+	var n int
+	var pa PacketNUt
+	var pb PacketNUt
+
+	pa, _ = a.(PacketNUt)
+	pb, _ = b.(PacketNUt)
+
+	for {
+		n, _, e = pa.ReadPacket(buf)
+
+		if n > 0 {
+			if _, e := pb.WritePacket(buf[:n], nil); e != nil {
+				return e //nolint:wrapcheck // Not external to repo
+			}
+
+			if hook := Trace; hook != nil {
+				hook(a, b, buf[:n])
+			}
+
+			last.Store(time.Now().UnixNano())
+		}
+
+		if e == io.EOF { //nolint:errorlint // Never wrapped
+			return nil
+		} else if e != nil {
+			return e //nolint:wrapcheck // Not external to repo
+		}
+	}
+}
+
 func decodeCert(b []byte) (*x509.Certificate, error) {
 	var block *pem.Block
 	var cert *x509.Certificate
@@ -45,6 +142,44 @@ func decodeKey(b []byte) (*rsa.PrivateKey, error) {
 	return key, nil
 }
 
+// isClosed will return whether or not the provided channel has been
+// closed.
+func isClosed(done chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// isExpired will return whether or not the provided CRL is past its
+// next update, and should no longer be trusted.
+func isExpired(crl *x509.RevocationList) bool {
+	if crl.NextUpdate.IsZero() {
+		return false
+	}
+
+	return time.Now().After(crl.NextUpdate)
+}
+
+func isRevoked(
+	crl *x509.RevocationList,
+	cert *x509.Certificate,
+) bool {
+	if (crl == nil) || !bytes.Equal(crl.RawIssuer, cert.RawIssuer) {
+		return false
+	}
+
+	for _, revoked := range crl.RevokedCertificateEntries {
+		if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
 //nolint:unparam // It might change later
 func logErr(lvl int, msg string, args ...any) {
 	if (Logger == nil) || (LogLvl < lvl) {
@@ -63,6 +198,49 @@ func logGood(lvl int, msg string, args ...any) {
 	_ = Logger.Goodf(msg, args...)
 }
 
+// logResolved will log every address that the host of the provided
+// address resolves to, if there is more than one.
+func logResolved(network string, addr string) {
+	var e error
+	var host string
+	var ips []net.IP
+	var list []string
+
+	if host, _, e = net.SplitHostPort(addr); e != nil {
+		return
+	}
+
+	// Nothing to report for literal IPs
+	if _, e = netip.ParseAddr(host); (host == "") || (e == nil) {
+		return
+	}
+
+	// Only look up addresses of the requested family
+	switch {
+	case strings.HasSuffix(network, "4"):
+		network = "ip4"
+	case strings.HasSuffix(network, "6"):
+		network = "ip6"
+	default:
+		network = "ip"
+	}
+
+	ips, e = net.DefaultResolver.LookupIP(
+		context.Background(),
+		network,
+		host,
+	)
+	if (e != nil) || (len(ips) < 2) { //nolint:mnd // Several addrs
+		return
+	}
+
+	for _, ip := range ips {
+		list = append(list, ip.String())
+	}
+
+	logSubInfo(1, "%s resolves to %s", host, strings.Join(list, ", "))
+}
+
 //nolint:unparam // It might change later
 func logSubInfo(lvl int, msg string, args ...any) {
 	if (Logger == nil) || (LogLvl < lvl) {
@@ -72,6 +250,187 @@ func logSubInfo(lvl int, msg string, args ...any) {
 	_ = Logger.SubInfof(msg, args...)
 }
 
+//nolint:unparam // It might change later
+func logWarn(lvl int, msg string, args ...any) {
+	if (Logger == nil) || (LogLvl < lvl) {
+		return
+	}
+
+	_ = Logger.Warnf(msg, args...)
+}
+
+// limitsOf will return the shortest idle timeout and max duration of
+// the provided NUts. If none of them have a limit, IdleTimeout and
+// MaxDuration are used instead.
+func limitsOf(nuts ...NUt) (time.Duration, time.Duration) {
+	var idle time.Duration
+	var maxDuration time.Duration
+
+	for _, nut := range nuts {
+		if l, ok := nut.(limiter); ok {
+			i, m := l.limits()
+
+			if (i > 0) && ((idle == 0) || (i < idle)) {
+				idle = i
+			}
+
+			if (m > 0) && ((maxDuration == 0) || (m < maxDuration)) {
+				maxDuration = m
+			}
+		}
+	}
+
+	if idle == 0 {
+		idle = IdleTimeout
+	}
+
+	if maxDuration == 0 {
+		maxDuration = MaxDuration
+	}
+
+	return idle, maxDuration
+}
+
+func matchAny(patterns []string, values ...string) bool {
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if ok, _ := path.Match(pattern, value); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// normalizeAddr will ensure the provided address has a host and a
+// port. A bare port is given an empty host, which means all local
+// addresses (both IPv4 and IPv6, when available).
+func normalizeAddr(addr string) (string, error) {
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+
+	if _, _, e := net.SplitHostPort(addr); e != nil {
+		return "", errors.Newf("invalid addr %s: %w", addr, e)
+	}
+
+	return addr, nil
+}
+
+// normalizeTLSName will lowercase a cipher suite, curve, or version
+// name and strip any separators or prefixes, so that user provided
+// names like "P-256" match Go names like "CurveP256".
+func normalizeTLSName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.NewReplacer("-", "", "_", "").Replace(name)
+	name = strings.TrimPrefix(name, "curve")
+
+	return name
+}
+
+// parseBind will return the local address to bind to, using the same
+// rules as listener addresses. A bare IP (without a port) will bind
+// to any available port.
+func parseBind(v string) (string, error) {
+	var ip string = v
+
+	if strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]") {
+		ip = v[1 : len(v)-1]
+	}
+
+	if _, e := netip.ParseAddr(ip); e == nil {
+		return net.JoinHostPort(ip, "0"), nil
+	}
+
+	return normalizeAddr(v)
+}
+
+func parseCiphers(v string) ([]uint16, error) {
+	var ciphers []uint16
+	var known map[string]uint16 = map[string]uint16{}
+
+	for _, c := range tls.CipherSuites() {
+		known[normalizeTLSName(c.Name)] = c.ID
+	}
+
+	for _, c := range tls.InsecureCipherSuites() {
+		known[normalizeTLSName(c.Name)] = c.ID
+	}
+
+	for name := range strings.SplitSeq(v, ":") {
+		if id, ok := known[normalizeTLSName(name)]; ok {
+			ciphers = append(ciphers, id)
+			continue
+		}
+
+		return nil, errors.Newf("unknown cipher suite %s", name)
+	}
+
+	return ciphers, nil
+}
+
+func parseCurves(v string) ([]tls.CurveID, error) {
+	var curves []tls.CurveID
+	var known map[string]tls.CurveID = map[string]tls.CurveID{}
+
+	for _, c := range []tls.CurveID{
+		tls.CurveP256,
+		tls.CurveP384,
+		tls.CurveP521,
+		tls.X25519,
+		tls.X25519MLKEM768,
+	} {
+		known[normalizeTLSName(c.String())] = c
+	}
+
+	for name := range strings.SplitSeq(v, ":") {
+		if id, ok := known[normalizeTLSName(name)]; ok {
+			curves = append(curves, id)
+			continue
+		}
+
+		return nil, errors.Newf("unknown curve %s", name)
+	}
+
+	return curves, nil
+}
+
+// parseFamily will return the provided network (such as tcp or udp4)
+// restricted to the provided protocol family (ip4 or ip6).
+func parseFamily(network string, pf string) (string, error) {
+	var base string = strings.TrimRight(network, "46")
+
+	switch pf {
+	case "ip4", "ip6":
+	default:
+		return "", errors.Newf("unknown pf %s", pf)
+	}
+
+	if (network != base) && (network != base+pf[2:]) {
+		return "", errors.Newf("pf %s conflicts with %s", pf, network)
+	}
+
+	return base + pf[2:], nil
+}
+
+func parseTLSVersion(v string) (uint16, error) {
+	var name string = strings.TrimPrefix(normalizeTLSName(v), "tls")
+
+	switch strings.TrimPrefix(name, "v") {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+
+	return 0, errors.Newf("unknown TLS version %s", v)
+}
+
 func readCert(fn string) (*x509.Certificate, error) {
 	var b []byte
 	var e error
@@ -85,6 +444,29 @@ func readCert(fn string) (*x509.Certificate, error) {
 	return decodeCert(b)
 }
 
+func readCRL(fn string) (*x509.RevocationList, error) {
+	var b []byte
+	var block *pem.Block
+	var crl *x509.RevocationList
+	var e error
+
+	if b, e = hex.DecodeString(fn); e != nil {
+		if b, e = os.ReadFile(pathname.ExpandPath(fn)); e != nil {
+			return nil, errors.Newf("failed to read %s: %w", fn, e)
+		}
+	}
+
+	if block, _ = pem.Decode(b); block != nil {
+		b = block.Bytes
+	}
+
+	if crl, e = x509.ParseRevocationList(b); e != nil {
+		return nil, errors.Newf("failed to parse crl: %w", e)
+	}
+
+	return crl, nil
+}
+
 func readKey(fn string) (*rsa.PrivateKey, error) {
 	var b []byte
 	var e error
@@ -98,8 +480,20 @@ func readKey(fn string) (*rsa.PrivateKey, error) {
 	return decodeKey(b)
 }
 
-func stream(a NUt, b NUt) {
+// seedOf will return the seed the provided NUt was created from, or
+// its String() if it doesn't remember one.
+func seedOf(nut NUt) string {
+	if s, ok := nut.(seeder); ok && (s.origin() != "") {
+		return s.origin()
+	}
+
+	return nut.String()
+}
+
+func stream(a NUt, b NUt, last *atomic.Int64) {
 	var e error
+	var packets bool
+	var w io.Writer
 
 	// Let things settle
 	for !a.IsUp() || !b.IsUp() {
@@ -108,8 +502,25 @@ func stream(a NUt, b NUt) {
 
 	time.Sleep(time.Millisecond)
 
+	// Preserve message boundaries, if possible
+	if _, packets = a.(PacketNUt); packets {
+		_, packets = b.(PacketNUt)
+	}
+
+	// Trace what was written, not what was read
+	w = activityWriter{
+		Writer: traceWriter{Writer: b, from: a, to: b},
+		last:   last,
+	}
+
 	for {
-		if _, e = io.Copy(b, a); !a.KeepAlive() {
+		if packets {
+			e = copyPackets(b, a, last)
+		} else {
+			_, e = io.Copy(w, a)
+		}
+
+		if !a.KeepAlive() {
 			return
 		}
 
@@ -121,3 +532,56 @@ func stream(a NUt, b NUt) {
 		time.Sleep(time.Second)
 	}
 }
+
+// watchdog will tear down the provided Pair once it has been idle
+// for longer than the idle timeout, or open for longer than the max
+// duration, whichever comes first. It returns when done is closed.
+// Both NUts are brought down, so a Pair with a non-forking listener
+// stops listening. Fork sessions each have their own watchdog.
+func watchdog(a NUt, b NUt, last *atomic.Int64, done chan struct{}) {
+	var idle time.Duration
+	var maxDuration time.Duration
+	var next time.Time
+	var quiet time.Duration
+	var reason string
+	var start time.Time = time.Now()
+
+	idle, maxDuration = limitsOf(a, b)
+	if (idle == 0) && (maxDuration == 0) {
+		return
+	}
+
+	for reason == "" {
+		next = time.Time{}
+
+		if idle > 0 {
+			next = time.Unix(0, last.Load()).Add(idle)
+		}
+
+		if m := start.Add(maxDuration); maxDuration > 0 {
+			if next.IsZero() || m.Before(next) {
+				next = m
+			}
+		}
+
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		quiet = time.Since(time.Unix(0, last.Load()))
+
+		switch {
+		case (idle > 0) && (quiet >= idle):
+			reason = "idle for " + idle.String()
+		case (maxDuration > 0) && (time.Since(start) >= maxDuration):
+			reason = "open for " + maxDuration.String()
+		}
+	}
+
+	logWarn(1, "Closing %s <-> %s: %s", a, b, reason)
+
+	_ = a.Down()
+	_ = b.Down()
+}